@@ -4,29 +4,60 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc/keepalive"
 
 	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/logging"
 	"github.com/day0ops/ext-proc-routing-decision/pkg/server"
 	"github.com/day0ops/ext-proc-routing-decision/pkg/version"
 )
 
 var (
-	grpcport = flag.String("port", "8081", "port used for gRPC server")
+	grpcport    = flag.String("port", "", "port used for gRPC server (GRPC_PORT when empty)")
+	adminport   = flag.String("admin-port", "", "port used for the admin http server (disabled when empty)")
+	metricsport = flag.String("metrics-port", "", "port the metrics are served on without the admin endpoints (disabled when empty)")
+	multiplex   = flag.Bool("multiplex", false, "serve the admin http server on the gRPC port")
+	reflection  = flag.Bool("reflection", false, "register the gRPC reflection service, e.g. for grpcurl")
+	configfile  = flag.String("config", "", "YAML config file taking precedence over the environment (disabled when empty)")
+	showversion = flag.Bool("version", false, "print the version and exit")
 )
 
+// stdout is where -version prints to
+var stdout io.Writer = os.Stdout
+
 func main() {
 	os.Exit(start())
 }
 
 func start() int {
-	log, err := createLogger()
+	flag.Parse()
+
+	if *showversion {
+		fmt.Fprintln(stdout, version.HumanVersion)
+		return 0
+	}
+
+	// the file may set the log levels so it's loaded before the logger is created
+	cfg := config.FromEnv()
+	if *configfile != "" {
+		var err error
+		if cfg, err = config.Load(*configfile); err != nil {
+			fmt.Println("error loading the config file:", err)
+			return 1
+		}
+		// the package config is authoritative, the file only overrides it
+		cfg.Apply()
+	}
+
+	log, err := createLogger(cfg)
 	if err != nil {
 		fmt.Println("error setting up the logger:", err)
 		return 1
@@ -39,16 +70,53 @@ func start() int {
 		_ = log.Sync()
 	}()
 
-	flag.Parse()
+	// covers the config file, once applied, along with the environment
+	if err := cfg.Validate(); err != nil {
+		log.Error("invalid configuration", zap.Error(err))
+		return 1
+	}
 
-	s := server.New(context.Background(), log, server.WithGrpcServer(nil, "tcp", *grpcport))
+	address := grpcAddress(*grpcport, cfg.Grpc)
+	opts := []server.Option{
+		server.WithGrpcServer(nil, "tcp", address),
+		server.WithMaxConcurrentStreams(uint32(cfg.Grpc.MaxConcurrentStreams)),
+		server.WithConfigReload(*configfile),
+	}
+	if cfg.Grpc.KeepaliveTime > 0 {
+		opts = append(opts, server.WithKeepalive(
+			keepalive.ServerParameters{Time: cfg.Grpc.KeepaliveTime, Timeout: cfg.Grpc.KeepaliveTimeout},
+			keepalive.EnforcementPolicy{MinTime: cfg.Grpc.KeepaliveMinTime, PermitWithoutStream: true},
+		))
+	}
+	if *adminport != "" || *multiplex {
+		opts = append(opts, server.WithAdminServer(fmt.Sprintf(":%s", *adminport), cfg.AdminToken))
+	}
+	if *metricsport != "" {
+		opts = append(opts, server.WithMetrics(fmt.Sprintf(":%s", *metricsport)))
+	}
+	if *multiplex {
+		opts = append(opts, server.WithMultiplexing())
+	}
+	if cfg.TracingEndpoint != "" {
+		opts = append(opts, server.WithTracing(cfg.TracingEndpoint))
+	}
+	if *reflection {
+		opts = append(opts, server.WithReflection())
+	}
+	switch tls := cfg.Grpc.TLS; {
+	case tls.CAFile != "":
+		opts = append(opts, server.WithMTLS(tls.CertFile, tls.KeyFile, tls.CAFile))
+	case tls.CertFile != "":
+		opts = append(opts, server.WithTLS(tls.CertFile, tls.KeyFile))
+	}
+	s := server.New(context.Background(), log, opts...)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
 	eg, ctx := errgroup.WithContext(ctx)
 
 	eg.Go(func() error {
-		log.Info("starting gRPC server on port", zap.String("port", *grpcport))
+		log.Info("starting gRPC server", zap.String("address", address))
 		if err := s.Serve(); err != nil {
 			log.Info("error starting server", zap.Error(err))
 			return err
@@ -73,21 +141,21 @@ func start() int {
 	return 0
 }
 
-func createLogger() (*zap.Logger, error) {
-	encoder := zap.NewProductionEncoderConfig()
-	level := zap.NewAtomicLevelAt(getLevelLogger(config.LogLevel))
-
-	zapConfig := zap.NewProductionConfig()
-	zapConfig.EncoderConfig = encoder
-	zapConfig.Level = level
-	zapConfig.OutputPaths = []string{"stdout"}
-	zapConfig.ErrorOutputPaths = []string{"stderr"}
-	return zapConfig.Build()
+// grpcAddress is the address the gRPC server listens on, the -port flag takes precedence over the configured port
+func grpcAddress(port string, c config.GrpcConfig) string {
+	if port == "" {
+		port = c.Port
+	}
+	if c.BindAddress == "" {
+		return port
+	}
+	return net.JoinHostPort(c.BindAddress, port)
 }
 
-func getLevelLogger(level string) zapcore.Level {
-	if level == "debug" {
-		return zap.DebugLevel
-	}
-	return zap.InfoLevel
+func createLogger(cfg *config.Config) (*zap.Logger, error) {
+	return logging.New(cfg.LogLevel, map[string]string{
+		logging.Processor:      cfg.LogLevels.Processor,
+		logging.Server:         cfg.LogLevels.Server,
+		logging.DecisionClient: cfg.LogLevels.DecisionClient,
+	})
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/version"
+)
+
+func TestVersionFlag(t *testing.T) {
+	args, out := os.Args, stdout
+	t.Cleanup(func() {
+		os.Args, stdout = args, out
+		*showversion = false
+	})
+	var buf bytes.Buffer
+	os.Args, stdout = []string{"ext-proc-routing-decision", "-version"}, &buf
+
+	require.Equal(t, 0, start())
+	require.Equal(t, version.HumanVersion+"\n", buf.String())
+}
+
+func TestGrpcAddress(t *testing.T) {
+	require.Equal(t, "8081", grpcAddress("", config.GrpcConfig{Port: "8081"}))
+	require.Equal(t, "9000", grpcAddress("9000", config.GrpcConfig{Port: "8081"}), "the flag takes precedence")
+	require.Equal(t, "0.0.0.0:8081", grpcAddress("", config.GrpcConfig{Port: "8081", BindAddress: "0.0.0.0"}))
+	require.Equal(t, "127.0.0.1:9000", grpcAddress("9000", config.GrpcConfig{Port: "8081", BindAddress: "127.0.0.1"}))
+	require.Equal(t, "[::1]:8081", grpcAddress("", config.GrpcConfig{Port: "8081", BindAddress: "::1"}))
+}
@@ -2,3 +2,54 @@ package config
 
 const RoutingDecisionHeader = "x-routing-decision"
 const PreferredSvcHeader = "preferred-svc"
+
+// RoutingDecisionAppliedHeader is added to the response to tell the client which service its request was routed to
+const RoutingDecisionAppliedHeader = "x-routing-decision-applied"
+
+// behaviors for config.OnUnknownRequestType
+const UnknownRequestTypeIgnore = "ignore"
+const UnknownRequestTypeError = "error"
+
+// supported values of config.DecisionProvider
+const DecisionProviderHTTP = "http"
+const DecisionProviderRedis = "redis"
+const DecisionProviderGRPC = "grpc"
+
+// transforms supported by config.PathNormalization
+const PathCollapseSlashes = "collapse-slashes"
+const PathResolveDots = "resolve-dots"
+const PathTrimTrailingSlash = "trim-trailing-slash"
+const PathLowercase = "lowercase"
+
+// supported values of config.RequestStartFormat
+const TimestampRFC3339 = "rfc3339"
+const TimestampEpochMillis = "epoch-millis"
+
+// supported values of config.DisallowedUpstreamAction
+const DisallowedUpstreamFallback = "fallback"
+const DisallowedUpstreamDeny = "deny"
+
+// DecisionActionDeny is the action of a decision response rejecting the request rather than routing it
+const DecisionActionDeny = "deny"
+
+// supported values of config.ContradictoryDecisionResolution
+const ContradictoryDecisionDeny = "deny"
+const ContradictoryDecisionInvalid = "invalid"
+
+// fields supported by config.DecisionMetadataFields
+const MetadataFieldDecision = "decision"
+const MetadataFieldSource = "source"
+const MetadataFieldTenant = "tenant"
+const MetadataFieldLatency = "latency_ms"
+
+// supported values of config.CircuitBreakerOpenAction
+const CircuitBreakerOpenFallback = "fallback"
+const CircuitBreakerOpenReject = "reject"
+
+// supported values of config.BodyProcessingMode
+const BodyProcessingBuffered = "buffered"
+const BodyProcessingStreamed = "streamed"
+
+// supported values of config.WebSocketStrategy
+const WebSocketStrategyDecide = "decide"
+const WebSocketStrategySticky = "sticky"
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the YAML configuration file on top of FromEnv. Unknown settings are rejected so that a typo doesn't go
+// unnoticed. The settings are checked by Config.Validate, which reports those the file set by their key.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the config file: %w", err)
+	}
+
+	c := FromEnv()
+	// the pools of the file are added to those of the environment, without modifying them
+	c.DecisionServer.Pools = maps.Clone(c.DecisionServer.Pools)
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("cannot parse the config file %s: %w", path, err)
+	}
+	c.fileKeys = fileKeys(data)
+	server, err := ParseDecisionServer(c.DecisionServer.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: decisionServer.url is invalid: %w", path, err)
+	}
+	c.DecisionServer.URL = server
+	if len(c.DecisionServer.Pools) > 0 {
+		// keyed like the pools of DECISION_SERVER_POOLS so that they are found for the decision server URLs
+		pools := make(map[string]TransportPool, len(c.DecisionServer.Pools))
+		for rawURL, pool := range c.DecisionServer.Pools {
+			key, err := PoolKey(rawURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid config file %s: decisionServer.pools has an invalid decision server: %w", path, err)
+			}
+			pools[key] = pool
+		}
+		c.DecisionServer.Pools = pools
+	}
+	return c, nil
+}
+
+// fileKeys returns the dotted path of every key the config file sets, e.g. decisionServer and decisionServer.retries
+func fileKeys(data []byte) map[string]bool {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	keys := map[string]bool{}
+	addFileKeys(keys, "", doc.Content[0])
+	return keys
+}
+
+func addFileKeys(keys map[string]bool, prefix string, node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := prefix + node.Content[i].Value
+		keys[key] = true
+		addFileKeys(keys, key+".", node.Content[i+1])
+	}
+}
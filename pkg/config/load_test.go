@@ -0,0 +1,160 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// configFile writes the YAML to a config file for the test
+func configFile(t *testing.T, yaml string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(yaml), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	c, err := config.Load(configFile(t, `
+logLevel: debug
+decisionServer:
+  url: decision:8080/decision
+  timeout: 250ms
+  retries: 2
+  method: POST
+  forwardHeaders: [authorization, x-tenant]
+cache:
+  ttl: 1m
+  size: 100
+headers:
+  tenant: x-org
+deniedServices:
+  services: [internal]
+grpc:
+  maxConcurrentStreams: 50
+  tls:
+    certFile: /etc/tls/tls.crt
+    keyFile: /etc/tls/tls.key
+`))
+	require.NoError(t, err)
+
+	require.Equal(t, "debug", c.LogLevel)
+	require.Equal(t, "http://decision:8080/decision", c.DecisionServer.URL)
+	require.Equal(t, 250*time.Millisecond, c.DecisionServer.Timeout)
+	require.Equal(t, 2, c.DecisionServer.Retries)
+	require.Equal(t, "POST", c.DecisionServer.Method)
+	require.Equal(t, []string{"authorization", "x-tenant"}, c.DecisionServer.ForwardHeaders)
+	require.Equal(t, time.Minute, c.Cache.TTL)
+	require.Equal(t, 100, c.Cache.Size)
+	require.Equal(t, "x-org", c.Headers.Tenant)
+	require.Equal(t, []string{"internal"}, c.DeniedServices.Services)
+	require.Equal(t, 50, c.Grpc.MaxConcurrentStreams)
+	require.Equal(t, "/etc/tls/tls.key", c.Grpc.TLS.KeyFile)
+
+	require.Equal(t, config.DeniedServiceStatus, c.DeniedServices.Status, "settings left out of the file should keep their default")
+	require.Equal(t, config.DecisionCacheHeader, c.Cache.Header)
+}
+
+func TestLoadSettingGroups(t *testing.T) {
+	c, err := config.Load(configFile(t, `
+decisionServer:
+  pools:
+    HTTP://Decision-A:8080/decision:
+      maxIdleConns: 32
+      idleConnTimeout: 90s
+provider:
+  name: redis
+  redis:
+    url: redis://redis:6379
+    keyTemplate: "route:{x-tenant}"
+decision:
+  keyTemplate: "{:authority}{:path}"
+  allowedUpstreamHosts: [orders]
+mutation:
+  rolloutPercent: 25
+legacyPreferredSvcDeprecation:
+  enabled: true
+  date: 2026-01-01T00:00:00Z
+dynamicMetadata:
+  namespace: routing
+  fields:
+    - field: decision
+      name: service
+debugResponses: true
+`))
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]config.TransportPool{"http://decision-a:8080": {MaxIdleConns: 32, IdleConnTimeout: 90 * time.Second}}, c.DecisionServer.Pools)
+	require.Equal(t, config.DecisionProviderRedis, c.Provider.Name)
+	require.Equal(t, "route:{x-tenant}", c.Provider.Redis.KeyTemplate)
+	require.Equal(t, "{:authority}{:path}", c.Decision.KeyTemplate)
+	require.Equal(t, []string{"orders"}, c.Decision.AllowedUpstreamHosts)
+	require.Equal(t, 25, c.Mutation.RolloutPercent)
+	require.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), c.LegacyPreferredSvcDeprecation.Date)
+	require.Equal(t, []config.MetadataField{{Field: config.MetadataFieldDecision, Name: "service"}}, c.DynamicMetadata.Fields)
+	require.True(t, c.DebugResponses)
+
+	require.Empty(t, config.FromEnv().DecisionServer.Pools, "the pools of the environment should be left untouched")
+}
+
+func TestLoadEmpty(t *testing.T) {
+	c, err := config.Load(configFile(t, ""))
+	require.NoError(t, err)
+	require.Equal(t, config.FromEnv(), c)
+}
+
+func TestLoadMalformed(t *testing.T) {
+	_, err := config.Load(configFile(t, "decisionServer: [url"))
+	require.ErrorContains(t, err, "cannot parse the config file")
+
+	_, err = config.Load(configFile(t, "decisionServer:\n  timeout: soon\n"))
+	require.ErrorContains(t, err, "cannot parse the config file")
+
+	_, err = config.Load(configFile(t, "decisionServer:\n  uri: http://decision\n"))
+	require.ErrorContains(t, err, "field uri not found", "a misspelt setting should be rejected")
+
+	_, err = config.Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorContains(t, err, "cannot read the config file")
+}
+
+func TestLoadInvalidDecisionServer(t *testing.T) {
+	_, err := config.Load(configFile(t, "decisionServer:\n  url: ftp://decision\n"))
+	require.ErrorContains(t, err, "decisionServer.url is invalid")
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	c, err := config.Load(configFile(t, `
+decisionServer:
+  retries: -1
+cache:
+  ttlJitter: 150
+grpc:
+  tls:
+    keyFile: /etc/tls/tls.key
+`))
+	require.NoError(t, err, "the settings are validated once loaded")
+
+	err = c.Validate()
+	require.ErrorContains(t, err, "decisionServer.retries must not be negative, got -1")
+	require.ErrorContains(t, err, "cache.ttlJitter must be between 0 and 100, got 150")
+	require.ErrorContains(t, err, "GRPC_TLS_CERT_FILE and grpc.tls.keyFile must be set together", "settings left out of the file keep their environment name")
+}
+
+func TestConfigApply(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, config.RoutingDecisionServer)
+	setConfig(t, &config.TenantHeader, config.TenantHeader)
+	setConfig(t, &config.RoutingDecisionRetries, config.RoutingDecisionRetries)
+
+	c, err := config.Load(configFile(t, "decisionServer:\n  url: http://decision\n  retries: 3\nheaders:\n  tenant: x-org\n"))
+	require.NoError(t, err)
+	c.Apply()
+
+	require.Equal(t, "http://decision", config.RoutingDecisionServer)
+	require.Equal(t, 3, config.RoutingDecisionRetries)
+	require.Equal(t, "x-org", config.TenantHeader)
+	require.NoError(t, config.Validate())
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetadataField is a field of the decision metadata along with the name it is emitted as
+type MetadataField struct {
+	Field string `yaml:"field"`
+	Name  string `yaml:"name"`
+}
+
+// ParseMetadataFields parses comma separated metadata fields optionally renamed as <field>=<name>,
+// e.g. decision=routing_decision,source. Every supported field is emitted under its own name when empty.
+func ParseMetadataFields(v string) ([]MetadataField, error) {
+	var fields []MetadataField
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		field, name, renamed := strings.Cut(entry, "=")
+		field, name = strings.TrimSpace(field), strings.TrimSpace(name)
+		switch field {
+		case MetadataFieldDecision, MetadataFieldSource, MetadataFieldTenant, MetadataFieldLatency:
+		default:
+			return nil, fmt.Errorf("unknown metadata field %q", field)
+		}
+		if !renamed {
+			name = field
+		}
+		if name == "" {
+			return nil, fmt.Errorf("metadata field %q has an empty name", field)
+		}
+		fields = append(fields, MetadataField{Field: field, Name: name})
+	}
+	if len(fields) == 0 {
+		for _, field := range []string{MetadataFieldDecision, MetadataFieldSource, MetadataFieldTenant, MetadataFieldLatency} {
+			fields = append(fields, MetadataField{Field: field, Name: field})
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TransportPool tunes the pool of connections kept open to a decision server
+type TransportPool struct {
+	// MaxIdleConns of 0 disables pooling
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	IdleConnTimeout time.Duration `yaml:"idleConnTimeout"`
+}
+
+// PoolKey returns the scheme and host of the URL which identifies the decision server a pool belongs to
+func PoolKey(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute URL", rawURL)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// ParseTransportPools parses comma separated per decision server pool settings of the form
+// <url>=<max idle conns>/<idle conn timeout>, e.g. http://decision-a:8080=32/90s
+func ParseTransportPools(v string) (map[string]TransportPool, error) {
+	pools := map[string]TransportPool{}
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("pool %q is missing its settings", entry)
+		}
+		key, err := PoolKey(entry[:i])
+		if err != nil {
+			return nil, fmt.Errorf("pool %q: %w", entry, err)
+		}
+		conns, timeout, ok := strings.Cut(entry[i+1:], "/")
+		if !ok {
+			return nil, fmt.Errorf("pool %q must be <url>=<max idle conns>/<idle conn timeout>", entry)
+		}
+		var pool TransportPool
+		if pool.MaxIdleConns, err = strconv.Atoi(conns); err != nil || pool.MaxIdleConns < 0 {
+			return nil, fmt.Errorf("pool %q has an invalid max idle conns %q", entry, conns)
+		}
+		if pool.IdleConnTimeout, err = time.ParseDuration(timeout); err != nil {
+			return nil, fmt.Errorf("pool %q has an invalid idle conn timeout %q", entry, timeout)
+		}
+		pools[key] = pool
+	}
+	return pools, nil
+}
@@ -0,0 +1,630 @@
+package config
+
+import "time"
+
+// Config is the configuration of a server, see FromEnv and Load. The package variables are the configuration in effect
+// unless a Config is given to the server.
+type Config struct {
+	LogLevel                      string                  `yaml:"logLevel"`
+	LogLevels                     LogLevelsConfig         `yaml:"logLevels"`
+	DecisionServer                DecisionServerConfig    `yaml:"decisionServer"`
+	Provider                      ProviderConfig          `yaml:"provider"`
+	Decision                      DecisionConfig          `yaml:"decision"`
+	Mutation                      MutationConfig          `yaml:"mutation"`
+	Cache                         CacheConfig             `yaml:"cache"`
+	Headers                       HeadersConfig           `yaml:"headers"`
+	LegacyPreferredSvcDeprecation DeprecationConfig       `yaml:"legacyPreferredSvcDeprecation"`
+	RequiredHeader                RequiredHeaderConfig    `yaml:"requiredHeader"`
+	RequestStart                  RequestStartConfig      `yaml:"requestStart"`
+	DeniedServices                DeniedServicesConfig    `yaml:"deniedServices"`
+	Problem                       ProblemConfig           `yaml:"problem"`
+	CircuitBreaker                CircuitBreakerConfig    `yaml:"circuitBreaker"`
+	Probe                         ProbeConfig             `yaml:"probe"`
+	HealthCheck                   HealthCheckConfig       `yaml:"healthCheck"`
+	SlowStart                     SlowStartConfig         `yaml:"slowStart"`
+	WebSocket                     WebSocketConfig         `yaml:"webSocket"`
+	Body                          BodyConfig              `yaml:"body"`
+	AnnotateResponseBody          AnnotateConfig          `yaml:"annotateResponseBody"`
+	PathNormalization             PathNormalizationConfig `yaml:"pathNormalization"`
+	DynamicMetadata               DynamicMetadataConfig   `yaml:"dynamicMetadata"`
+	TenantServers                 TenantServersConfig     `yaml:"tenantServers"`
+	Stream                        StreamConfig            `yaml:"stream"`
+	Audit                         AuditConfig             `yaml:"audit"`
+	Grpc                          GrpcConfig              `yaml:"grpc"`
+	DefaultDecision               string                  `yaml:"defaultDecision"`
+	DebugResponses                bool                    `yaml:"debugResponses"`
+	TracingEndpoint               string                  `yaml:"tracingEndpoint"`
+	AdminToken                    string                  `yaml:"adminToken"`
+	MetricsLabels                 []string                `yaml:"metricsDecisionLabels"`
+
+	// fileKeys are the keys set by the config file, e.g. decisionServer.retries, so that Validate reports them
+	fileKeys map[string]bool
+}
+
+// LogLevelsConfig are the per subsystem log levels overriding Config.LogLevel
+type LogLevelsConfig struct {
+	Processor      string `yaml:"processor"`
+	Server         string `yaml:"server"`
+	DecisionClient string `yaml:"decisionClient"`
+}
+
+// DecisionServerConfig is how decisions are fetched from the external service
+type DecisionServerConfig struct {
+	URL                     string                   `yaml:"url"`
+	Timeout                 time.Duration            `yaml:"timeout"`
+	Retries                 int                      `yaml:"retries"`
+	RetryBackoff            time.Duration            `yaml:"retryBackoff"`
+	RetryMaxBackoff         time.Duration            `yaml:"retryMaxBackoff"`
+	Method                  string                   `yaml:"method"`
+	ContentType             string                   `yaml:"contentType"`
+	ForwardHeaders          []string                 `yaml:"forwardHeaders"`
+	RequestMaxBodyBytes     int                      `yaml:"requestMaxBodyBytes"`
+	CAFile                  string                   `yaml:"caFile"`
+	TLSSessionMaxAge        time.Duration            `yaml:"tlsSessionMaxAge"`
+	Pool                    TransportPool            `yaml:"pool"`
+	Pools                   map[string]TransportPool `yaml:"pools"`
+	BatchWindow             time.Duration            `yaml:"batchWindow"`
+	BatchMaxSize            int                      `yaml:"batchMaxSize"`
+	LenientDecode           bool                     `yaml:"lenientDecode"`
+	ContradictoryResolution string                   `yaml:"contradictoryResolution"`
+	BodyLog                 BodyLogConfig            `yaml:"bodyLog"`
+}
+
+// BodyLogConfig is how the sampled decision server calls are logged
+type BodyLogConfig struct {
+	SampleRate float64  `yaml:"sampleRate"`
+	MaxBytes   int      `yaml:"maxBytes"`
+	Redact     []string `yaml:"redact"`
+}
+
+// ProviderConfig is where decisions are looked up
+type ProviderConfig struct {
+	Name   string              `yaml:"name"`
+	FanOut []string            `yaml:"fanOut"`
+	GRPC   GRPCProviderConfig  `yaml:"grpc"`
+	Redis  RedisProviderConfig `yaml:"redis"`
+}
+
+// GRPCProviderConfig is the decision service of the grpc decision provider
+type GRPCProviderConfig struct {
+	Server string `yaml:"server"`
+	TLS    bool   `yaml:"tls"`
+}
+
+// RedisProviderConfig is the redis the redis decision provider looks decisions up in
+type RedisProviderConfig struct {
+	URL         string        `yaml:"url"`
+	KeyTemplate string        `yaml:"keyTemplate"`
+	Timeout     time.Duration `yaml:"timeout"`
+	PoolSize    int           `yaml:"poolSize"`
+}
+
+// DecisionConfig is how a request is keyed and which decisions it may be routed on
+type DecisionConfig struct {
+	KeyTemplate                 string        `yaml:"keyTemplate"`
+	Format                      string        `yaml:"format"`
+	Trailer                     string        `yaml:"trailer"`
+	EmptyPreferredSvcNoDecision bool          `yaml:"emptyPreferredSvcNoDecision"`
+	AllowedUpstreamHosts        []string      `yaml:"allowedUpstreamHosts"`
+	DisallowedUpstreamAction    string        `yaml:"disallowedUpstreamAction"`
+	SourceWindow                time.Duration `yaml:"sourceWindow"`
+	Token                       TokenConfig   `yaml:"token"`
+}
+
+// TokenConfig is the signed decision token emitted along with the decision header
+type TokenConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Header  string `yaml:"header"`
+	Key     string `yaml:"key"`
+}
+
+// MutationConfig is how a decision is applied to the request
+type MutationConfig struct {
+	RolloutPercent             int  `yaml:"rolloutPercent"`
+	ClearRouteCache            bool `yaml:"clearRouteCache"`
+	HostRewrite                bool `yaml:"hostRewrite"`
+	HostRewriteClearRouteCache bool `yaml:"hostRewriteClearRouteCache"`
+	WarnBytes                  int  `yaml:"warnBytes"`
+}
+
+// CacheConfig is how decisions from the external service are cached
+type CacheConfig struct {
+	TTL           time.Duration `yaml:"ttl"`
+	TTLJitter     int           `yaml:"ttlJitter"`
+	Size          int           `yaml:"size"`
+	WarmFile      string        `yaml:"warmFile"`
+	WarmTTL       time.Duration `yaml:"warmTTL"`
+	HeaderEnabled bool          `yaml:"headerEnabled"`
+	Header        string        `yaml:"header"`
+}
+
+// HeadersConfig are the names of the request headers the processor reads and writes, and whether names are lowercased
+type HeadersConfig struct {
+	Lowercase          bool   `yaml:"lowercase"`
+	CurrentRoute       string `yaml:"currentRoute"`
+	DecisionKey        string `yaml:"decisionKey"`
+	Tenant             string `yaml:"tenant"`
+	Correlation        string `yaml:"correlation"`
+	PeerAddress        string `yaml:"peerAddress"`
+	WeightedRoll       string `yaml:"weightedRoll"`
+	LegacyPreferredSvc string `yaml:"legacyPreferredSvc"`
+}
+
+// DeprecationConfig is how clients still using the legacy preferred svc header are told to migrate
+type DeprecationConfig struct {
+	Enabled bool      `yaml:"enabled"`
+	Date    time.Time `yaml:"date"`
+	Warning string    `yaml:"warning"`
+}
+
+// RequiredHeaderConfig is the header every request must carry
+type RequiredHeaderConfig struct {
+	Name   string `yaml:"name"`
+	Status int    `yaml:"status"`
+}
+
+// RequestStartConfig is the header stamped with the time the request phase started
+type RequestStartConfig struct {
+	Header string `yaml:"header"`
+	Format string `yaml:"format"`
+}
+
+// DeniedServicesConfig are the preferred svc values whose requests are rejected
+type DeniedServicesConfig struct {
+	Services []string `yaml:"services"`
+	Status   int      `yaml:"status"`
+	Detail   string   `yaml:"detail"`
+}
+
+// ProblemConfig is the problem body rejected requests are answered with
+type ProblemConfig struct {
+	Type  string `yaml:"type"`
+	Title string `yaml:"title"`
+}
+
+// CircuitBreakerConfig is when calls to the decision server are stopped and what happens meanwhile
+type CircuitBreakerConfig struct {
+	Threshold  int           `yaml:"threshold"`
+	Cooldown   time.Duration `yaml:"cooldown"`
+	OpenAction string        `yaml:"openAction"`
+	RetryAfter time.Duration `yaml:"retryAfter"`
+}
+
+// ProbeConfig is how the reachability of the decision server is probed
+type ProbeConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// HealthCheckConfig is what the grpc health check reports
+type HealthCheckConfig struct {
+	Dependency  bool `yaml:"dependency"`
+	Diagnostics bool `yaml:"diagnostics"`
+}
+
+// SlowStartConfig relaxes the call limits while a newly reachable decision server warms up
+type SlowStartConfig struct {
+	Window  time.Duration `yaml:"window"`
+	Timeout time.Duration `yaml:"timeout"`
+	Retries int           `yaml:"retries"`
+}
+
+// WebSocketConfig is how WebSocket upgrades without a preferred svc are routed
+type WebSocketConfig struct {
+	Strategy      string   `yaml:"strategy"`
+	Services      []string `yaml:"services"`
+	SessionHeader string   `yaml:"sessionHeader"`
+}
+
+// BodyConfig is how request bodies are handled and decided on
+type BodyConfig struct {
+	ProcessingMode   string `yaml:"processingMode"`
+	MaxBufferedBytes int    `yaml:"maxBufferedBytes"`
+	DecisionPath     string `yaml:"decisionPath"`
+}
+
+// AnnotateConfig is how the decision is recorded in JSON response bodies
+type AnnotateConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Field    string `yaml:"field"`
+	MaxBytes int    `yaml:"maxBytes"`
+}
+
+// PathNormalizationConfig is how the :path used for decisions is normalized
+type PathNormalizationConfig struct {
+	Transforms []string `yaml:"transforms"`
+	WriteBack  bool     `yaml:"writeBack"`
+}
+
+// DynamicMetadataConfig is the dynamic metadata the decision is emitted as
+type DynamicMetadataConfig struct {
+	Namespace     string          `yaml:"namespace"`
+	Fields        []MetadataField `yaml:"fields"`
+	TenantHeader  string          `yaml:"tenantHeader"`
+	MaxValueBytes int             `yaml:"maxValueBytes"`
+}
+
+// TenantServersConfig is the file mapping tenants to their own decision server
+type TenantServersConfig struct {
+	File          string        `yaml:"file"`
+	CheckInterval time.Duration `yaml:"checkInterval"`
+}
+
+// StreamConfig is how the ext_proc stream with Envoy is handled
+type StreamConfig struct {
+	SkipUnhandledPhases   bool          `yaml:"skipUnhandledPhases"`
+	OnUnknownRequestType  string        `yaml:"onUnknownRequestType"`
+	CancelDecisionOnClose bool          `yaml:"cancelDecisionOnClose"`
+	SendRetries           int           `yaml:"sendRetries"`
+	SendRetryBackoff      time.Duration `yaml:"sendRetryBackoff"`
+}
+
+// AuditConfig is where applied decisions are published for auditing
+type AuditConfig struct {
+	KafkaBrokers []string `yaml:"kafkaBrokers"`
+	KafkaTopic   string   `yaml:"kafkaTopic"`
+	BufferSize   int      `yaml:"bufferSize"`
+	BatchSize    int      `yaml:"batchSize"`
+}
+
+// GrpcConfig is how the ext_proc grpc server is served
+type GrpcConfig struct {
+	Port                 string        `yaml:"port"`
+	BindAddress          string        `yaml:"bindAddress"`
+	MaxConcurrentStreams int           `yaml:"maxConcurrentStreams"`
+	KeepaliveTime        time.Duration `yaml:"keepaliveTime"`
+	KeepaliveTimeout     time.Duration `yaml:"keepaliveTimeout"`
+	KeepaliveMinTime     time.Duration `yaml:"keepaliveMinTime"`
+	TLS                  TLSConfig     `yaml:"tls"`
+}
+
+// TLSConfig are the PEM files the ext_proc grpc server is served with, see GrpcTLSCertFile and GrpcTLSCAFile
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	CAFile   string `yaml:"caFile"`
+}
+
+// FromEnv is the configuration currently in effect, i.e. the environment and the defaults
+func FromEnv() *Config {
+	return &Config{
+		LogLevel: LogLevel,
+		LogLevels: LogLevelsConfig{
+			Processor:      ProcessorLogLevel,
+			Server:         ServerLogLevel,
+			DecisionClient: DecisionClientLogLevel,
+		},
+		DecisionServer: DecisionServerConfig{
+			URL:                     RoutingDecisionServer,
+			Timeout:                 RoutingDecisionTimeout,
+			Retries:                 RoutingDecisionRetries,
+			RetryBackoff:            RoutingDecisionRetryBackoff,
+			RetryMaxBackoff:         RoutingDecisionRetryMaxBackoff,
+			Method:                  DecisionRequestMethod,
+			ContentType:             DecisionContentType,
+			ForwardHeaders:          DecisionForwardHeaders,
+			RequestMaxBodyBytes:     DecisionRequestMaxBodyBytes,
+			CAFile:                  DecisionServerCAFile,
+			TLSSessionMaxAge:        DecisionServerTLSSessionMaxAge,
+			Pool:                    DecisionServerPool,
+			Pools:                   DecisionServerPools,
+			BatchWindow:             DecisionBatchWindow,
+			BatchMaxSize:            DecisionBatchMaxSize,
+			LenientDecode:           LenientDecisionDecode,
+			ContradictoryResolution: ContradictoryDecisionResolution,
+			BodyLog: BodyLogConfig{
+				SampleRate: DecisionBodyLogSampleRate,
+				MaxBytes:   DecisionBodyLogMaxBytes,
+				Redact:     DecisionBodyLogRedact,
+			},
+		},
+		Provider: ProviderConfig{
+			Name:   DecisionProvider,
+			FanOut: DecisionProviderFanOut,
+			GRPC: GRPCProviderConfig{
+				Server: DecisionGRPCServer,
+				TLS:    DecisionGRPCTLS,
+			},
+			Redis: RedisProviderConfig{
+				URL:         RedisURL,
+				KeyTemplate: RedisKeyTemplate,
+				Timeout:     RedisTimeout,
+				PoolSize:    RedisPoolSize,
+			},
+		},
+		Decision: DecisionConfig{
+			KeyTemplate:                 DecisionKeyTemplate,
+			Format:                      DecisionFormat,
+			Trailer:                     DecisionTrailer,
+			EmptyPreferredSvcNoDecision: EmptyPreferredSvcNoDecision,
+			AllowedUpstreamHosts:        AllowedUpstreamHosts,
+			DisallowedUpstreamAction:    DisallowedUpstreamAction,
+			SourceWindow:                DecisionSourceWindow,
+			Token: TokenConfig{
+				Enabled: DecisionTokenEnabled,
+				Header:  DecisionTokenHeader,
+				Key:     DecisionTokenKey,
+			},
+		},
+		Mutation: MutationConfig{
+			RolloutPercent:             MutationRolloutPercent,
+			ClearRouteCache:            ClearRouteCache,
+			HostRewrite:                HostRewrite,
+			HostRewriteClearRouteCache: HostRewriteClearRouteCache,
+			WarnBytes:                  HeaderMutationWarnBytes,
+		},
+		Cache: CacheConfig{
+			TTL:           RoutingDecisionCacheTTL,
+			TTLJitter:     RoutingDecisionCacheTTLJitter,
+			Size:          RoutingDecisionCacheSize,
+			WarmFile:      CacheWarmFile,
+			WarmTTL:       CacheWarmTTL,
+			HeaderEnabled: DecisionCacheHeaderEnabled,
+			Header:        DecisionCacheHeader,
+		},
+		Headers: HeadersConfig{
+			Lowercase:          LowercaseHeaders,
+			CurrentRoute:       CurrentRouteHeader,
+			DecisionKey:        DecisionKeyHeader,
+			Tenant:             TenantHeader,
+			Correlation:        CorrelationHeader,
+			PeerAddress:        PeerAddressHeader,
+			WeightedRoll:       WeightedRollHeader,
+			LegacyPreferredSvc: LegacyPreferredSvcHeader,
+		},
+		LegacyPreferredSvcDeprecation: DeprecationConfig{
+			Enabled: LegacyPreferredSvcDeprecation,
+			Date:    LegacyPreferredSvcDeprecationDate,
+			Warning: LegacyPreferredSvcWarning,
+		},
+		RequiredHeader: RequiredHeaderConfig{
+			Name:   RequiredHeader,
+			Status: RequiredHeaderStatus,
+		},
+		RequestStart: RequestStartConfig{
+			Header: RequestStartHeader,
+			Format: RequestStartFormat,
+		},
+		DeniedServices: DeniedServicesConfig{
+			Services: DeniedServices,
+			Status:   DeniedServiceStatus,
+			Detail:   DeniedServiceDetail,
+		},
+		Problem: ProblemConfig{
+			Type:  ProblemType,
+			Title: ProblemTitle,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Threshold:  CircuitBreakerThreshold,
+			Cooldown:   CircuitBreakerCooldown,
+			OpenAction: CircuitBreakerOpenAction,
+			RetryAfter: CircuitBreakerRetryAfter,
+		},
+		Probe: ProbeConfig{
+			Interval: ProbeInterval,
+			Timeout:  ProbeTimeout,
+		},
+		HealthCheck: HealthCheckConfig{
+			Dependency:  HealthCheckDependency,
+			Diagnostics: HealthCheckDiagnostics,
+		},
+		SlowStart: SlowStartConfig{
+			Window:  SlowStartWindow,
+			Timeout: SlowStartTimeout,
+			Retries: SlowStartRetries,
+		},
+		WebSocket: WebSocketConfig{
+			Strategy:      WebSocketStrategy,
+			Services:      WebSocketServices,
+			SessionHeader: WebSocketSessionHeader,
+		},
+		Body: BodyConfig{
+			ProcessingMode:   BodyProcessingMode,
+			MaxBufferedBytes: MaxBufferedBodyBytes,
+			DecisionPath:     BodyDecisionPath,
+		},
+		AnnotateResponseBody: AnnotateConfig{
+			Enabled:  AnnotateResponseBody,
+			Field:    AnnotateResponseBodyField,
+			MaxBytes: AnnotateResponseBodyMaxBytes,
+		},
+		PathNormalization: PathNormalizationConfig{
+			Transforms: PathNormalization,
+			WriteBack:  PathNormalizationWriteBack,
+		},
+		DynamicMetadata: DynamicMetadataConfig{
+			Namespace:     DynamicMetadataNamespace,
+			Fields:        DecisionMetadataFields,
+			TenantHeader:  DecisionMetadataTenantHeader,
+			MaxValueBytes: DecisionMetadataMaxValueBytes,
+		},
+		TenantServers: TenantServersConfig{
+			File:          TenantServersFile,
+			CheckInterval: TenantServersCheckInterval,
+		},
+		Stream: StreamConfig{
+			SkipUnhandledPhases:   SkipUnhandledPhases,
+			OnUnknownRequestType:  OnUnknownRequestType,
+			CancelDecisionOnClose: CancelDecisionOnStreamClose,
+			SendRetries:           SendRetries,
+			SendRetryBackoff:      SendRetryBackoff,
+		},
+		Audit: AuditConfig{
+			KafkaBrokers: AuditKafkaBrokers,
+			KafkaTopic:   AuditKafkaTopic,
+			BufferSize:   AuditBufferSize,
+			BatchSize:    AuditBatchSize,
+		},
+		Grpc: GrpcConfig{
+			Port:                 GrpcPort,
+			BindAddress:          GrpcBindAddress,
+			MaxConcurrentStreams: GrpcMaxConcurrentStreams,
+			KeepaliveTime:        GrpcKeepaliveTime,
+			KeepaliveTimeout:     GrpcKeepaliveTimeout,
+			KeepaliveMinTime:     GrpcKeepaliveMinTime,
+			TLS: TLSConfig{
+				CertFile: GrpcTLSCertFile,
+				KeyFile:  GrpcTLSKeyFile,
+				CAFile:   GrpcTLSCAFile,
+			},
+		},
+		DefaultDecision: DefaultRoutingDecision,
+		DebugResponses:  DebugResponses,
+		TracingEndpoint: TracingEndpoint,
+		AdminToken:      AdminToken,
+		MetricsLabels:   MetricsDecisionLabels,
+	}
+}
+
+// Apply makes the configuration the one in effect
+func (c *Config) Apply() {
+	LogLevel = c.LogLevel
+	ProcessorLogLevel = c.LogLevels.Processor
+	ServerLogLevel = c.LogLevels.Server
+	DecisionClientLogLevel = c.LogLevels.DecisionClient
+
+	RoutingDecisionServer = c.DecisionServer.URL
+	if c.DecisionServer.URL != "" {
+		// the file took precedence over an invalid ROUTING_DECISION_SERVER
+		routingDecisionServerErr = nil
+	}
+	RoutingDecisionTimeout = c.DecisionServer.Timeout
+	RoutingDecisionRetries = c.DecisionServer.Retries
+	RoutingDecisionRetryBackoff = c.DecisionServer.RetryBackoff
+	RoutingDecisionRetryMaxBackoff = c.DecisionServer.RetryMaxBackoff
+	DecisionRequestMethod = c.DecisionServer.Method
+	DecisionContentType = c.DecisionServer.ContentType
+	DecisionForwardHeaders = c.DecisionServer.ForwardHeaders
+	DecisionRequestMaxBodyBytes = c.DecisionServer.RequestMaxBodyBytes
+	DecisionServerCAFile = c.DecisionServer.CAFile
+	DecisionServerTLSSessionMaxAge = c.DecisionServer.TLSSessionMaxAge
+	DecisionServerPool = c.DecisionServer.Pool
+	DecisionServerPools = c.DecisionServer.Pools
+	DecisionBatchWindow = c.DecisionServer.BatchWindow
+	DecisionBatchMaxSize = c.DecisionServer.BatchMaxSize
+	LenientDecisionDecode = c.DecisionServer.LenientDecode
+	ContradictoryDecisionResolution = c.DecisionServer.ContradictoryResolution
+	DecisionBodyLogSampleRate = c.DecisionServer.BodyLog.SampleRate
+	DecisionBodyLogMaxBytes = c.DecisionServer.BodyLog.MaxBytes
+	DecisionBodyLogRedact = c.DecisionServer.BodyLog.Redact
+
+	DecisionProvider = c.Provider.Name
+	DecisionProviderFanOut = c.Provider.FanOut
+	DecisionGRPCServer = c.Provider.GRPC.Server
+	DecisionGRPCTLS = c.Provider.GRPC.TLS
+	RedisURL = c.Provider.Redis.URL
+	RedisKeyTemplate = c.Provider.Redis.KeyTemplate
+	RedisTimeout = c.Provider.Redis.Timeout
+	RedisPoolSize = c.Provider.Redis.PoolSize
+
+	DecisionKeyTemplate = c.Decision.KeyTemplate
+	DecisionFormat = c.Decision.Format
+	DecisionTrailer = c.Decision.Trailer
+	EmptyPreferredSvcNoDecision = c.Decision.EmptyPreferredSvcNoDecision
+	AllowedUpstreamHosts = c.Decision.AllowedUpstreamHosts
+	DisallowedUpstreamAction = c.Decision.DisallowedUpstreamAction
+	DecisionSourceWindow = c.Decision.SourceWindow
+	DecisionTokenEnabled = c.Decision.Token.Enabled
+	DecisionTokenHeader = c.Decision.Token.Header
+	DecisionTokenKey = c.Decision.Token.Key
+
+	MutationRolloutPercent = c.Mutation.RolloutPercent
+	ClearRouteCache = c.Mutation.ClearRouteCache
+	HostRewrite = c.Mutation.HostRewrite
+	HostRewriteClearRouteCache = c.Mutation.HostRewriteClearRouteCache
+	HeaderMutationWarnBytes = c.Mutation.WarnBytes
+
+	RoutingDecisionCacheTTL = c.Cache.TTL
+	RoutingDecisionCacheTTLJitter = c.Cache.TTLJitter
+	RoutingDecisionCacheSize = c.Cache.Size
+	CacheWarmFile = c.Cache.WarmFile
+	CacheWarmTTL = c.Cache.WarmTTL
+	DecisionCacheHeaderEnabled = c.Cache.HeaderEnabled
+	DecisionCacheHeader = c.Cache.Header
+
+	LowercaseHeaders = c.Headers.Lowercase
+	CurrentRouteHeader = c.Headers.CurrentRoute
+	DecisionKeyHeader = c.Headers.DecisionKey
+	TenantHeader = c.Headers.Tenant
+	CorrelationHeader = c.Headers.Correlation
+	PeerAddressHeader = c.Headers.PeerAddress
+	WeightedRollHeader = c.Headers.WeightedRoll
+	LegacyPreferredSvcHeader = c.Headers.LegacyPreferredSvc
+
+	LegacyPreferredSvcDeprecation = c.LegacyPreferredSvcDeprecation.Enabled
+	LegacyPreferredSvcDeprecationDate = c.LegacyPreferredSvcDeprecation.Date
+	LegacyPreferredSvcWarning = c.LegacyPreferredSvcDeprecation.Warning
+
+	RequiredHeader = c.RequiredHeader.Name
+	RequiredHeaderStatus = c.RequiredHeader.Status
+	RequestStartHeader = c.RequestStart.Header
+	RequestStartFormat = c.RequestStart.Format
+
+	DeniedServices = c.DeniedServices.Services
+	DeniedServiceStatus = c.DeniedServices.Status
+	DeniedServiceDetail = c.DeniedServices.Detail
+	ProblemType = c.Problem.Type
+	ProblemTitle = c.Problem.Title
+
+	CircuitBreakerThreshold = c.CircuitBreaker.Threshold
+	CircuitBreakerCooldown = c.CircuitBreaker.Cooldown
+	CircuitBreakerOpenAction = c.CircuitBreaker.OpenAction
+	CircuitBreakerRetryAfter = c.CircuitBreaker.RetryAfter
+
+	ProbeInterval = c.Probe.Interval
+	ProbeTimeout = c.Probe.Timeout
+	HealthCheckDependency = c.HealthCheck.Dependency
+	HealthCheckDiagnostics = c.HealthCheck.Diagnostics
+	SlowStartWindow = c.SlowStart.Window
+	SlowStartTimeout = c.SlowStart.Timeout
+	SlowStartRetries = c.SlowStart.Retries
+
+	WebSocketStrategy = c.WebSocket.Strategy
+	WebSocketServices = c.WebSocket.Services
+	WebSocketSessionHeader = c.WebSocket.SessionHeader
+
+	BodyProcessingMode = c.Body.ProcessingMode
+	MaxBufferedBodyBytes = c.Body.MaxBufferedBytes
+	BodyDecisionPath = c.Body.DecisionPath
+	AnnotateResponseBody = c.AnnotateResponseBody.Enabled
+	AnnotateResponseBodyField = c.AnnotateResponseBody.Field
+	AnnotateResponseBodyMaxBytes = c.AnnotateResponseBody.MaxBytes
+
+	PathNormalization = c.PathNormalization.Transforms
+	PathNormalizationWriteBack = c.PathNormalization.WriteBack
+
+	DynamicMetadataNamespace = c.DynamicMetadata.Namespace
+	DecisionMetadataFields = c.DynamicMetadata.Fields
+	DecisionMetadataTenantHeader = c.DynamicMetadata.TenantHeader
+	DecisionMetadataMaxValueBytes = c.DynamicMetadata.MaxValueBytes
+
+	TenantServersFile = c.TenantServers.File
+	TenantServersCheckInterval = c.TenantServers.CheckInterval
+
+	SkipUnhandledPhases = c.Stream.SkipUnhandledPhases
+	OnUnknownRequestType = c.Stream.OnUnknownRequestType
+	CancelDecisionOnStreamClose = c.Stream.CancelDecisionOnClose
+	SendRetries = c.Stream.SendRetries
+	SendRetryBackoff = c.Stream.SendRetryBackoff
+
+	AuditKafkaBrokers = c.Audit.KafkaBrokers
+	AuditKafkaTopic = c.Audit.KafkaTopic
+	AuditBufferSize = c.Audit.BufferSize
+	AuditBatchSize = c.Audit.BatchSize
+
+	GrpcPort = c.Grpc.Port
+	GrpcBindAddress = c.Grpc.BindAddress
+	GrpcMaxConcurrentStreams = c.Grpc.MaxConcurrentStreams
+	GrpcKeepaliveTime = c.Grpc.KeepaliveTime
+	GrpcKeepaliveTimeout = c.Grpc.KeepaliveTimeout
+	GrpcKeepaliveMinTime = c.Grpc.KeepaliveMinTime
+	GrpcTLSCertFile = c.Grpc.TLS.CertFile
+	GrpcTLSKeyFile = c.Grpc.TLS.KeyFile
+	GrpcTLSCAFile = c.Grpc.TLS.CAFile
+
+	DefaultRoutingDecision = c.DefaultDecision
+	DebugResponses = c.DebugResponses
+	TracingEndpoint = c.TracingEndpoint
+	AdminToken = c.AdminToken
+	MetricsDecisionLabels = c.MetricsLabels
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DecisionServerURLError reports a decision server which isn't a usable URL
+type DecisionServerURLError struct {
+	Value  string
+	Reason string
+}
+
+func (e *DecisionServerURLError) Error() string {
+	return fmt.Sprintf("decision server %q %s, expected an http or https URL such as http://decision:8080/decision", e.Value, e.Reason)
+}
+
+// ParseDecisionServer checks the decision server is an http or https URL. A value without a scheme, such as
+// localhost:9000, is taken to be plain http. An empty value means there is no decision server.
+func ParseDecisionServer(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return "", nil
+	}
+	normalized := v
+	if !strings.Contains(v, "://") {
+		normalized = "http://" + v
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return "", &DecisionServerURLError{Value: v, Reason: "is not a URL"}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", &DecisionServerURLError{Value: v, Reason: fmt.Sprintf("has the unsupported scheme %q", u.Scheme)}
+	}
+	if u.Host == "" {
+		return "", &DecisionServerURLError{Value: v, Reason: "has no host"}
+	}
+	return normalized, nil
+}
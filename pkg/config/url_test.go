@@ -0,0 +1,33 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestParseDecisionServer(t *testing.T) {
+	server, err := config.ParseDecisionServer("https://decision.example.com:8443/decision")
+	require.NoError(t, err)
+	require.Equal(t, "https://decision.example.com:8443/decision", server)
+
+	server, err = config.ParseDecisionServer("localhost:9000")
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:9000", server, "a missing scheme defaults to http")
+
+	server, err = config.ParseDecisionServer("")
+	require.NoError(t, err)
+	require.Empty(t, server, "no decision server is configured")
+}
+
+func TestParseDecisionServerInvalid(t *testing.T) {
+	for _, v := range []string{"ftp://decision:21", "http://", "http://decision:port"} {
+		_, err := config.ParseDecisionServer(v)
+		var urlErr *config.DecisionServerURLError
+		require.ErrorAs(t, err, &urlErr, v)
+		require.Equal(t, v, urlErr.Value)
+		require.ErrorContains(t, err, "expected an http or https URL")
+	}
+}
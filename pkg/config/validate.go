@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Validate checks the configuration in effect is usable so that the server fails at startup rather than on a request.
+// A config file is validated through the Config returned by Load, which reports the settings it set by their key.
+func Validate() error {
+	return FromEnv().Validate()
+}
+
+// Validate checks the configuration so that a config file can be checked before it replaces the running one. All the
+// invalid settings are reported together, named after their key when the config file set them or after their
+// environment variable otherwise.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Decision.Token.Enabled && c.Decision.Token.Key == "" {
+		errs = append(errs, fmt.Errorf("%s must be set when %s is true",
+			c.name("DECISION_TOKEN_KEY", "decision.token.key"), c.name("DECISION_TOKEN_ENABLED", "decision.token.enabled")))
+	}
+	if c.Decision.Token.Enabled && c.Decision.Token.Header == "" {
+		errs = append(errs, fmt.Errorf("%s must not be empty when %s is true",
+			c.name("DECISION_TOKEN_HEADER", "decision.token.header"), c.name("DECISION_TOKEN_ENABLED", "decision.token.enabled")))
+	}
+	if c.Mutation.RolloutPercent < 0 || c.Mutation.RolloutPercent > 100 {
+		errs = append(errs, fmt.Errorf("%s must be between 0 and 100, got %d", c.name("MUTATION_ROLLOUT_PERCENT", "mutation.rolloutPercent"), c.Mutation.RolloutPercent))
+	}
+	if err := validateMediaType(c.DecisionServer.ContentType); err != nil {
+		errs = append(errs, fmt.Errorf("%s %q is not a valid media type: %w", c.name("DECISION_CONTENT_TYPE", "decisionServer.contentType"), c.DecisionServer.ContentType, err))
+	}
+	for _, transform := range c.PathNormalization.Transforms {
+		switch transform {
+		case PathCollapseSlashes, PathResolveDots, PathTrimTrailingSlash, PathLowercase:
+		default:
+			errs = append(errs, fmt.Errorf("%s has an unknown transform %q", c.name("PATH_NORMALIZATION", "pathNormalization.transforms"), transform))
+		}
+	}
+	if c.RequestStart.Format != TimestampRFC3339 && c.RequestStart.Format != TimestampEpochMillis {
+		errs = append(errs, fmt.Errorf("%s must be %s or %s, got %q", c.name("REQUEST_START_FORMAT", "requestStart.format"), TimestampRFC3339, TimestampEpochMillis, c.RequestStart.Format))
+	}
+	if c.Decision.DisallowedUpstreamAction != DisallowedUpstreamFallback && c.Decision.DisallowedUpstreamAction != DisallowedUpstreamDeny {
+		errs = append(errs, fmt.Errorf("%s must be %s or %s, got %q", c.name("DISALLOWED_UPSTREAM_ACTION", "decision.disallowedUpstreamAction"), DisallowedUpstreamFallback, DisallowedUpstreamDeny, c.Decision.DisallowedUpstreamAction))
+	}
+	if r := c.DecisionServer.ContradictoryResolution; r != ContradictoryDecisionDeny && r != ContradictoryDecisionInvalid {
+		errs = append(errs, fmt.Errorf("%s must be %s or %s, got %q", c.name("CONTRADICTORY_DECISION_RESOLUTION", "decisionServer.contradictoryResolution"), ContradictoryDecisionDeny, ContradictoryDecisionInvalid, r))
+	}
+	if c.DecisionServer.Method != http.MethodGet && c.DecisionServer.Method != http.MethodPost {
+		errs = append(errs, fmt.Errorf("%s must be GET or POST, got %q", c.name("DECISION_REQUEST_METHOD", "decisionServer.method"), c.DecisionServer.Method))
+	}
+	if c.DecisionServer.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got %v", c.name("ROUTING_DECISION_TIMEOUT", "decisionServer.timeout"), c.DecisionServer.Timeout))
+	}
+	if c.DecisionServer.Retries < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got %d", c.name("ROUTING_DECISION_RETRIES", "decisionServer.retries"), c.DecisionServer.Retries))
+	}
+	if c.DecisionServer.Retries > 0 && c.DecisionServer.RetryBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive with retries, got %v", c.name("ROUTING_DECISION_RETRY_BACKOFF", "decisionServer.retryBackoff"), c.DecisionServer.RetryBackoff))
+	}
+	if c.DecisionServer.RetryMaxBackoff > 0 && c.DecisionServer.RetryMaxBackoff < c.DecisionServer.RetryBackoff {
+		errs = append(errs, fmt.Errorf("%s must be at least %s %v, got %v", c.name("ROUTING_DECISION_RETRY_MAX_BACKOFF", "decisionServer.retryMaxBackoff"),
+			c.name("ROUTING_DECISION_RETRY_BACKOFF", "decisionServer.retryBackoff"), c.DecisionServer.RetryBackoff, c.DecisionServer.RetryMaxBackoff))
+	}
+	if c.DecisionServer.BatchWindow < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got %v", c.name("DECISION_BATCH_WINDOW", "decisionServer.batchWindow"), c.DecisionServer.BatchWindow))
+	}
+	if c.Cache.TTL < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got %v", c.name("ROUTING_DECISION_CACHE_TTL", "cache.ttl"), c.Cache.TTL))
+	}
+	if c.Cache.WarmTTL < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got %v", c.name("CACHE_WARM_TTL", "cache.warmTTL"), c.Cache.WarmTTL))
+	}
+	if c.Cache.Size < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got %d", c.name("ROUTING_DECISION_CACHE_SIZE", "cache.size"), c.Cache.Size))
+	}
+	if c.Cache.HeaderEnabled && c.Cache.Header == "" {
+		errs = append(errs, fmt.Errorf("%s must not be empty when %s is true",
+			c.name("DECISION_CACHE_HEADER", "cache.header"), c.name("DECISION_CACHE_HEADER_ENABLED", "cache.headerEnabled")))
+	}
+	// the other headers are optional, an empty name disables them
+	for _, h := range []struct{ name, value string }{
+		{c.name("DECISION_KEY_HEADER", "headers.decisionKey"), c.Headers.DecisionKey},
+		{c.name("TENANT_HEADER", "headers.tenant"), c.Headers.Tenant},
+		{c.name("WEIGHTED_ROLL_HEADER", "headers.weightedRoll"), c.Headers.WeightedRoll},
+	} {
+		if h.value == "" {
+			errs = append(errs, fmt.Errorf("%s must not be empty", h.name))
+		}
+	}
+	if c.CircuitBreaker.Threshold < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got %d", c.name("CIRCUIT_BREAKER_THRESHOLD", "circuitBreaker.threshold"), c.CircuitBreaker.Threshold))
+	}
+	if c.CircuitBreaker.Threshold > 0 && c.CircuitBreaker.Cooldown <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive with a threshold, got %v", c.name("CIRCUIT_BREAKER_COOLDOWN", "circuitBreaker.cooldown"), c.CircuitBreaker.Cooldown))
+	}
+	if c.CircuitBreaker.OpenAction != CircuitBreakerOpenFallback && c.CircuitBreaker.OpenAction != CircuitBreakerOpenReject {
+		errs = append(errs, fmt.Errorf("%s must be %s or %s, got %q", c.name("CIRCUIT_BREAKER_OPEN_ACTION", "circuitBreaker.openAction"), CircuitBreakerOpenFallback, CircuitBreakerOpenReject, c.CircuitBreaker.OpenAction))
+	}
+	if rate := c.DecisionServer.BodyLog.SampleRate; rate < 0 || rate > 1 {
+		errs = append(errs, fmt.Errorf("%s must be between 0 and 1, got %v", c.name("DECISION_BODY_LOG_SAMPLE_RATE", "decisionServer.bodyLog.sampleRate"), rate))
+	}
+	if c.DeniedServices.Status < 400 || c.DeniedServices.Status > 599 {
+		errs = append(errs, fmt.Errorf("%s must be a 4xx or 5xx status, got %d", c.name("DENIED_SERVICE_STATUS", "deniedServices.status"), c.DeniedServices.Status))
+	}
+	if c.Cache.TTLJitter < 0 || c.Cache.TTLJitter > 100 {
+		errs = append(errs, fmt.Errorf("%s must be between 0 and 100, got %d", c.name("ROUTING_DECISION_CACHE_TTL_JITTER", "cache.ttlJitter"), c.Cache.TTLJitter))
+	}
+	if c.RequiredHeader.Status < 400 || c.RequiredHeader.Status > 599 {
+		errs = append(errs, fmt.Errorf("%s must be a 4xx or 5xx status, got %d", c.name("REQUIRED_HEADER_STATUS", "requiredHeader.status"), c.RequiredHeader.Status))
+	}
+	if c.DecisionServer.BatchMaxSize < 1 {
+		errs = append(errs, fmt.Errorf("%s must be at least 1, got %d", c.name("DECISION_BATCH_MAX_SIZE", "decisionServer.batchMaxSize"), c.DecisionServer.BatchMaxSize))
+	}
+	if port, err := strconv.Atoi(c.Grpc.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("%s must be a port between 1 and 65535, got %q", c.name("GRPC_PORT", "grpc.port"), c.Grpc.Port))
+	}
+	if c.Grpc.MaxConcurrentStreams < 1 {
+		errs = append(errs, fmt.Errorf("%s must be at least 1, got %d", c.name("GRPC_MAX_CONCURRENT_STREAMS", "grpc.maxConcurrentStreams"), c.Grpc.MaxConcurrentStreams))
+	}
+	if c.Grpc.KeepaliveTime > 0 && c.Grpc.KeepaliveTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive with a %s, got %v",
+			c.name("GRPC_KEEPALIVE_TIMEOUT", "grpc.keepaliveTimeout"), c.name("GRPC_KEEPALIVE_TIME", "grpc.keepaliveTime"), c.Grpc.KeepaliveTimeout))
+	}
+	certFile, keyFile := c.name("GRPC_TLS_CERT_FILE", "grpc.tls.certFile"), c.name("GRPC_TLS_KEY_FILE", "grpc.tls.keyFile")
+	if (c.Grpc.TLS.CertFile == "") != (c.Grpc.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("%s and %s must be set together", certFile, keyFile))
+	}
+	if c.Grpc.TLS.CAFile != "" && c.Grpc.TLS.CertFile == "" {
+		errs = append(errs, fmt.Errorf("%s and %s must be set along with %s", certFile, keyFile, c.name("GRPC_TLS_CA_FILE", "grpc.tls.caFile")))
+	}
+	if len(c.Audit.KafkaBrokers) > 0 && c.Audit.KafkaTopic == "" {
+		errs = append(errs, fmt.Errorf("%s must be set along with %s", c.name("AUDIT_KAFKA_TOPIC", "audit.kafkaTopic"), c.name("AUDIT_KAFKA_BROKERS", "audit.kafkaBrokers")))
+	}
+	if c.Audit.BufferSize < 1 {
+		errs = append(errs, fmt.Errorf("%s must be at least 1, got %d", c.name("AUDIT_BUFFER_SIZE", "audit.bufferSize"), c.Audit.BufferSize))
+	}
+	if c.Body.ProcessingMode != BodyProcessingBuffered && c.Body.ProcessingMode != BodyProcessingStreamed {
+		errs = append(errs, fmt.Errorf("%s must be %s or %s, got %q", c.name("BODY_PROCESSING_MODE", "body.processingMode"), BodyProcessingBuffered, BodyProcessingStreamed, c.Body.ProcessingMode))
+	}
+	if c.WebSocket.Strategy != WebSocketStrategyDecide && c.WebSocket.Strategy != WebSocketStrategySticky {
+		errs = append(errs, fmt.Errorf("%s must be %s or %s, got %q", c.name("WEBSOCKET_STRATEGY", "webSocket.strategy"), WebSocketStrategyDecide, WebSocketStrategySticky, c.WebSocket.Strategy))
+	}
+	if c.WebSocket.Strategy == WebSocketStrategySticky && len(c.WebSocket.Services) == 0 {
+		errs = append(errs, fmt.Errorf("%s must be set with the sticky %s", c.name("WEBSOCKET_SERVICES", "webSocket.services"), c.name("WEBSOCKET_STRATEGY", "webSocket.strategy")))
+	}
+	if c.Body.MaxBufferedBytes < 1 {
+		errs = append(errs, fmt.Errorf("%s must be at least 1, got %d", c.name("MAX_BUFFERED_BODY_BYTES", "body.maxBufferedBytes"), c.Body.MaxBufferedBytes))
+	}
+	if c.DecisionServer.Pool.MaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("%s must not be negative, got %d", c.name("DECISION_SERVER_MAX_IDLE_CONNS", "decisionServer.pool.maxIdleConns"), c.DecisionServer.Pool.MaxIdleConns))
+	}
+	for _, key := range slices.Sorted(maps.Keys(c.DecisionServer.Pools)) {
+		if c.DecisionServer.Pools[key].MaxIdleConns < 0 {
+			errs = append(errs, fmt.Errorf("%s pool %s must not have a negative max idle conns", c.name("DECISION_SERVER_POOLS", "decisionServer.pools"), key))
+		}
+	}
+	metadataFields := c.name("DECISION_METADATA_FIELDS", "dynamicMetadata.fields")
+	for _, f := range c.DynamicMetadata.Fields {
+		switch f.Field {
+		case MetadataFieldDecision, MetadataFieldSource, MetadataFieldTenant, MetadataFieldLatency:
+		default:
+			errs = append(errs, fmt.Errorf("%s has an unknown field %q", metadataFields, f.Field))
+		}
+		if f.Name == "" {
+			errs = append(errs, fmt.Errorf("%s field %q has an empty name", metadataFields, f.Field))
+		}
+	}
+	// the environment variables which couldn't be parsed are only in effect when the config file doesn't replace them
+	deprecationDate := c.name("LEGACY_PREFERRED_SVC_DEPRECATION_DATE", "legacyPreferredSvcDeprecation.date")
+	if legacyPreferredSvcDeprecationDateErr != nil && !c.fileKeys["legacyPreferredSvcDeprecation.date"] {
+		errs = append(errs, fmt.Errorf("%s is invalid: %w", deprecationDate, legacyPreferredSvcDeprecationDateErr))
+	} else if c.LegacyPreferredSvcDeprecation.Enabled && c.LegacyPreferredSvcDeprecation.Date.IsZero() {
+		errs = append(errs, fmt.Errorf("%s must be set when %s is true", deprecationDate, c.name("LEGACY_PREFERRED_SVC_DEPRECATION", "legacyPreferredSvcDeprecation.enabled")))
+	}
+	if routingDecisionServerErr != nil && c.DecisionServer.URL == "" {
+		// an invalid ROUTING_DECISION_SERVER is only in effect when the config doesn't set a URL, see Load
+		errs = append(errs, fmt.Errorf("ROUTING_DECISION_SERVER is invalid: %w", routingDecisionServerErr))
+	}
+	if decisionServerPoolsErr != nil {
+		// the pools of the config file are added to those of the environment, the invalid ones stay missing
+		errs = append(errs, fmt.Errorf("DECISION_SERVER_POOLS is invalid: %w", decisionServerPoolsErr))
+	}
+	if decisionMetadataFieldsErr != nil && !c.fileKeys["dynamicMetadata.fields"] {
+		errs = append(errs, fmt.Errorf("DECISION_METADATA_FIELDS is invalid: %w", decisionMetadataFieldsErr))
+	}
+	return errors.Join(errs...)
+}
+
+// name is how a setting is reported, by its key when the config file set it or by its environment variable otherwise
+func (c *Config) name(env, key string) string {
+	if c.fileKeys[key] {
+		return key
+	}
+	return env
+}
+
+// validateMediaType checks the value is a type/subtype media type with well-formed parameters
+func validateMediaType(v string) error {
+	mediaType, _, err := mime.ParseMediaType(v)
+	if err != nil {
+		return err
+	}
+	if typ, subtype, ok := strings.Cut(mediaType, "/"); !ok || typ == "" || subtype == "" {
+		return errors.New("expected type/subtype")
+	}
+	return nil
+}
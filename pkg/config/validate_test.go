@@ -0,0 +1,216 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// setConfig overrides a config value for the duration of the test
+func setConfig[T any](t *testing.T, v *T, value T) {
+	prev := *v
+	*v = value
+	t.Cleanup(func() { *v = prev })
+}
+
+func TestValidateDecisionTokenRequiresKey(t *testing.T) {
+	setConfig(t, &config.DecisionTokenEnabled, true)
+	setConfig(t, &config.DecisionTokenKey, "")
+	require.ErrorContains(t, config.Validate(), "DECISION_TOKEN_KEY")
+
+	setConfig(t, &config.DecisionTokenKey, "secret")
+	require.NoError(t, config.Validate())
+}
+
+func TestValidateDefaults(t *testing.T) {
+	require.NoError(t, config.Validate())
+}
+
+func TestParseTransportPools(t *testing.T) {
+	pools, err := config.ParseTransportPools("http://Decision-A:8080/decision=32/90s, https://decision-b=0/1s")
+	require.NoError(t, err)
+	require.Equal(t, map[string]config.TransportPool{
+		"http://decision-a:8080": {MaxIdleConns: 32, IdleConnTimeout: 90 * time.Second},
+		"https://decision-b":     {MaxIdleConns: 0, IdleConnTimeout: time.Second},
+	}, pools)
+
+	for _, v := range []string{"http://a", "decision-a=1/1s", "http://a=x/1s", "http://a=1/soon", "http://a=1"} {
+		_, err := config.ParseTransportPools(v)
+		require.Error(t, err, "%q should not parse", v)
+	}
+}
+
+func TestValidateDecisionContentType(t *testing.T) {
+	setConfig(t, &config.DecisionContentType, "application/vnd.acme+json; charset=utf-8")
+	require.NoError(t, config.Validate())
+
+	for _, v := range []string{"", "json", "application/json; charset"} {
+		setConfig(t, &config.DecisionContentType, v)
+		require.ErrorContains(t, config.Validate(), "DECISION_CONTENT_TYPE", "%q should be rejected", v)
+	}
+}
+
+func TestValidatePathNormalization(t *testing.T) {
+	setConfig(t, &config.PathNormalization, []string{config.PathCollapseSlashes, config.PathLowercase})
+	require.NoError(t, config.Validate())
+
+	setConfig(t, &config.PathNormalization, []string{"uppercase"})
+	require.ErrorContains(t, config.Validate(), "PATH_NORMALIZATION")
+}
+
+func TestValidateDecisionRequestMethod(t *testing.T) {
+	setConfig(t, &config.DecisionRequestMethod, "PUT")
+	require.ErrorContains(t, config.Validate(), "DECISION_REQUEST_METHOD")
+
+	setConfig(t, &config.DecisionRequestMethod, "POST")
+	require.NoError(t, config.Validate())
+}
+
+func TestParseMetadataFields(t *testing.T) {
+	fields, err := config.ParseMetadataFields("decision=routing_decision, source")
+	require.NoError(t, err)
+	require.Equal(t, []config.MetadataField{
+		{Field: config.MetadataFieldDecision, Name: "routing_decision"},
+		{Field: config.MetadataFieldSource, Name: config.MetadataFieldSource},
+	}, fields)
+
+	fields, err = config.ParseMetadataFields("")
+	require.NoError(t, err)
+	require.Len(t, fields, 4)
+
+	_, err = config.ParseMetadataFields("decision,region")
+	require.ErrorContains(t, err, `unknown metadata field "region"`)
+	_, err = config.ParseMetadataFields("decision=")
+	require.ErrorContains(t, err, "empty name")
+}
+
+func TestValidateCircuitBreakerOpenAction(t *testing.T) {
+	setConfig(t, &config.CircuitBreakerOpenAction, "retry")
+	require.ErrorContains(t, config.Validate(), "CIRCUIT_BREAKER_OPEN_ACTION")
+
+	setConfig(t, &config.CircuitBreakerOpenAction, config.CircuitBreakerOpenReject)
+	require.NoError(t, config.Validate())
+}
+
+func TestValidateDecisionBodyLogSampleRate(t *testing.T) {
+	setConfig(t, &config.DecisionBodyLogSampleRate, 1.5)
+	require.ErrorContains(t, config.Validate(), "DECISION_BODY_LOG_SAMPLE_RATE")
+
+	setConfig(t, &config.DecisionBodyLogSampleRate, 0.01)
+	require.NoError(t, config.Validate())
+}
+
+func TestValidateLegacyPreferredSvcDeprecationDate(t *testing.T) {
+	setConfig(t, &config.LegacyPreferredSvcDeprecation, true)
+	setConfig(t, &config.LegacyPreferredSvcDeprecationDate, time.Time{})
+	require.ErrorContains(t, config.Validate(), "LEGACY_PREFERRED_SVC_DEPRECATION_DATE must be set")
+
+	setConfig(t, &config.LegacyPreferredSvcDeprecationDate, time.Date(2026, time.June, 30, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, config.Validate())
+}
+
+func TestValidateDeniedServiceStatus(t *testing.T) {
+	setConfig(t, &config.DeniedServiceStatus, 200)
+	require.ErrorContains(t, config.Validate(), "DENIED_SERVICE_STATUS")
+
+	setConfig(t, &config.DeniedServiceStatus, 451)
+	require.NoError(t, config.Validate())
+}
+
+func TestValidateRoutingDecisionCacheTTLJitter(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionCacheTTLJitter, 150)
+	require.ErrorContains(t, config.Validate(), "ROUTING_DECISION_CACHE_TTL_JITTER")
+
+	setConfig(t, &config.RoutingDecisionCacheTTLJitter, 10)
+	require.NoError(t, config.Validate())
+}
+
+func TestValidateRequiredHeaderStatus(t *testing.T) {
+	setConfig(t, &config.RequiredHeaderStatus, 302)
+	require.ErrorContains(t, config.Validate(), "REQUIRED_HEADER_STATUS")
+}
+
+func TestValidateBodyProcessingMode(t *testing.T) {
+	setConfig(t, &config.BodyProcessingMode, "chunked")
+	require.ErrorContains(t, config.Validate(), "BODY_PROCESSING_MODE")
+}
+
+func TestValidateStickyWebSocketNeedsServices(t *testing.T) {
+	setConfig(t, &config.WebSocketStrategy, config.WebSocketStrategySticky)
+	require.ErrorContains(t, config.Validate(), "WEBSOCKET_SERVICES")
+
+	setConfig(t, &config.WebSocketServices, []string{"ws-a"})
+	require.NoError(t, config.Validate())
+}
+
+func TestConfigValidateDefaults(t *testing.T) {
+	require.NoError(t, config.FromEnv().Validate())
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		modify func(c *config.Config)
+		err    string
+	}{
+		{"negative timeout", func(c *config.Config) { c.DecisionServer.Timeout = -time.Second }, "ROUTING_DECISION_TIMEOUT must not be negative"},
+		{"negative retries", func(c *config.Config) { c.DecisionServer.Retries = -1 }, "ROUTING_DECISION_RETRIES must not be negative"},
+		{"retries without backoff", func(c *config.Config) {
+			c.DecisionServer.Retries = 2
+			c.DecisionServer.RetryBackoff = 0
+		}, "ROUTING_DECISION_RETRY_BACKOFF must be positive"},
+		{"max backoff below backoff", func(c *config.Config) {
+			c.DecisionServer.RetryBackoff = time.Second
+			c.DecisionServer.RetryMaxBackoff = 100 * time.Millisecond
+		}, "ROUTING_DECISION_RETRY_MAX_BACKOFF must be at least"},
+		{"method", func(c *config.Config) { c.DecisionServer.Method = "PUT" }, "DECISION_REQUEST_METHOD must be GET or POST"},
+		{"content type", func(c *config.Config) { c.DecisionServer.ContentType = "json" }, "DECISION_CONTENT_TYPE"},
+		{"negative batch window", func(c *config.Config) { c.DecisionServer.BatchWindow = -time.Millisecond }, "DECISION_BATCH_WINDOW must not be negative"},
+		{"batch size", func(c *config.Config) { c.DecisionServer.BatchMaxSize = 0 }, "DECISION_BATCH_MAX_SIZE must be at least 1"},
+		{"negative cache TTL", func(c *config.Config) { c.Cache.TTL = -time.Second }, "ROUTING_DECISION_CACHE_TTL must not be negative"},
+		{"negative warm TTL", func(c *config.Config) { c.Cache.WarmTTL = -time.Second }, "CACHE_WARM_TTL must not be negative"},
+		{"cache jitter", func(c *config.Config) { c.Cache.TTLJitter = 101 }, "ROUTING_DECISION_CACHE_TTL_JITTER must be between 0 and 100"},
+		{"negative cache size", func(c *config.Config) { c.Cache.Size = -1 }, "ROUTING_DECISION_CACHE_SIZE must not be negative"},
+		{"empty cache header", func(c *config.Config) {
+			c.Cache.HeaderEnabled = true
+			c.Cache.Header = ""
+		}, "DECISION_CACHE_HEADER must not be empty"},
+		{"empty decision key header", func(c *config.Config) { c.Headers.DecisionKey = "" }, "DECISION_KEY_HEADER must not be empty"},
+		{"empty tenant header", func(c *config.Config) { c.Headers.Tenant = "" }, "TENANT_HEADER must not be empty"},
+		{"empty weighted roll header", func(c *config.Config) { c.Headers.WeightedRoll = "" }, "WEIGHTED_ROLL_HEADER must not be empty"},
+		{"denied service status", func(c *config.Config) { c.DeniedServices.Status = 302 }, "DENIED_SERVICE_STATUS must be a 4xx or 5xx status"},
+		{"negative breaker threshold", func(c *config.Config) { c.CircuitBreaker.Threshold = -1 }, "CIRCUIT_BREAKER_THRESHOLD must not be negative"},
+		{"breaker without cooldown", func(c *config.Config) {
+			c.CircuitBreaker.Threshold = 5
+			c.CircuitBreaker.Cooldown = 0
+		}, "CIRCUIT_BREAKER_COOLDOWN must be positive"},
+		{"breaker open action", func(c *config.Config) { c.CircuitBreaker.OpenAction = "retry" }, "CIRCUIT_BREAKER_OPEN_ACTION must be"},
+		{"grpc port", func(c *config.Config) { c.Grpc.Port = "grpc" }, "GRPC_PORT must be a port between 1 and 65535"},
+		{"grpc port out of range", func(c *config.Config) { c.Grpc.Port = "70000" }, "GRPC_PORT must be a port between 1 and 65535"},
+		{"max concurrent streams", func(c *config.Config) { c.Grpc.MaxConcurrentStreams = 0 }, "GRPC_MAX_CONCURRENT_STREAMS must be at least 1"},
+		{"keepalive without timeout", func(c *config.Config) {
+			c.Grpc.KeepaliveTime = time.Minute
+			c.Grpc.KeepaliveTimeout = 0
+		}, "GRPC_KEEPALIVE_TIMEOUT must be positive"},
+		{"TLS cert without key", func(c *config.Config) { c.Grpc.TLS.CertFile = "tls.crt" }, "GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE must be set together"},
+		{"TLS CA without cert", func(c *config.Config) { c.Grpc.TLS.CAFile = "ca.crt" }, "must be set along with GRPC_TLS_CA_FILE"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.FromEnv()
+			tt.modify(c)
+			require.ErrorContains(t, c.Validate(), tt.err)
+		})
+	}
+}
+
+func TestConfigValidateOptionalHeaders(t *testing.T) {
+	c := config.FromEnv()
+	c.Headers.CurrentRoute = ""
+	c.Headers.Correlation = ""
+	c.Headers.PeerAddress = ""
+	c.Headers.LegacyPreferredSvc = ""
+	require.NoError(t, c.Validate(), "an empty name disables an optional header")
+}
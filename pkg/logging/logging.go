@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Subsystem logger names which can be given their own level
+const (
+	Processor      = "processor"
+	Server         = "server"
+	DecisionClient = "decision-client"
+)
+
+// New builds the production logger. Each subsystem in subsystemLevels logs at its own level regardless of the
+// global level, all other loggers use the global level.
+func New(level string, subsystemLevels map[string]string) (*zap.Logger, error) {
+	global := zap.NewAtomicLevelAt(ParseLevel(level))
+	levels := make(map[string]zap.AtomicLevel, len(subsystemLevels))
+	for name, l := range subsystemLevels {
+		if l == "" {
+			continue
+		}
+		levels[name] = zap.NewAtomicLevelAt(ParseLevel(l))
+	}
+
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.EncoderConfig = zap.NewProductionEncoderConfig()
+	// the subsystem core decides what gets logged so let everything through here
+	zapConfig.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	zapConfig.OutputPaths = []string{"stdout"}
+	zapConfig.ErrorOutputPaths = []string{"stderr"}
+	return zapConfig.Build(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return NewSubsystemCore(c, global, levels)
+	}))
+}
+
+// ParseLevel returns the level by name defaulting to info
+func ParseLevel(level string) zapcore.Level {
+	l, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return zapcore.InfoLevel
+	}
+	return l
+}
+
+// subsystemCore filters entries by the level of the subsystem named by the logger
+type subsystemCore struct {
+	zapcore.Core
+	global zap.AtomicLevel
+	levels map[string]zap.AtomicLevel
+}
+
+// NewSubsystemCore wraps the core so that entries from a named subsystem logger are filtered by the subsystem level.
+// For nested names like processor.decision-client the innermost configured subsystem wins.
+func NewSubsystemCore(core zapcore.Core, global zap.AtomicLevel, levels map[string]zap.AtomicLevel) zapcore.Core {
+	return &subsystemCore{Core: core, global: global, levels: levels}
+}
+
+func (c *subsystemCore) levelFor(name string) zap.AtomicLevel {
+	parts := strings.Split(name, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if l, ok := c.levels[parts[i]]; ok {
+			return l
+		}
+	}
+	return c.global
+}
+
+func (c *subsystemCore) Enabled(l zapcore.Level) bool {
+	if c.global.Enabled(l) {
+		return true
+	}
+	for _, sl := range c.levels {
+		if sl.Enabled(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *subsystemCore) With(fields []zapcore.Field) zapcore.Core {
+	return &subsystemCore{Core: c.Core.With(fields), global: c.global, levels: c.levels}
+}
+
+func (c *subsystemCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levelFor(e.LoggerName).Enabled(e.Level) {
+		return ce
+	}
+	return c.Core.Check(e, ce)
+}
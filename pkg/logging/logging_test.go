@@ -0,0 +1,58 @@
+package logging_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/logging"
+)
+
+func newObservedLogger(global zapcore.Level, levels map[string]zapcore.Level) (*zap.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	atomicLevels := make(map[string]zap.AtomicLevel, len(levels))
+	for name, l := range levels {
+		atomicLevels[name] = zap.NewAtomicLevelAt(l)
+	}
+	return zap.New(logging.NewSubsystemCore(core, zap.NewAtomicLevelAt(global), atomicLevels)), logs
+}
+
+func TestSubsystemMoreVerboseThanGlobal(t *testing.T) {
+	log, logs := newObservedLogger(zapcore.InfoLevel, map[string]zapcore.Level{logging.DecisionClient: zapcore.DebugLevel})
+
+	processorLog := log.Named(logging.Processor)
+	processorLog.Debug("processor debug")
+	processorLog.Named(logging.DecisionClient).Debug("client debug")
+	log.Named(logging.Server).Debug("server debug")
+	log.Named(logging.Server).Info("server info")
+
+	var messages []string
+	for _, e := range logs.All() {
+		messages = append(messages, e.Message)
+	}
+	require.Equal(t, []string{"client debug", "server info"}, messages)
+}
+
+func TestSubsystemQuieterThanGlobal(t *testing.T) {
+	log, logs := newObservedLogger(zapcore.DebugLevel, map[string]zapcore.Level{logging.Server: zapcore.WarnLevel})
+
+	log.Named(logging.Server).Info("server info")
+	log.Named(logging.Server).With(zap.String("k", "v")).Warn("server warn")
+	log.Named(logging.Processor).Debug("processor debug")
+
+	var messages []string
+	for _, e := range logs.All() {
+		messages = append(messages, e.Message)
+	}
+	require.Equal(t, []string{"server warn", "processor debug"}, messages)
+}
+
+func TestParseLevel(t *testing.T) {
+	require.Equal(t, zapcore.DebugLevel, logging.ParseLevel("debug"))
+	require.Equal(t, zapcore.WarnLevel, logging.ParseLevel("warn"))
+	require.Equal(t, zapcore.InfoLevel, logging.ParseLevel(""))
+	require.Equal(t, zapcore.InfoLevel, logging.ParseLevel("chatty"))
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "ext_proc_routing_decision"
+
+// Registry holds every metric exported by the server
+var Registry = prometheus.NewRegistry()
+
+// HeaderMutationHeaders observes the number of headers set or removed (operation label) per response
+var HeaderMutationHeaders = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "header_mutation_headers",
+	Help:      "Number of headers set or removed by a header mutation.",
+	Buckets:   []float64{0, 1, 2, 4, 8, 16, 32, 64},
+}, []string{"operation"})
+
+// HeaderMutationBytes observes the byte size of the headers set or removed (operation label) per response
+var HeaderMutationBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "header_mutation_bytes",
+	Help:      "Byte size of the header names and values set or removed by a header mutation.",
+	Buckets:   prometheus.ExponentialBuckets(64, 4, 7),
+}, []string{"operation"})
+
+// Decisions counts decisions asked of the provider by outcome (success, failure, cancelled or breaker_open when the
+// request is rejected as the circuit breaker is open)
+var Decisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "decisions_total",
+	Help:      "Number of decisions asked of the decision provider by outcome.",
+}, []string{"outcome"})
+
+// MutationsSuppressed counts decisions that were made but not applied because the request is outside the mutation rollout
+var MutationsSuppressed = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "mutations_suppressed_total",
+	Help:      "Number of routing decisions not applied because the request is outside the mutation rollout.",
+})
+
+// Sends counts responses sent to Envoy by outcome (ok, retried when it took more than one attempt, or failed)
+var Sends = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "sends_total",
+	Help:      "Number of processing responses sent to Envoy by outcome.",
+}, []string{"outcome"})
+
+// CacheLookups counts decision cache lookups by result (hit or miss)
+var CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "cache_lookups_total",
+	Help:      "Number of decision cache lookups by result.",
+}, []string{"result"})
+
+// DecisionSources counts decisions by where they came from (header, cache, external or fallback)
+var DecisionSources = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "decision_sources_total",
+	Help:      "Number of routing decisions by the source they came from.",
+}, []string{"source"})
+
+// AppliedDecisions counts the decisions applied to requests by decision and the source it came from. Only decisions
+// allowed as a label have their own, everything else is counted as other.
+var AppliedDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "applied_decisions_total",
+	Help:      "Number of routing decisions applied to requests by decision and source.",
+}, []string{"decision", "source"})
+
+// DecisionServerCalls counts calls to the decision server by outcome (success, error or timeout)
+var DecisionServerCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "decision_server_calls_total",
+	Help:      "Number of calls to the decision server by outcome.",
+}, []string{"outcome"})
+
+// DecisionServerLatency observes how long calls to the decision server took, retries included, by outcome
+var DecisionServerLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "decision_server_latency_seconds",
+	Help:      "Latency of calls to the decision server including retries by outcome.",
+	Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+}, []string{"outcome"})
+
+// CircuitBreakerState is the state of the circuit breaker around the decision server (0 closed, 1 open, 2 half-open)
+var CircuitBreakerState = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "circuit_breaker_state",
+	Help:      "State of the circuit breaker around the decision server (0 closed, 1 open, 2 half-open).",
+})
+
+// AuditRecords counts audit records by outcome (published, failed, or dropped when the buffer is full)
+var AuditRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "audit_records_total",
+	Help:      "Number of decision audit records by outcome.",
+}, []string{"outcome"})
+
+func init() {
+	Registry.MustRegister(
+		HeaderMutationHeaders,
+		HeaderMutationBytes,
+		Decisions,
+		MutationsSuppressed,
+		Sends,
+		CacheLookups,
+		DecisionSources,
+		AppliedDecisions,
+		DecisionServerCalls,
+		DecisionServerLatency,
+		CircuitBreakerState,
+		AuditRecords,
+	)
+}
@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// annotateResponseBody records the decision which routed the request in the configured field of a JSON object response
+// body. Envoy is asked for the whole response body in one piece when annotating, see modeOverride, so bodies which
+// arrive in chunks, are larger than the configured limit or aren't a JSON object are passed through untouched.
+func (s *ProcessingServer) annotateResponseBody(conf *config.Config, st *streamState, body *ext_proc_v3.HttpBody) *ext_proc_v3.BodyResponse {
+	resp := &ext_proc_v3.BodyResponse{Response: &ext_proc_v3.CommonResponse{Status: ext_proc_v3.CommonResponse_CONTINUE}}
+	annotate := conf.AnnotateResponseBody
+	if !annotate.Enabled || st.decision == "" || !body.EndOfStream {
+		return resp
+	}
+	if len(body.Body) > annotate.MaxBytes {
+		s.logFor(st).Debug("response body is too large to annotate", zap.Int("size", len(body.Body)))
+		return resp
+	}
+	annotated, ok := appendJSONField(body.Body, annotate.Field, st.decision)
+	if !ok {
+		s.logFor(st).Debug("response body isn't a JSON object, leaving it as is")
+		return resp
+	}
+	resp.Response.BodyMutation = &ext_proc_v3.BodyMutation{
+		Mutation: &ext_proc_v3.BodyMutation_Body{Body: annotated},
+	}
+	return resp
+}
+
+// appendJSONField adds the field as the last member of the JSON object without touching the rest of it, reporting
+// false when the body isn't a JSON object
+func appendJSONField(body []byte, field, value string) ([]byte, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) < 2 || trimmed[0] != '{' || !json.Valid(trimmed) {
+		return nil, false
+	}
+	name, _ := json.Marshal(field) // nolint:errcheck
+	val, _ := json.Marshal(value)  // nolint:errcheck
+
+	inner := bytes.TrimSpace(trimmed[1 : len(trimmed)-1])
+	out := make([]byte, 0, len(trimmed)+len(name)+len(val)+2)
+	out = append(out, trimmed[:len(trimmed)-1]...)
+	if len(inner) > 0 {
+		out = append(out, ',')
+	}
+	out = append(out, name...)
+	out = append(out, ':')
+	out = append(out, val...)
+	return append(out, '}'), true
+}
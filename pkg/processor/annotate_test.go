@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"testing"
+
+	ext_proc_filter_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func responseBodyMessage(body string, endOfStream bool) *ext_proc_v3.ProcessingRequest {
+	return &ext_proc_v3.ProcessingRequest{
+		Request: &ext_proc_v3.ProcessingRequest_ResponseBody{
+			ResponseBody: &ext_proc_v3.HttpBody{Body: []byte(body), EndOfStream: endOfStream},
+		},
+	}
+}
+
+func TestAnnotateResponseBody(t *testing.T) {
+	setConfig(t, &config.AnnotateResponseBody, true)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	resp := h.send(stream, requestHeadersMessage("preferred-svc", "canary"))
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_BUFFERED, resp.GetModeOverride().GetResponseBodyMode())
+
+	resp = h.send(stream, responseHeadersMessage(":status", "200", "content-length", "13"))
+	require.Contains(t, resp.GetResponseHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders(), "content-length")
+
+	resp = h.send(stream, responseBodyMessage(`{"id": 1, "ok": true}`, true))
+	require.Equal(t, `{"id": 1, "ok": true,"routed_to":"canary"}`, string(resp.GetResponseBody().GetResponse().GetBodyMutation().GetBody()))
+}
+
+func TestAnnotateResponseBodyUntouched(t *testing.T) {
+	setConfig(t, &config.AnnotateResponseBody, true)
+	setConfig(t, &config.AnnotateResponseBodyMaxBytes, 32)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+	h.send(stream, requestHeadersMessage("preferred-svc", "canary"))
+
+	for _, body := range []string{`[1, 2]`, `not json`, `{"padding": "longer than the thirty two byte limit"}`} {
+		resp := h.send(stream, responseBodyMessage(body, true))
+		require.NotNil(t, resp.GetResponseBody())
+		require.Nil(t, resp.GetResponseBody().GetResponse().GetBodyMutation(), body)
+	}
+}
+
+func TestAnnotateResponseBodyDisabled(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+	h.send(stream, requestHeadersMessage("preferred-svc", "canary"))
+
+	resp := h.send(stream, responseHeadersMessage(":status", "200"))
+	require.NotContains(t, resp.GetResponseHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders(), "content-length")
+	resp = h.send(stream, responseBodyMessage(`{"id": 1}`, true))
+	require.Nil(t, resp.GetResponseBody().GetResponse().GetBodyMutation())
+}
+
+func TestAppendJSONField(t *testing.T) {
+	out, ok := appendJSONField([]byte(`{}`), "routed_to", "a")
+	require.True(t, ok)
+	require.Equal(t, `{"routed_to":"a"}`, string(out))
+
+	out, ok = appendJSONField([]byte(" {\"a\":1}\n"), "routed_to", `b"c`)
+	require.True(t, ok)
+	require.Equal(t, `{"a":1,"routed_to":"b\"c"}`, string(out))
+
+	_, ok = appendJSONField([]byte(`{"a":`), "routed_to", "a")
+	require.False(t, ok)
+}
@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// how long a batch of audit records may take to publish
+const auditPublishTimeout = 10 * time.Second
+
+// AuditRecord describes a routing decision which was applied to a request
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Decision  string    `json:"decision"`
+	Source    string    `json:"source"`
+	RequestID string    `json:"request_id,omitempty"`
+	Authority string    `json:"authority,omitempty"`
+	Path      string    `json:"path,omitempty"`
+}
+
+// auditProducer publishes audit records somewhere durable, such as a Kafka topic
+type auditProducer interface {
+	Publish(ctx context.Context, records []AuditRecord) error
+	Close() error
+}
+
+// auditSink publishes audit records in the background so auditing adds no latency to requests. Records which don't
+// fit in the buffer are dropped rather than holding up the request.
+type auditSink struct {
+	log       *zap.Logger
+	producer  auditProducer
+	batchSize int
+	records   chan AuditRecord
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newAuditSink(log *zap.Logger, producer auditProducer, bufferSize, batchSize int) *auditSink {
+	a := &auditSink{
+		log:       log,
+		producer:  producer,
+		batchSize: max(batchSize, 1),
+		records:   make(chan AuditRecord, bufferSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// enqueue buffers the record for publishing and reports whether it fit
+func (a *auditSink) enqueue(r AuditRecord) bool {
+	select {
+	case a.records <- r:
+		return true
+	default:
+		metrics.AuditRecords.WithLabelValues("dropped").Inc()
+		return false
+	}
+}
+
+func (a *auditSink) run() {
+	defer close(a.done)
+	for {
+		select {
+		case r := <-a.records:
+			a.publish(a.batch(r))
+		case <-a.stop:
+			// publish what was buffered before closing
+			for {
+				select {
+				case r := <-a.records:
+					a.publish(a.batch(r))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// batch adds the records already buffered to first, up to the batch size
+func (a *auditSink) batch(first AuditRecord) []AuditRecord {
+	batch := []AuditRecord{first}
+	for len(batch) < a.batchSize {
+		select {
+		case r := <-a.records:
+			batch = append(batch, r)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (a *auditSink) publish(records []AuditRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), auditPublishTimeout)
+	defer cancel()
+	if err := a.producer.Publish(ctx, records); err != nil {
+		a.log.Warn("failed to publish audit records", zap.Int("records", len(records)), zap.Error(err))
+		metrics.AuditRecords.WithLabelValues("failed").Add(float64(len(records)))
+		return
+	}
+	metrics.AuditRecords.WithLabelValues("published").Add(float64(len(records)))
+}
+
+// close publishes the buffered records and closes the producer. Records enqueued afterwards are never published.
+func (a *auditSink) close() error {
+	var err error
+	a.closeOnce.Do(func() {
+		close(a.stop)
+		<-a.done
+		err = a.producer.Close()
+	})
+	return err
+}
@@ -0,0 +1,96 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// fakeAuditProducer records what is published, blocking each publish until release is closed when it is set
+type fakeAuditProducer struct {
+	mu      sync.Mutex
+	records []AuditRecord
+	release chan struct{}
+	closed  bool
+}
+
+func (p *fakeAuditProducer) Publish(_ context.Context, records []AuditRecord) error {
+	if p.release != nil {
+		<-p.release
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = append(p.records, records...)
+	return nil
+}
+
+func (p *fakeAuditProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *fakeAuditProducer) published() []AuditRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]AuditRecord(nil), p.records...)
+}
+
+func TestAuditSinkPublishesAppliedDecisions(t *testing.T) {
+	producer := &fakeAuditProducer{}
+	s := New(zap.NewNop())
+	s.audit = newAuditSink(zap.NewNop(), producer, 16, 4)
+
+	h := newTestHarness(t, s)
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo", ":path", "/orders", "x-request-id", "req-1"))
+	require.NoError(t, s.Close())
+
+	records := producer.published()
+	require.Len(t, records, 1)
+	require.Equal(t, "foo", records[0].Decision)
+	require.Equal(t, sourceHeader, records[0].Source)
+	require.Equal(t, "/orders", records[0].Path)
+	require.Equal(t, "req-1", records[0].RequestID)
+	require.False(t, records[0].Time.IsZero())
+	require.True(t, producer.closed)
+}
+
+func TestAuditSinkDropsOnOverflow(t *testing.T) {
+	producer := &fakeAuditProducer{release: make(chan struct{})}
+	a := newAuditSink(zap.NewNop(), producer, 2, 1)
+	dropped := testutil.ToFloat64(metrics.AuditRecords.WithLabelValues("dropped"))
+
+	// the first record is taken by the publisher, which then blocks, and the next two fill the buffer
+	require.True(t, a.enqueue(AuditRecord{Decision: "a"}))
+	require.Eventually(t, func() bool { return len(a.records) == 0 }, time.Second, time.Millisecond)
+	require.True(t, a.enqueue(AuditRecord{Decision: "b"}))
+	require.True(t, a.enqueue(AuditRecord{Decision: "c"}))
+
+	done := make(chan struct{})
+	go func() {
+		require.False(t, a.enqueue(AuditRecord{Decision: "d"}))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue blocked on a full buffer")
+	}
+	require.Equal(t, dropped+1, testutil.ToFloat64(metrics.AuditRecords.WithLabelValues("dropped")))
+
+	close(producer.release)
+	require.NoError(t, a.close())
+	var decisions []string
+	for _, r := range producer.published() {
+		decisions = append(decisions, r.Decision)
+	}
+	require.Equal(t, []string{"a", "b", "c"}, decisions)
+}
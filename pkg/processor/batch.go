@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+)
+
+// batchPath is joined to the decision server URL for batched decision requests
+const batchPath = "batch"
+
+// batchRequest is the body of a batched decision request
+type batchRequest struct {
+	Requests []batchItem `json:"requests"`
+}
+
+// batchItem is a single request of a batch. The headers are serialized like the body of a POST decision request,
+// limited to the ones a GET decision request forwards when that's the configured method. The outbound headers are
+// the ones a single call would have sent, such as the peer address, as the batch call is shared by every request.
+type batchItem struct {
+	Key      string            `json:"key"`
+	Headers  json.RawMessage   `json:"headers"`
+	Outbound map[string]string `json:"outbound_headers,omitempty"`
+}
+
+// batchResponse holds a decision response, like the one returned for a single request, for every request of the
+// batch in the same order
+type batchResponse struct {
+	Responses []json.RawMessage `json:"responses"`
+}
+
+type batchResult struct {
+	response json.RawMessage
+	err      error
+}
+
+// pendingBatch collects the requests for a decision server until the batching window ends or it is full
+type pendingBatch struct {
+	// ctx carries the settings snapshot of the request which opened the batch, without its cancellation, see
+	// withRequestSettings. The batch call is made with those settings.
+	ctx     context.Context
+	items   []batchItem
+	results []chan batchResult
+	timer   *time.Timer
+}
+
+// decisionBatcher coalesces the decision requests made within a window into a single call per decision server
+type decisionBatcher struct {
+	window  time.Duration
+	maxSize int
+	// send makes the batched call, the responses are in the order of the items
+	send func(ctx context.Context, server string, items []batchItem) ([]json.RawMessage, error)
+
+	mu      sync.Mutex
+	pending map[string]*pendingBatch
+}
+
+func newDecisionBatcher(window time.Duration, maxSize int, send func(context.Context, string, []batchItem) ([]json.RawMessage, error)) *decisionBatcher {
+	return &decisionBatcher{
+		window:  window,
+		maxSize: maxSize,
+		send:    send,
+		pending: make(map[string]*pendingBatch),
+	}
+}
+
+// add queues the request on the pending batch for the server and waits for its response. The batch is sent once the
+// window ends or it is full, whichever comes first.
+func (b *decisionBatcher) add(ctx context.Context, server string, item batchItem) (json.RawMessage, error) {
+	result := make(chan batchResult, 1)
+
+	b.mu.Lock()
+	batch, ok := b.pending[server]
+	if !ok {
+		batch = &pendingBatch{ctx: context.WithoutCancel(ctx)}
+		b.pending[server] = batch
+		batch.timer = time.AfterFunc(b.window, func() { b.flush(server, batch) })
+	}
+	batch.items = append(batch.items, item)
+	batch.results = append(batch.results, result)
+	full := len(batch.items) >= b.maxSize
+	b.mu.Unlock()
+
+	if full {
+		batch.timer.Stop()
+		go b.flush(server, batch)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-result:
+		return r.response, r.err
+	}
+}
+
+// flush sends the batch unless it was already sent, e.g. when it filled up just as the window ended
+func (b *decisionBatcher) flush(server string, batch *pendingBatch) {
+	b.mu.Lock()
+	if b.pending[server] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, server)
+	b.mu.Unlock()
+
+	responses, err := b.send(batch.ctx, server, batch.items)
+	if err == nil && len(responses) != len(batch.items) {
+		err = fmt.Errorf("batched decision response has %d responses for %d requests", len(responses), len(batch.items))
+	}
+	for i, result := range batch.results {
+		if err != nil {
+			result <- batchResult{err: err}
+			continue
+		}
+		result <- batchResult{response: responses[i]}
+	}
+}
+
+// batchedDecision gets the decision through the batcher, decoding its response like the response to a single call
+func (s *ProcessingServer) batchedDecision(ctx context.Context, batcher *decisionBatcher, server, key string, in *ext_proc_v3.HttpHeaders) (string, error) {
+	conf := s.confFor(ctx)
+	if conf.DecisionServer.Method != http.MethodPost {
+		in = forwardedHeaders(conf, in)
+	}
+	headers, err := headersBody(conf, in)
+	if err != nil {
+		return "", err
+	}
+	var outbound map[string]string
+	if header := s.outboundHeaders(ctx, key); len(header) > 0 {
+		outbound = make(map[string]string, len(header))
+		for name := range header {
+			outbound[headerName(conf, name)] = header.Get(name)
+		}
+	}
+	resp, err := batcher.add(ctx, server, batchItem{Key: key, Headers: headers, Outbound: outbound})
+	if err != nil {
+		s.clientLogFor(ctx).Error("unable to get the batched routing decision from external service", zap.String("url", server), zap.Error(err))
+		return "", err
+	}
+	return s.decodeDecision(ctx, bytes.NewReader(resp))
+}
+
+// sendBatch makes a single call for the batch with the settings carried by ctx. It isn't tied to any one request so it
+// gets its own budget.
+func (s *ProcessingServer) sendBatch(ctx context.Context, server string, items []batchItem) ([]json.RawMessage, error) {
+	u, err := url.JoinPath(server, batchPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing decision server: %w", err)
+	}
+	body, err := json.Marshal(batchRequest{Requests: items})
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout := s.currentCallLimits(ctx).timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	s.clientLog.Debug("calling the external service with a batch", zap.String("url", u), zap.Int("requests", len(items)))
+	start := time.Now()
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	resp, err := s.doWithRetry(ctx, http.MethodPost, u, header, body)
+	if err != nil {
+		observeDecisionCall(start, err, 0)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	observeDecisionCall(start, nil, resp.StatusCode)
+
+	var respBody io.Reader = io.LimitReader(resp.Body, int64(len(items))*maxDecisionResponseBytes)
+	var sampled *bytes.Buffer
+	conf := s.confFor(ctx)
+	if sampleExchange(conf) {
+		sampled = &bytes.Buffer{}
+		respBody = io.TeeReader(respBody, sampled)
+		defer func() {
+			s.logExchange(conf, s.clientLog, http.MethodPost, u, header, body, resp.StatusCode, sampled.Bytes())
+		}()
+	}
+	if resp.StatusCode != http.StatusOK {
+		if sampled != nil {
+			io.Copy(io.Discard, respBody) // nolint:errcheck
+		}
+		return nil, fmt.Errorf("batched decision request failed with status %d", resp.StatusCode)
+	}
+
+	var decoded batchResponse
+	if err := json.NewDecoder(respBody).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("cannot decode the batched decision response: %w", err)
+	}
+	return decoded.Responses, nil
+}
@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// batchDecisionServer decides on the path of every request in a batch and records the size of the batches
+func batchDecisionServer(t *testing.T) (*httptest.Server, func() []int) {
+	var mu sync.Mutex
+	var sizes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/"+batchPath, r.URL.Path)
+		var req struct {
+			Requests []struct {
+				Headers map[string]any `json:"headers"`
+			} `json:"requests"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		mu.Lock()
+		sizes = append(sizes, len(req.Requests))
+		mu.Unlock()
+
+		var resp batchResponse
+		for _, item := range req.Requests {
+			resp.Responses = append(resp.Responses, json.RawMessage(`{"decision":"svc`+item.Headers[":path"].(string)+`"}`))
+		}
+		json.NewEncoder(w).Encode(resp) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), sizes...)
+	}
+}
+
+// decideConcurrently sends a request for each path on its own stream at once and returns the decisions by path
+func decideConcurrently(h *testHarness, paths ...string) map[string]string {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	decisions := map[string]string{}
+	for _, path := range paths {
+		stream := h.stream()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := h.send(stream, requestHeadersMessage(":path", path))
+			mu.Lock()
+			decisions[path] = decisionHeader(resp.GetRequestHeaders())
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return decisions
+}
+
+func TestDecisionBatching(t *testing.T) {
+	srv, sizes := batchDecisionServer(t)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.DecisionBatchWindow, 200*time.Millisecond)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	decisions := decideConcurrently(h, "/a", "/b", "/c")
+	require.Equal(t, map[string]string{"/a": "svc/a", "/b": "svc/b", "/c": "svc/c"}, decisions)
+	require.Equal(t, []int{3}, sizes())
+}
+
+func TestDecisionBatchSentWhenFull(t *testing.T) {
+	srv, sizes := batchDecisionServer(t)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.DecisionBatchWindow, time.Hour)
+	setConfig(t, &config.DecisionBatchMaxSize, 2)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	decisions := decideConcurrently(h, "/a", "/b")
+	require.Equal(t, map[string]string{"/a": "svc/a", "/b": "svc/b"}, decisions)
+	require.Equal(t, []int{2}, sizes())
+}
+
+func TestDecisionBatchingDisabled(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "single")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	require.Equal(t, map[string]string{"/a": "single", "/b": "single"}, decideConcurrently(h, "/a", "/b"))
+	require.EqualValues(t, 2, calls.Load())
+}
+
+func TestDecisionBatchForwardsLikeASingleCall(t *testing.T) {
+	items := make(chan batchItem, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req batchRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		items <- req.Requests[0]
+		w.Write([]byte(`{"responses":[{"decision":"foo"}]}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.DecisionBatchWindow, time.Millisecond)
+	setConfig(t, &config.DecisionForwardHeaders, []string{"x-tenant"})
+	setConfig(t, &config.DecisionKeyTemplate, "{x-tenant}")
+	setConfig(t, &config.DecisionBodyLogSampleRate, 1.0)
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	h := newTestHarness(t, New(zap.New(core)))
+	resp := h.send(h.stream(), requestHeadersMessage(":path", "/a", "x-tenant", "acme", "authorization", "Bearer abc"))
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+
+	// a GET decision request only forwards the allowlisted headers
+	item := <-items
+	require.JSONEq(t, `{":path":"/a","x-tenant":"acme"}`, string(item.Headers))
+	require.Equal(t, "acme", item.Outbound[config.DecisionKeyHeader])
+
+	entries := logs.FilterMessage(sampledMessage).All()
+	require.Len(t, entries, 1)
+	require.Contains(t, entries[0].ContextMap()["request_body"], `"x-decision-key":"acme"`)
+	require.JSONEq(t, `{"responses":[{"decision":"foo"}]}`, entries[0].ContextMap()["response_body"].(string))
+}
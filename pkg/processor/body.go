@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// awaitBody reports whether the decision waits for the request body, which is only buffered in the buffered mode
+func awaitBody(conf *config.Config, in *ext_proc_v3.HttpHeaders) bool {
+	return conf.Body.DecisionPath != "" && conf.Body.ProcessingMode == config.BodyProcessingBuffered && !in.EndOfStream
+}
+
+// handleRequestBody buffers the request body when the decision is taken from it and decides once the last chunk has
+// arrived, rejecting bodies larger than the buffered body limit. Other bodies, such as every body in the streamed
+// mode, are passed on chunk by chunk without being kept.
+func (s *ProcessingServer) handleRequestBody(ctx context.Context, st *streamState, body *ext_proc_v3.HttpBody) (*ext_proc_v3.ProcessingResponse, error) {
+	if !st.awaitingBody {
+		if body.EndOfStream {
+			s.logFor(st).Debug("passed the request body through")
+		}
+		return requestBodyResponse(&ext_proc_v3.BodyResponse{Response: &ext_proc_v3.CommonResponse{Status: ext_proc_v3.CommonResponse_CONTINUE}}), nil
+	}
+	conf := s.confFor(ctx)
+	if len(st.body)+len(body.Body) > conf.Body.MaxBufferedBytes {
+		s.logFor(st).Warn("request body is too large to decide on", zap.Int("limit", conf.Body.MaxBufferedBytes))
+		st.awaitingBody, st.body = false, nil
+		rej := &rejection{problem: Problem{Status: http.StatusRequestEntityTooLarge, Detail: "the request body is too large to route on"}, rule: ruleMaxBufferedBody}
+		return rejectionResponse(conf, rej, st, st.headers), nil
+	}
+	st.body = append(st.body, body.Body...)
+	if !body.EndOfStream {
+		return requestBodyResponse(&ext_proc_v3.BodyResponse{}), nil
+	}
+
+	st.awaitingBody = false
+	st.bodyDecision = bodyDecision(st.body, conf.Body.DecisionPath)
+	st.body = nil
+	if st.bodyDecision == "" {
+		s.logFor(st).Debug("no routing decision in the request body", zap.String("path", conf.Body.DecisionPath))
+	}
+	headersResp, err := s.generateRoutingDecision(ctx, st, st.headers)
+	var rej *rejection
+	if errors.As(err, &rej) {
+		return rejectionResponse(conf, rej, st, st.headers), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := requestBodyResponse(&ext_proc_v3.BodyResponse{Response: headersResp.GetResponse()})
+	if conf.DynamicMetadata.Namespace != "" && st.source != "" {
+		resp.DynamicMetadata = decisionMetadata(conf, st, st.headers, time.Since(st.requestStart))
+	}
+	return resp, nil
+}
+
+func requestBodyResponse(b *ext_proc_v3.BodyResponse) *ext_proc_v3.ProcessingResponse {
+	return &ext_proc_v3.ProcessingResponse{
+		Response: &ext_proc_v3.ProcessingResponse_RequestBody{RequestBody: b},
+	}
+}
+
+// bodyDecision returns the string at the dotted path, e.g. route.service, of the JSON body. A body which isn't JSON or
+// doesn't have a string at the path has no decision.
+func bodyDecision(body []byte, path string) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return ""
+	}
+	for _, field := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = obj[field]
+	}
+	decision, _ := v.(string)
+	return decision
+}
@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	ext_proc_filter_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestBodyDecisionWithoutBody(t *testing.T) {
+	setConfig(t, &config.BodyDecisionPath, "route.service")
+	core, logs := observer.New(zapcore.WarnLevel)
+
+	h := newTestHarness(t, New(zap.New(core)))
+	stream := h.stream()
+
+	start := time.Now()
+	resp := h.send(stream, requestHeadersMessage(":path", "/orders"))
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_BUFFERED, resp.GetModeOverride().GetRequestBodyMode(), "the body is asked for rather than waited for")
+	require.Less(t, time.Since(start), time.Second)
+
+	// envoy went on with the response without sending the body
+	resp = h.send(stream, &ext_proc_v3.ProcessingRequest{Request: &ext_proc_v3.ProcessingRequest_ResponseHeaders{ResponseHeaders: &ext_proc_v3.HttpHeaders{}}})
+	require.NotNil(t, resp.GetResponseHeaders())
+	require.Equal(t, 1, logs.FilterMessage("request body did not arrive, the request was not routed on it").Len())
+}
+
+func TestBodyDecisionSkippedWithoutBody(t *testing.T) {
+	setConfig(t, &config.BodyDecisionPath, "route.service")
+	setConfig(t, &config.RoutingDecisionServer, "")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), &ext_proc_v3.ProcessingRequest{
+		Request: &ext_proc_v3.ProcessingRequest_RequestHeaders{
+			RequestHeaders: &ext_proc_v3.HttpHeaders{Headers: requestHeaders("preferred-svc", "foo").Headers, EndOfStream: true},
+		},
+	})
+	require.Equal(t, "foo", setHeader(resp.GetRequestHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionHeader))
+	require.NotEqual(t, ext_proc_filter_v3.ProcessingMode_BUFFERED, resp.GetModeOverride().GetRequestBodyMode(), "a request without a body has none to ask for")
+}
+
+func TestBodyDecisionFromChunkedBody(t *testing.T) {
+	setConfig(t, &config.BodyDecisionPath, "route.service")
+	setConfig(t, &config.DynamicMetadataNamespace, "routing")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	resp := h.send(stream, requestHeadersMessage(":path", "/orders"))
+	require.Nil(t, resp.GetRequestHeaders().GetResponse().GetHeaderMutation(), "the decision waits for the body")
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_BUFFERED, resp.GetModeOverride().GetRequestBodyMode())
+
+	for _, chunk := range []string{`{"route":`, `{"serv`, `ice":"orders"}}`} {
+		resp = h.send(stream, requestBodyMessage(chunk, false))
+		require.NotNil(t, resp.GetRequestBody())
+		require.Nil(t, resp.GetRequestBody().GetResponse().GetHeaderMutation())
+	}
+	resp = h.send(stream, requestBodyMessage("", true))
+	mutation := resp.GetRequestBody().GetResponse().GetHeaderMutation()
+	require.Equal(t, "orders", setHeader(mutation, config.RoutingDecisionHeader))
+	require.True(t, resp.GetRequestBody().GetResponse().GetClearRouteCache())
+	ns := resp.GetDynamicMetadata().GetFields()[config.DynamicMetadataNamespace].GetStructValue().AsMap()
+	require.Equal(t, sourceBody, ns[config.MetadataFieldSource])
+}
+
+func TestBodyDecisionFallsBackToDecisionServer(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.BodyDecisionPath, "route.service")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+	h.send(stream, requestHeadersMessage())
+	resp := h.send(stream, requestBodyMessage(`{"route":{"service":42}}`, true))
+	require.Equal(t, "external", setHeader(resp.GetRequestBody().GetResponse().GetHeaderMutation(), config.RoutingDecisionHeader))
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestBodyDecisionSkippedWithPreferredSvc(t *testing.T) {
+	setConfig(t, &config.BodyDecisionPath, "route.service")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+	resp := h.send(stream, requestHeadersMessage("preferred-svc", "foo"))
+	require.Equal(t, "foo", setHeader(resp.GetRequestHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionHeader))
+	require.NotEqual(t, ext_proc_filter_v3.ProcessingMode_BUFFERED, resp.GetModeOverride().GetRequestBodyMode())
+
+	resp = h.send(stream, requestBodyMessage(`{"route":{"service":"orders"}}`, true))
+	require.Nil(t, resp.GetRequestBody().GetResponse().GetHeaderMutation())
+}
+
+func TestBodyDecisionRejectsLargeBodies(t *testing.T) {
+	setConfig(t, &config.BodyDecisionPath, "route.service")
+	setConfig(t, &config.MaxBufferedBodyBytes, 16)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+	h.send(stream, requestHeadersMessage())
+	h.send(stream, requestBodyMessage(`{"route":{`, false))
+	ir := h.send(stream, requestBodyMessage(`"service":"orders"}}`, true)).GetImmediateResponse()
+	require.NotNil(t, ir)
+	require.EqualValues(t, http.StatusRequestEntityTooLarge, ir.GetStatus().GetCode())
+}
+
+func TestBodyDecisionPath(t *testing.T) {
+	require.Equal(t, "orders", bodyDecision([]byte(`{"route":{"service":"orders"}}`), "route.service"))
+	require.Equal(t, "orders", bodyDecision([]byte(`{"service":"orders"}`), "service"))
+	require.Empty(t, bodyDecision([]byte(`{"route":"orders"}`), "route.service"))
+	require.Empty(t, bodyDecision([]byte(`not json`), "service"))
+	require.Empty(t, bodyDecision([]byte(`{}`), "service"))
+}
+
+func TestStreamedBodyPassesChunksThrough(t *testing.T) {
+	setConfig(t, &config.BodyDecisionPath, "route.service")
+	setConfig(t, &config.BodyProcessingMode, config.BodyProcessingStreamed)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	resp := h.send(stream, requestHeadersMessage("preferred-svc", "foo"))
+	require.Equal(t, "foo", setHeader(resp.GetRequestHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionHeader), "the decision doesn't wait for the body")
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_STREAMED, resp.GetModeOverride().GetRequestBodyMode(), "the body is asked for in chunks even when the unhandled phases are skipped")
+
+	chunks := []string{`{"route":`, `{"service":`, `"orders"}}`}
+	for i, chunk := range chunks {
+		require.NoError(t, stream.Send(requestBodyMessage(chunk, i == len(chunks)-1)))
+	}
+	for range chunks {
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		require.NotNil(t, resp.GetRequestBody())
+		require.Equal(t, ext_proc_v3.CommonResponse_CONTINUE, resp.GetRequestBody().GetResponse().GetStatus())
+		require.Nil(t, resp.GetRequestBody().GetResponse().GetHeaderMutation())
+	}
+
+	require.NoError(t, stream.CloseSend())
+	_, err := stream.Recv()
+	require.ErrorIs(t, err, io.EOF, "the stream should complete cleanly")
+}
@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// BreakerState is the state of the circuit breaker around the decision server
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen short-circuits every call until the cooldown has passed
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe call through to decide whether to close or open again
+	BreakerHalfOpen
+)
+
+func (b BreakerState) String() string {
+	switch b {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// circuitBreaker trips after threshold consecutive failures. Once the cooldown has passed it half-opens and lets one
+// probe through, closing again when the probe succeeds and re-opening when it fails.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a call may go ahead. Every allowed call must be followed by success, failure or abandon.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	b.setState(BreakerClosed)
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// abandon releases a call which ended without saying anything about the decision server, e.g. it was cancelled
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// retryAfter returns how long until the breaker lets a probe through, never less than a second so clients back off
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if remaining := b.cooldown - b.now().Sub(b.openedAt); remaining > time.Second {
+		return remaining
+	}
+	return time.Second
+}
+
+func (b *circuitBreaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func (b *circuitBreaker) setState(state BreakerState) {
+	b.state = state
+	metrics.CircuitBreakerState.Set(float64(state))
+}
+
+// breakerOpenRejection asks the client to retry with a 503 once the breaker is expected to let calls through again,
+// or after config.CircuitBreakerRetryAfter when it is set
+func breakerOpenRejection(b *circuitBreaker, conf *config.Config) error {
+	retryAfter := conf.CircuitBreaker.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = b.retryAfter()
+	}
+	return &rejection{
+		problem: Problem{Status: http.StatusServiceUnavailable, Detail: "the routing decision server is unavailable"},
+		rule:    ruleCircuitBreakerOpen,
+		source:  sourceExternal,
+		headers: []*core_v3.HeaderValueOption{{
+			Header:       &core_v3.HeaderValue{Key: "retry-after", RawValue: []byte(strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))},
+			AppendAction: core_v3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		}},
+	}
+}
@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(2, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	require.True(t, b.allow())
+	b.failure()
+	require.Equal(t, BreakerClosed, b.current())
+	require.True(t, b.allow())
+	b.failure()
+	require.Equal(t, BreakerOpen, b.current())
+	require.False(t, b.allow())
+
+	// after the cooldown a single probe is let through
+	now = now.Add(10 * time.Second)
+	require.True(t, b.allow())
+	require.Equal(t, BreakerHalfOpen, b.current())
+	require.False(t, b.allow(), "only one probe at a time")
+
+	// a failed probe opens the breaker again straight away
+	b.failure()
+	require.Equal(t, BreakerOpen, b.current())
+	require.False(t, b.allow())
+
+	now = now.Add(10 * time.Second)
+	require.True(t, b.allow())
+	b.success()
+	require.Equal(t, BreakerClosed, b.current())
+	require.True(t, b.allow())
+}
+
+func TestCircuitBreakerAbandonedProbe(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(1, time.Second)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	now = now.Add(time.Second)
+	require.True(t, b.allow())
+	b.abandon()
+	require.Equal(t, BreakerHalfOpen, b.current())
+	require.True(t, b.allow(), "another probe is allowed once the first is abandoned")
+}
+
+func TestCircuitBreakerShortCircuitsDecisionServer(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	defer srv.Close()
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.CircuitBreakerThreshold, 2)
+	setConfig(t, &config.CircuitBreakerCooldown, time.Hour)
+
+	s := New(zap.NewNop())
+	now := time.Now()
+	s.breaker.Load().now = func() time.Time { return now }
+
+	for range 2 {
+		_, err := s.fetchRoutingDecision(context.Background(), "key", requestHeaders())
+		var statusErr *statusError
+		require.ErrorAs(t, err, &statusErr, "a 5xx response is a failure rather than an undecodable success")
+	}
+	require.Equal(t, BreakerOpen, s.BreakerState())
+
+	start := time.Now()
+	decision, err := s.fetchRoutingDecision(context.Background(), "key", requestHeaders())
+	require.NoError(t, err)
+	require.Empty(t, decision)
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	require.EqualValues(t, 2, calls.Load(), "the decision server isn't called while the breaker is open")
+
+	healthy.Store(true)
+	now = now.Add(time.Hour)
+	decision, err = s.fetchRoutingDecision(context.Background(), "key", requestHeaders())
+	require.NoError(t, err)
+	require.Equal(t, "foo", decision)
+	require.Equal(t, BreakerClosed, s.BreakerState())
+}
+
+func TestCircuitBreakerIgnoresCancelledCalls(t *testing.T) {
+	srv, _, _ := sleepyDecisionServer(t, 5*time.Second)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.CircuitBreakerThreshold, 1)
+
+	s := New(zap.NewNop())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := s.fetchRoutingDecision(ctx, "key", requestHeaders())
+	require.Error(t, err)
+	require.Equal(t, BreakerClosed, s.BreakerState())
+}
+
+func TestCircuitBreakerOpenRejects(t *testing.T) {
+	srv, calls := flakyServer(t, 100, http.StatusBadGateway)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.CircuitBreakerThreshold, 1)
+	setConfig(t, &config.CircuitBreakerCooldown, 30*time.Second)
+	setConfig(t, &config.CircuitBreakerOpenAction, config.CircuitBreakerOpenReject)
+	setConfig(t, &config.DefaultRoutingDecision, "default")
+
+	s := New(zap.NewNop())
+	now := time.Now()
+	s.breaker.Load().now = func() time.Time { return now }
+
+	// the failure which trips the breaker still falls back to the default decision
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders())
+	require.NoError(t, err)
+	require.Equal(t, "default", decisionHeader(resp))
+	require.Equal(t, BreakerOpen, s.BreakerState())
+
+	now = now.Add(10 * time.Second)
+	rejected := counter(t, metrics.Decisions.WithLabelValues("breaker_open"))
+	failed := counter(t, metrics.Decisions.WithLabelValues("failure"))
+	h := newTestHarness(t, s)
+	immediate := h.send(h.stream(), requestHeadersMessage()).GetImmediateResponse()
+	require.NotNil(t, immediate)
+	require.EqualValues(t, http.StatusServiceUnavailable, immediate.GetStatus().GetCode())
+	require.Equal(t, "20", setHeader(immediate.GetHeaders(), "retry-after"))
+	require.EqualValues(t, 1, calls.Load(), "the decision server isn't called while the breaker is open")
+	require.Equal(t, rejected+1, counter(t, metrics.Decisions.WithLabelValues("breaker_open")))
+	require.Equal(t, failed, counter(t, metrics.Decisions.WithLabelValues("failure")), "a rejection by the open breaker isn't a failed decision")
+}
+
+func TestCircuitBreakerOpenRejectsWithConfiguredRetryAfter(t *testing.T) {
+	srv, _ := flakyServer(t, 100, http.StatusBadGateway)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.CircuitBreakerThreshold, 1)
+	setConfig(t, &config.CircuitBreakerOpenAction, config.CircuitBreakerOpenReject)
+	setConfig(t, &config.CircuitBreakerRetryAfter, 1500*time.Millisecond)
+
+	s := New(zap.NewNop())
+	_, err := s.fetchRoutingDecision(context.Background(), "key", requestHeaders())
+	require.Error(t, err)
+
+	_, err = s.fetchRoutingDecision(context.Background(), "key", requestHeaders())
+	var rej *rejection
+	require.ErrorAs(t, err, &rej)
+	require.Equal(t, http.StatusServiceUnavailable, rej.problem.Status)
+	require.Equal(t, "2", string(rej.headers[0].Header.RawValue))
+}
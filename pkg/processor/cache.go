@@ -0,0 +1,170 @@
+package processor
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// CacheEntry is a snapshot of a cached routing decision used for inspection
+type CacheEntry struct {
+	Key            string `json:"key"`
+	Decision       string `json:"decision"`
+	RemainingTTLMs int64  `json:"remaining_ttl_ms"`
+}
+
+// outcomes of a cache lookup
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+type cacheEntry struct {
+	key       string
+	decision  string
+	expiresAt time.Time
+}
+
+// cacheStats are the lookups served by the cache since it was created or reset
+type cacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// decisionCache is an in-memory LRU of routing decisions which expire after a TTL. Once full the least recently
+// used decision is evicted.
+type decisionCache struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	// percentage the TTL of each entry is varied by, see jitteredTTL
+	jitter  int
+	size    int
+	entries map[string]*list.Element
+	// most recently used at the front
+	lru    *list.List
+	hits   uint64
+	misses uint64
+	now    func() time.Time
+}
+
+// newDecisionCache creates a cache of up to size decisions, a size of 0 or less is unbounded
+func newDecisionCache(ttl time.Duration, size int) *decisionCache {
+	return &decisionCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *decisionCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.miss()
+		return "", false
+	}
+	e := el.Value.(*cacheEntry)
+	if !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		c.miss()
+		return "", false
+	}
+	c.lru.MoveToFront(el)
+	c.hits++
+	metrics.CacheLookups.WithLabelValues(cacheHit).Inc()
+	return e.decision, true
+}
+
+func (c *decisionCache) miss() {
+	c.misses++
+	metrics.CacheLookups.WithLabelValues(cacheMiss).Inc()
+}
+
+func (c *decisionCache) set(key string, decision string) {
+	c.setWithTTL(key, decision, jitteredTTL(key, c.ttl, c.jitter))
+}
+
+// setWithTTL caches the decision for the given TTL rather than the cache's own
+func (c *decisionCache) setWithTTL(key string, decision string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		e.decision, e.expiresAt = decision, expiresAt
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, decision: decision, expiresAt: expiresAt})
+	if c.size > 0 && c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// jitteredTTL varies the TTL by up to percent either way so entries populated at once don't all expire at once.
+// The same key always gets the same TTL.
+func jitteredTTL(key string, ttl time.Duration, percent int) time.Duration {
+	if percent <= 0 {
+		return ttl
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key)) // nolint:errcheck
+	// spread keys evenly between -1 and 1
+	f := float64(h.Sum64()%2001)/1000 - 1
+	return ttl + time.Duration(float64(ttl)*f*float64(percent)/100)
+}
+
+func (c *decisionCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+func (c *decisionCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.hits, c.misses = 0, 0
+}
+
+func (c *decisionCache) stats() cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return cacheStats{Hits: c.hits, Misses: c.misses, Size: c.lru.Len()}
+}
+
+// dump returns up to limit live entries ordered by key along with the total number of live entries
+func (c *decisionCache) dump(limit int) ([]CacheEntry, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entries := make([]CacheEntry, 0, len(c.entries))
+	for k, el := range c.entries {
+		e := el.Value.(*cacheEntry)
+		remaining := e.expiresAt.Sub(now)
+		if remaining <= 0 {
+			continue
+		}
+		entries = append(entries, CacheEntry{Key: k, Decision: e.decision, RemainingTTLMs: remaining.Milliseconds()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	total := len(entries)
+	if limit >= 0 && total > limit {
+		entries = entries[:limit]
+	}
+	return entries, total
+}
@@ -0,0 +1,203 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestDecisionCacheExpiry(t *testing.T) {
+	now := time.Now()
+	c := newDecisionCache(time.Minute, 0)
+	c.now = func() time.Time { return now }
+
+	c.set("a", "foo")
+	decision, ok := c.get("a")
+	require.True(t, ok)
+	require.Equal(t, "foo", decision)
+
+	now = now.Add(time.Minute)
+	_, ok = c.get("a")
+	require.False(t, ok)
+}
+
+func TestDecisionCacheDump(t *testing.T) {
+	now := time.Now()
+	c := newDecisionCache(time.Minute, 0)
+	c.now = func() time.Time { return now }
+
+	c.set("b", "bar")
+	now = now.Add(20 * time.Second)
+	c.set("a", "foo")
+	now = now.Add(10 * time.Second)
+
+	entries, total := c.dump(10)
+	require.Equal(t, 2, total)
+	require.Equal(t, []CacheEntry{
+		{Key: "a", Decision: "foo", RemainingTTLMs: 50_000},
+		{Key: "b", Decision: "bar", RemainingTTLMs: 30_000},
+	}, entries)
+
+	entries, total = c.dump(1)
+	require.Equal(t, 2, total)
+	require.Len(t, entries, 1)
+
+	now = now.Add(35 * time.Second)
+	entries, total = c.dump(10)
+	require.Equal(t, 1, total)
+	require.Equal(t, "a", entries[0].Key)
+}
+
+func TestDumpCacheReflectsDecisions(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "foo").URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+
+	s := New(zap.NewNop())
+	_, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":authority", "example.com", ":path", "/a"))
+	require.NoError(t, err)
+	_, err = s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":authority", "example.com", ":path", "/b"))
+	require.NoError(t, err)
+
+	entries, total := s.DumpCache(10)
+	require.Equal(t, 2, total)
+	require.Equal(t, "example.com/a", entries[0].Key)
+	require.Equal(t, "foo", entries[0].Decision)
+	require.Equal(t, "example.com/b", entries[1].Key)
+	for _, e := range entries {
+		require.Greater(t, e.RemainingTTLMs, int64(0))
+		require.LessOrEqual(t, e.RemainingTTLMs, time.Minute.Milliseconds())
+	}
+}
+
+func TestDecisionCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newDecisionCache(time.Minute, 2)
+
+	c.set("a", "foo")
+	c.set("b", "bar")
+	_, ok := c.get("a")
+	require.True(t, ok)
+
+	c.set("c", "baz")
+	_, ok = c.get("b")
+	require.False(t, ok, "b was the least recently used")
+	_, ok = c.get("a")
+	require.True(t, ok)
+	_, ok = c.get("c")
+	require.True(t, ok)
+	require.Equal(t, 2, c.stats().Size)
+}
+
+func TestCacheStats(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "foo")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+
+	s := New(zap.NewNop())
+	for range 3 {
+		_, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":authority", "example.com", ":path", "/a"))
+		require.NoError(t, err)
+	}
+	_, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":authority", "example.com", ":path", "/b"))
+	require.NoError(t, err)
+
+	require.Equal(t, cacheStats{Hits: 2, Misses: 2, Size: 2}, s.cacheStats())
+	require.EqualValues(t, 2, calls.Load())
+}
+
+func TestCacheSkipsEmptyAndFailedDecisions(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "").URL)
+	s := New(zap.NewNop())
+	_, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":path", "/"))
+	require.NoError(t, err)
+	require.Zero(t, s.cacheStats().Size)
+
+	s.provider = &staticProvider{err: errors.New("boom")}
+	_, err = s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":path", "/"))
+	require.Error(t, err)
+	require.Zero(t, s.cacheStats().Size)
+}
+
+func TestDecisionCacheConcurrent(t *testing.T) {
+	c := newDecisionCache(time.Minute, 16)
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 1000 {
+				key := fmt.Sprintf("%d-%d", i, j%32)
+				c.set(key, "foo")
+				c.get(key)
+			}
+		}()
+	}
+	wg.Wait()
+	require.LessOrEqual(t, c.stats().Size, 16)
+}
+
+func TestJitteredTTL(t *testing.T) {
+	require.Equal(t, time.Minute, jitteredTTL("a", time.Minute, 0))
+
+	seen := map[time.Duration]bool{}
+	for i := range 1000 {
+		key := fmt.Sprintf("key-%d", i)
+		ttl := jitteredTTL(key, 100*time.Second, 10)
+		require.GreaterOrEqual(t, ttl, 90*time.Second)
+		require.LessOrEqual(t, ttl, 110*time.Second)
+		require.Equal(t, ttl, jitteredTTL(key, 100*time.Second, 10), "the same key gets the same TTL")
+		seen[ttl] = true
+	}
+	require.Greater(t, len(seen), 500, "TTLs should vary across keys")
+}
+
+func TestDecisionCacheJitterSpreadsExpiry(t *testing.T) {
+	now := time.Now()
+	c := newDecisionCache(100*time.Second, 0)
+	c.jitter = 10
+	c.now = func() time.Time { return now }
+
+	for i := range 1000 {
+		c.set(fmt.Sprintf("key-%d", i), "foo")
+	}
+	live := func() int {
+		_, total := c.dump(0)
+		return total
+	}
+
+	now = now.Add(90*time.Second - time.Millisecond)
+	require.Equal(t, 1000, live(), "nothing expires before the lower end of the band")
+	now = now.Add(10 * time.Second)
+	require.InDelta(t, 500, live(), 150, "about half expire by the nominal TTL")
+	now = now.Add(10*time.Second + time.Millisecond)
+	require.Zero(t, live(), "everything expires by the upper end of the band")
+}
+
+func TestDecisionCacheHeader(t *testing.T) {
+	srv, _ := countingDecisionServer(t, "bar")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+	setConfig(t, &config.DecisionCacheHeaderEnabled, true)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	outcome := func() string {
+		stream := h.stream()
+		h.send(stream, requestHeadersMessage(":path", "/"))
+		resp := h.send(stream, responseHeadersMessage())
+		return setHeader(resp.GetResponseHeaders().GetResponse().GetHeaderMutation(), config.DecisionCacheHeader)
+	}
+	require.Equal(t, cacheMiss, outcome())
+	require.Equal(t, cacheHit, outcome())
+
+	setConfig(t, &config.DecisionCacheHeaderEnabled, false)
+	require.Empty(t, outcome())
+}
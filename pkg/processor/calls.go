@@ -0,0 +1,31 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// outcomes of a call to the decision server
+const (
+	callSuccess = "success"
+	callError   = "error"
+	callTimeout = "timeout"
+)
+
+// observeDecisionCall records the outcome and latency of a call to the decision server which started at start. A call
+// answered with a 4xx or 5xx, after any retries, is an error.
+func observeDecisionCall(start time.Time, err error, status int) {
+	outcome := callSuccess
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		outcome = callTimeout
+	case err != nil, status >= http.StatusBadRequest:
+		outcome = callError
+	}
+	metrics.DecisionServerCalls.WithLabelValues(outcome).Inc()
+	metrics.DecisionServerLatency.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+func TestDecisionMetrics(t *testing.T) {
+	srv, _ := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.MetricsDecisionLabels, []string{"external", "preferred"})
+
+	successes := testutil.ToFloat64(metrics.DecisionServerCalls.WithLabelValues(callSuccess))
+	latencies, _ := histogram(t, metrics.DecisionServerLatency.WithLabelValues(callSuccess))
+	external := testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("external", sourceExternal))
+	preferred := testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("preferred", sourceHeader))
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	h.send(h.stream(), requestHeadersMessage())
+	h.send(h.stream(), requestHeadersMessage())
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", "preferred"))
+
+	require.Equal(t, successes+2, testutil.ToFloat64(metrics.DecisionServerCalls.WithLabelValues(callSuccess)))
+	count, _ := histogram(t, metrics.DecisionServerLatency.WithLabelValues(callSuccess))
+	require.Equal(t, latencies+2, count)
+	require.Equal(t, external+2, testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("external", sourceExternal)))
+	require.Equal(t, preferred+1, testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("preferred", sourceHeader)))
+}
+
+func TestDecisionServerCallOutcomes(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	t.Cleanup(slow.Close)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(failing.Close)
+	setConfig(t, &config.RoutingDecisionTimeout, 50*time.Millisecond)
+
+	timeouts := testutil.ToFloat64(metrics.DecisionServerCalls.WithLabelValues(callTimeout))
+	errs := testutil.ToFloat64(metrics.DecisionServerCalls.WithLabelValues(callError))
+
+	// a failed decision fails the stream, only the metrics matter here
+	decide := func() {
+		stream := newTestHarness(t, New(zap.NewNop())).stream()
+		require.NoError(t, stream.Send(requestHeadersMessage()))
+		stream.Recv() // nolint:errcheck
+	}
+
+	setConfig(t, &config.RoutingDecisionServer, slow.URL)
+	decide()
+	require.Equal(t, timeouts+1, testutil.ToFloat64(metrics.DecisionServerCalls.WithLabelValues(callTimeout)))
+
+	setConfig(t, &config.RoutingDecisionServer, failing.URL)
+	decide()
+	require.Equal(t, errs+1, testutil.ToFloat64(metrics.DecisionServerCalls.WithLabelValues(callError)))
+}
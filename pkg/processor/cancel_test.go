@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// counter returns the current value of the counter
+func counter(t *testing.T, c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	require.NoError(t, c.Write(m))
+	return m.GetCounter().GetValue()
+}
+
+func TestStreamCloseCancelsDecision(t *testing.T) {
+	setConfig(t, &config.CancelDecisionOnStreamClose, true)
+	cancelled := counter(t, metrics.Decisions.WithLabelValues("cancelled"))
+	failed := counter(t, metrics.Decisions.WithLabelValues("failure"))
+
+	slow := &slowProvider{decision: "foo", delay: 5 * time.Second}
+	ps := New(zap.NewNop())
+	ps.provider = slow
+	h := newTestHarness(t, ps)
+
+	stream := h.stream()
+	start := time.Now()
+	require.NoError(t, stream.Send(requestHeadersMessage()))
+	require.NoError(t, stream.CloseSend())
+
+	_, err := stream.Recv()
+	require.Equal(t, io.EOF, err)
+	require.Less(t, time.Since(start), time.Second)
+	require.True(t, slow.cancelled.Load(), "the in-flight decision should have been cancelled")
+
+	require.Equal(t, cancelled+1, counter(t, metrics.Decisions.WithLabelValues("cancelled")))
+	require.Equal(t, failed, counter(t, metrics.Decisions.WithLabelValues("failure")))
+}
+
+func TestStreamCloseCompletesDecisionByDefault(t *testing.T) {
+	slow := &slowProvider{decision: "foo", delay: 100 * time.Millisecond}
+	ps := New(zap.NewNop())
+	ps.provider = slow
+	h := newTestHarness(t, ps)
+
+	stream := h.stream()
+	require.NoError(t, stream.Send(requestHeadersMessage()))
+	require.NoError(t, stream.CloseSend())
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "foo", setHeader(resp.GetRequestHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionHeader))
+	require.False(t, slow.cancelled.Load())
+}
+
+func TestStreamCancelAbortsDecision(t *testing.T) {
+	slow := &slowProvider{decision: "foo", delay: 5 * time.Second}
+	ps := New(zap.NewNop())
+	ps.provider = slow
+	h := newTestHarness(t, ps)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := ext_proc_v3.NewExternalProcessorClient(h.conn).Process(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(requestHeadersMessage()))
+	require.Eventually(t, slow.started.Load, time.Second, 10*time.Millisecond)
+	cancel()
+
+	require.Eventually(t, slow.cancelled.Load, time.Second, 10*time.Millisecond, "the in-flight decision should have been cancelled")
+}
@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Candidate is a service the decision server is happy to route to along with its share of the traffic
+type Candidate struct {
+	Service string `json:"service"`
+	Weight  int    `json:"weight"`
+}
+
+// weightedPicker picks a candidate at random in proportion to the weights
+type weightedPicker struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// newWeightedPicker picks using the source, see newProcessPicker for the one seeded per process
+func newWeightedPicker(src rand.Source) *weightedPicker {
+	return &weightedPicker{rng: rand.New(src)}
+}
+
+func newProcessPicker() *weightedPicker {
+	seed := uint64(time.Now().UnixNano())
+	return newWeightedPicker(rand.NewPCG(seed, seed>>32|seed<<32))
+}
+
+// pick returns the chosen service. Candidates with a zero weight are never chosen and when every weight is zero there
+// is no decision. Negative weights, weights adding up to more than math.MaxInt or candidates without a service make the
+// whole set invalid.
+func (p *weightedPicker) pick(candidates []Candidate) (string, error) {
+	service, _, err := p.roll(candidates)
+	return service, err
+}
+
+// roll picks like pick and also returns the value drawn, which picks the same service again with pickAt
+func (p *weightedPicker) roll(candidates []Candidate) (string, weightedRoll, error) {
+	total := 0
+	for _, c := range candidates {
+		if c.Weight < 0 {
+			return "", weightedRoll{}, fmt.Errorf("candidate %q has a negative weight %d", c.Service, c.Weight)
+		}
+		if c.Service == "" {
+			return "", weightedRoll{}, errors.New("candidate without a service")
+		}
+		if c.Weight > math.MaxInt-total {
+			return "", weightedRoll{}, fmt.Errorf("candidate weights add up to more than %d", math.MaxInt)
+		}
+		total += c.Weight
+	}
+	if total == 0 {
+		return "", weightedRoll{}, nil
+	}
+
+	p.mu.Lock()
+	r := weightedRoll{value: p.rng.IntN(total), total: total}
+	p.mu.Unlock()
+	return pickAt(candidates, r.value), r, nil
+}
+
+// pickAt returns the candidate the value, below the total weight, falls on
+func pickAt(candidates []Candidate, n int) string {
+	for _, c := range candidates {
+		if n < c.Weight {
+			return c.Service
+		}
+		n -= c.Weight
+	}
+	return ""
+}
+
+// weightedRoll is the value drawn to pick between candidates whose weights add up to total
+type weightedRoll struct {
+	value int
+	total int
+}
+
+// String formats the roll as <value>/<total>, see parseWeightedRoll
+func (r weightedRoll) String() string {
+	return strconv.Itoa(r.value) + "/" + strconv.Itoa(r.total)
+}
+
+func parseWeightedRoll(v string) (weightedRoll, error) {
+	value, total, ok := strings.Cut(v, "/")
+	if !ok {
+		return weightedRoll{}, fmt.Errorf("invalid weighted roll %q, expected <value>/<total>", v)
+	}
+	var r weightedRoll
+	var err error
+	if r.value, err = strconv.Atoi(value); err != nil {
+		return weightedRoll{}, fmt.Errorf("invalid weighted roll %q: %w", v, err)
+	}
+	if r.total, err = strconv.Atoi(total); err != nil {
+		return weightedRoll{}, fmt.Errorf("invalid weighted roll %q: %w", v, err)
+	}
+	return r, nil
+}
+
+type weightedRollKey struct{}
+
+// withWeightedRoll returns a context in which decodeDecision records the roll of a weighted pick, a zero total when the
+// decision wasn't picked from candidates
+func withWeightedRoll(ctx context.Context) (context.Context, *weightedRoll) {
+	r := &weightedRoll{}
+	return context.WithValue(ctx, weightedRollKey{}, r), r
+}
+
+// recordWeightedRoll keeps the roll when the context asked for it
+func recordWeightedRoll(ctx context.Context, r weightedRoll) {
+	if rec, ok := ctx.Value(weightedRollKey{}).(*weightedRoll); ok {
+		*rec = r
+	}
+}
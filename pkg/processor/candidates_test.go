@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestWeightedPickerDeterministic(t *testing.T) {
+	candidates := []Candidate{{Service: "a", Weight: 1}, {Service: "b", Weight: 3}, {Service: "c", Weight: 0}}
+	first, second := newWeightedPicker(rand.NewPCG(1, 2)), newWeightedPicker(rand.NewPCG(1, 2))
+
+	counts := map[string]int{}
+	for range 4000 {
+		service, err := first.pick(candidates)
+		require.NoError(t, err)
+		again, err := second.pick(candidates)
+		require.NoError(t, err)
+		require.Equal(t, service, again, "the same seed picks the same services")
+		counts[service]++
+	}
+	require.Zero(t, counts["c"], "a zero weight is never picked")
+	require.InDelta(t, 1000, counts["a"], 150)
+	require.InDelta(t, 3000, counts["b"], 150)
+}
+
+func TestWeightedPickerValidation(t *testing.T) {
+	p := newWeightedPicker(rand.NewPCG(1, 2))
+
+	service, err := p.pick([]Candidate{{Service: "a"}, {Service: "b"}})
+	require.NoError(t, err)
+	require.Empty(t, service, "all zero weights have no decision")
+
+	_, err = p.pick([]Candidate{{Service: "a", Weight: 2}, {Service: "b", Weight: -1}})
+	require.ErrorContains(t, err, "negative weight")
+
+	_, err = p.pick([]Candidate{{Weight: 1}})
+	require.ErrorContains(t, err, "without a service")
+
+	_, err = p.pick([]Candidate{{Service: "a", Weight: math.MaxInt - 1}, {Service: "b", Weight: math.MaxInt - 1}})
+	require.ErrorContains(t, err, "add up to more than")
+
+	service, err = p.pick([]Candidate{{Service: "a", Weight: math.MaxInt - 1}, {Service: "b", Weight: 1}})
+	require.NoError(t, err, "weights adding up to exactly math.MaxInt are fine")
+	require.NotEmpty(t, service)
+}
+
+func TestCandidatePicksAreNotCached(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, candidatesServer(t, `{"candidates":[{"service":"a","weight":1},{"service":"b","weight":1}]}`).URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+
+	s := New(zap.NewNop())
+	seen := map[string]bool{}
+	for range 50 {
+		st := &streamState{}
+		resp, err := s.generateRoutingDecision(context.Background(), st, requestHeaders())
+		require.NoError(t, err)
+		require.Equal(t, cacheMiss, st.cacheOutcome)
+		seen[decisionHeader(resp)] = true
+	}
+	require.Len(t, seen, 2, "every request should roll between the candidates")
+}
+
+func candidatesServer(t *testing.T, body string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCandidatesPickedForDecisionHeader(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, candidatesServer(t, `{"decision":"ignored","candidates":[{"service":"a","weight":0},{"service":"b","weight":5}]}`).URL)
+
+	s := New(zap.NewNop())
+	s.picker = newWeightedPicker(rand.NewPCG(1, 2))
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders())
+	require.NoError(t, err)
+	require.Equal(t, "b", decisionHeader(resp))
+}
+
+func TestZeroWeightCandidatesFallThrough(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, candidatesServer(t, `{"decision":"ignored","candidates":[{"service":"a","weight":0}]}`).URL)
+
+	resp, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), &streamState{}, requestHeaders())
+	require.NoError(t, err)
+	require.Nil(t, resp.GetResponse())
+}
+
+func TestDecisionWithoutCandidatesUnchanged(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, candidatesServer(t, `{"decision":"foo"}`).URL)
+
+	resp, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), &streamState{}, requestHeaders())
+	require.NoError(t, err)
+	require.Equal(t, "foo", decisionHeader(resp))
+}
+
+func TestWeightedRollReproducesThePick(t *testing.T) {
+	candidates := []Candidate{{Service: "a", Weight: 1}, {Service: "b", Weight: 2}, {Service: "c", Weight: 3}}
+	setConfig(t, &config.RoutingDecisionServer, candidatesServer(t, `{"candidates":[{"service":"a","weight":1},{"service":"b","weight":2},{"service":"c","weight":3}]}`).URL)
+	setConfig(t, &config.DebugResponses, true)
+
+	s := New(zap.NewNop())
+	seen := map[string]bool{}
+	for range 50 {
+		resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders())
+		require.NoError(t, err)
+		decision := decisionHeader(resp)
+
+		roll, err := parseWeightedRoll(setHeader(resp.GetResponse().GetHeaderMutation(), config.WeightedRollHeader))
+		require.NoError(t, err)
+		require.Equal(t, 6, roll.total)
+		require.Equal(t, decision, pickAt(candidates, roll.value), "the roll should reproduce the pick")
+		seen[decision] = true
+	}
+	require.Len(t, seen, 3)
+}
+
+func TestWeightedRollHeaderNeedsDebug(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, candidatesServer(t, `{"candidates":[{"service":"a","weight":1}]}`).URL)
+
+	resp, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), &streamState{}, requestHeaders())
+	require.NoError(t, err)
+	require.Equal(t, "a", decisionHeader(resp))
+	require.Empty(t, setHeader(resp.GetResponse().GetHeaderMutation(), config.WeightedRollHeader))
+}
+
+func TestParseWeightedRoll(t *testing.T) {
+	r, err := parseWeightedRoll("3/10")
+	require.NoError(t, err)
+	require.Equal(t, weightedRoll{value: 3, total: 10}, r)
+	require.Equal(t, "3/10", r.String())
+
+	_, err = parseWeightedRoll("3")
+	require.Error(t, err)
+	_, err = parseWeightedRoll("x/10")
+	require.Error(t, err)
+}
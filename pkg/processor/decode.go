@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// upper bound of a decision server response we are prepared to read
+const maxDecisionResponseBytes = 1 << 20
+
+// decodeDecision decodes the decision server response. When the response has candidates one is picked by weight and
+// the roll is recorded in the context, see withWeightedRoll.
+// With lenient decoding a response which isn't valid JSON as a whole still yields the decision as long
+// as the decision field itself is intact.
+func (s *ProcessingServer) decodeDecision(ctx context.Context, r io.Reader) (string, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxDecisionResponseBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxDecisionResponseBytes {
+		return "", fmt.Errorf("decision response too large, it is over %d bytes", maxDecisionResponseBytes)
+	}
+
+	var decisionResp RoutingDecision
+	err = json.Unmarshal(body, &decisionResp)
+	if err == nil && decisionResp.Action == config.DecisionActionDeny {
+		return "", s.deniedDecision(ctx, decisionResp)
+	}
+	if err == nil && len(decisionResp.Candidates) > 0 {
+		service, roll, err := s.picker.roll(decisionResp.Candidates)
+		recordWeightedRoll(ctx, roll)
+		return service, err
+	}
+	if err == nil || !s.confFor(ctx).DecisionServer.LenientDecode {
+		return decisionResp.Decision, err
+	}
+
+	decision, ok := salvageDecision(body)
+	if !ok {
+		return "", fmt.Errorf("unable to salvage the decision from the response: %w", err)
+	}
+	s.clientLogFor(ctx).Warn("salvaged the decision from a malformed response", zap.Error(err))
+	return decision, nil
+}
+
+// deniedDecision rejects the request the response denies. A response which also routes the request contradicts itself
+// and is resolved by the contradictory decision resolution.
+func (s *ProcessingServer) deniedDecision(ctx context.Context, resp RoutingDecision) error {
+	if resp.Decision != "" || len(resp.Candidates) > 0 {
+		resolution := s.confFor(ctx).DecisionServer.ContradictoryResolution
+		s.clientLogFor(ctx).Warn("decision response both denies and routes the request",
+			zap.String("decision", resp.Decision), zap.Int("candidates", len(resp.Candidates)), zap.String("resolution", resolution))
+		if resolution == config.ContradictoryDecisionInvalid {
+			return errors.New("decision response both denies and routes the request")
+		}
+	}
+	return reject(ruleDecisionDenied, http.StatusForbidden, "the request was denied by the routing decision server")
+}
+
+// salvageDecision extracts the decision string field of the top level object without parsing the rest of the
+// document. Only brackets and strings are tracked so that a malformed value elsewhere doesn't get in the way, while a
+// decision field nested in another value is ignored.
+func salvageDecision(body []byte) (string, bool) {
+	body = bytes.TrimLeft(body, " \t\r\n")
+	if len(body) == 0 || body[0] != '{' {
+		return "", false
+	}
+	depth := 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case '"':
+			end := stringEnd(body, i)
+			if end < 0 {
+				return "", false
+			}
+			if depth == 1 && string(body[i:end]) == `"decision"` {
+				if decision, ok := salvageStringValue(body[end:]); ok {
+					return decision, true
+				}
+			}
+			i = end - 1
+		}
+	}
+	return "", false
+}
+
+// salvageStringValue decodes the string value following a field name, e.g. `: "foo"`
+func salvageStringValue(rest []byte) (string, bool) {
+	rest = bytes.TrimLeft(rest, " \t\r\n")
+	if len(rest) == 0 || rest[0] != ':' {
+		return "", false
+	}
+	rest = bytes.TrimLeft(rest[1:], " \t\r\n")
+	if len(rest) == 0 || rest[0] != '"' {
+		return "", false
+	}
+	end := stringEnd(rest, 0)
+	if end < 0 {
+		return "", false
+	}
+	var value string
+	if err := json.Unmarshal(rest[:end], &value); err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// stringEnd returns the index just past the JSON string starting at the quote at start, -1 when it isn't terminated
+func stringEnd(body []byte, start int) int {
+	for i := start + 1; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestDecodeDecisionStrict(t *testing.T) {
+	setConfig(t, &config.LenientDecisionDecode, false)
+	s := New(zap.NewNop())
+
+	decision, err := s.decodeDecision(context.Background(), strings.NewReader(`{"decision":"foo","extra":1}`))
+	require.NoError(t, err)
+	require.Equal(t, "foo", decision)
+
+	_, err = s.decodeDecision(context.Background(), strings.NewReader(`{"decision":"foo","extra":}`))
+	require.Error(t, err)
+}
+
+func TestDecodeDecisionLenient(t *testing.T) {
+	setConfig(t, &config.LenientDecisionDecode, true)
+	s := New(zap.NewNop())
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "broken trailing field", body: `{"decision":"foo","extra":}`, want: "foo"},
+		{name: "truncated document", body: `{"decision": "foo", "candidates": [{"service": "ba`, want: "foo"},
+		{name: "escaped value", body: `{"extra": nope, "decision":"foo\"bar!"`, want: `foo"bar!`},
+		{name: "nested decision skipped", body: `{"meta": {"decision": "evil"}, "decision": "foo", "extra":}`, want: "foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := s.decodeDecision(context.Background(), strings.NewReader(tt.body))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, decision)
+		})
+	}
+}
+
+func TestDecodeDecisionLenientUnsalvageable(t *testing.T) {
+	setConfig(t, &config.LenientDecisionDecode, true)
+	s := New(zap.NewNop())
+
+	for _, body := range []string{
+		`{"decision":`,
+		`{"decision": 42,`,
+		`<html>bad gateway</html>`,
+		`{"meta": {"decision": "evil"}, "extra":}`,
+		`[{"decision": "evil"},`,
+		`{"note": "\"decision\": \"evil\"", "extra":}`,
+	} {
+		_, err := s.decodeDecision(context.Background(), strings.NewReader(body))
+		require.Error(t, err, "body %q should not be salvaged", body)
+	}
+}
+
+func TestDecodeDecisionTooLarge(t *testing.T) {
+	s := New(zap.NewNop())
+
+	body := `{"decision":"foo"}` + strings.Repeat(" ", maxDecisionResponseBytes)
+	_, err := s.decodeDecision(context.Background(), strings.NewReader(body))
+	require.ErrorContains(t, err, "too large")
+}
+
+func TestDecodeDecisionDeny(t *testing.T) {
+	s := New(zap.NewNop())
+	_, err := s.decodeDecision(context.Background(), strings.NewReader(`{"action":"deny"}`))
+	var rej *rejection
+	require.ErrorAs(t, err, &rej)
+	require.Equal(t, ruleDecisionDenied, rej.rule)
+}
+
+func TestContradictoryDecisionResolution(t *testing.T) {
+	contradictory := []string{
+		`{"decision":"foo","action":"deny"}`,
+		`{"candidates":[{"service":"foo","weight":1}],"action":"deny"}`,
+	}
+	for _, body := range contradictory {
+		t.Run(body, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(body)) // nolint:errcheck
+			}))
+			t.Cleanup(srv.Close)
+			setConfig(t, &config.RoutingDecisionServer, srv.URL)
+			setConfig(t, &config.DefaultRoutingDecision, "fallback")
+
+			setConfig(t, &config.ContradictoryDecisionResolution, config.ContradictoryDecisionDeny)
+			h := newTestHarness(t, New(zap.NewNop()))
+			resp := h.send(h.stream(), requestHeadersMessage())
+			require.EqualValues(t, http.StatusForbidden, resp.GetImmediateResponse().GetStatus().GetCode(), "deny wins")
+
+			setConfig(t, &config.ContradictoryDecisionResolution, config.ContradictoryDecisionInvalid)
+			h = newTestHarness(t, New(zap.NewNop()))
+			resp = h.send(h.stream(), requestHeadersMessage())
+			require.Nil(t, resp.GetImmediateResponse())
+			require.Equal(t, "fallback", decisionHeader(resp.GetRequestHeaders()), "an invalid response is a failed decision")
+		})
+	}
+}
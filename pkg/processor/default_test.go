@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestDefaultDecisionOnError(t *testing.T) {
+	setConfig(t, &config.DefaultRoutingDecision, "default-svc")
+
+	s := New(zap.NewNop())
+	s.provider = &staticProvider{err: errors.New("boom")}
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":path", "/"))
+	require.NoError(t, err)
+	require.Equal(t, "default-svc", decisionHeader(resp))
+}
+
+func TestNoDefaultDecisionOnError(t *testing.T) {
+	s := New(zap.NewNop())
+	s.provider = &staticProvider{err: errors.New("boom")}
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":path", "/"))
+	require.Error(t, err)
+	require.Nil(t, resp.GetResponse().GetHeaderMutation())
+}
+
+func TestDefaultDecisionOnEmptyDecision(t *testing.T) {
+	setConfig(t, &config.DefaultRoutingDecision, "default-svc")
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+
+	s := New(zap.NewNop())
+	s.provider = &staticProvider{}
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":path", "/"))
+	require.NoError(t, err)
+	require.Equal(t, "default-svc", decisionHeader(resp))
+	require.Zero(t, s.cacheStats().Size, "the default decision isn't cached")
+}
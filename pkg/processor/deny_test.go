@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestDeniedServiceRejected(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "foo")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.DeniedServices, []string{"internal-admin", "billing"})
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	ir := h.send(h.stream(), requestHeadersMessage("preferred-svc", "billing")).GetImmediateResponse()
+	require.NotNil(t, ir)
+	require.EqualValues(t, http.StatusForbidden, ir.GetStatus().GetCode())
+
+	var p Problem
+	require.NoError(t, json.Unmarshal([]byte(ir.Body), &p))
+	require.Equal(t, "the requested service is not allowed", p.Detail)
+	require.Zero(t, calls.Load(), "a denied request never reaches the decision server")
+
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "orders"))
+	require.Nil(t, resp.GetImmediateResponse())
+	require.Equal(t, "orders", decisionHeader(resp.GetRequestHeaders()))
+
+	resp = h.send(h.stream(), requestHeadersMessage())
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+}
+
+func TestDeniedServiceConfiguredResponse(t *testing.T) {
+	setConfig(t, &config.DeniedServices, []string{"billing"})
+	setConfig(t, &config.DeniedServiceStatus, http.StatusNotFound)
+	setConfig(t, &config.DeniedServiceDetail, "no such service")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	ir := h.send(h.stream(), requestHeadersMessage("preferred-svc", "billing")).GetImmediateResponse()
+	require.EqualValues(t, http.StatusNotFound, ir.GetStatus().GetCode())
+	require.Contains(t, ir.Body, "no such service")
+}
+
+func TestRequiredHeader(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "foo")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RequiredHeader, "X-Tenant")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	ir := h.send(h.stream(), requestHeadersMessage("preferred-svc", "orders")).GetImmediateResponse()
+	require.NotNil(t, ir)
+	require.EqualValues(t, http.StatusBadRequest, ir.GetStatus().GetCode())
+	require.Contains(t, ir.Body, "the x-tenant header is required")
+
+	resp := h.send(h.stream(), requestHeadersMessage("x-tenant", "acme", "preferred-svc", "orders"))
+	require.Nil(t, resp.GetImmediateResponse())
+	require.Equal(t, "orders", decisionHeader(resp.GetRequestHeaders()))
+
+	resp = h.send(h.stream(), requestHeadersMessage("x-tenant", "acme"))
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+	require.EqualValues(t, 1, calls.Load(), "a rejected request never reaches the decision server")
+}
+
+func TestRequiredHeaderConfiguredStatus(t *testing.T) {
+	setConfig(t, &config.RequiredHeader, "x-tenant")
+	setConfig(t, &config.RequiredHeaderStatus, http.StatusPreconditionFailed)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	ir := h.send(h.stream(), requestHeadersMessage()).GetImmediateResponse()
+	require.EqualValues(t, http.StatusPreconditionFailed, ir.GetStatus().GetCode())
+}
@@ -0,0 +1,26 @@
+package processor
+
+import (
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/version"
+)
+
+// headers health check responses carry with config.HealthCheckDiagnostics
+const (
+	diagnosticsVersionHeader       = "x-ext-proc-version"
+	diagnosticsUptimeHeader        = "x-ext-proc-uptime-seconds"
+	diagnosticsActiveStreamsHeader = "x-ext-proc-active-streams"
+)
+
+// diagnostics describes the running processor for health and diagnostic clients
+func (s *ProcessingServer) diagnostics() metadata.MD {
+	return metadata.Pairs(
+		diagnosticsVersionHeader, version.HumanVersion,
+		diagnosticsUptimeHeader, strconv.FormatInt(int64(time.Since(s.started)/time.Second), 10),
+		diagnosticsActiveStreamsHeader, strconv.FormatInt(s.activeStreams.Load(), 10),
+	)
+}
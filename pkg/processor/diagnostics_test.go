@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/version"
+)
+
+func (h *testHarness) healthCheckHeader() metadata.MD {
+	var md metadata.MD
+	_, err := grpc_health_v1.NewHealthClient(h.conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}, grpc.Header(&md))
+	require.NoError(h.t, err)
+	return md
+}
+
+func TestHealthCheckDiagnostics(t *testing.T) {
+	setConfig(t, &config.HealthCheckDiagnostics, true)
+
+	ps := New(zap.NewNop())
+	ps.started = time.Now().Add(-90 * time.Second)
+	h := newTestHarness(t, ps)
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+	h.send(h.streamOnNewConn(), requestHeadersMessage("preferred-svc", "foo"))
+
+	md := h.healthCheckHeader()
+	require.Equal(t, []string{version.HumanVersion}, md.Get(diagnosticsVersionHeader))
+	require.Equal(t, []string{"2"}, md.Get(diagnosticsActiveStreamsHeader))
+	require.Len(t, md.Get(diagnosticsUptimeHeader), 1)
+	uptime, err := strconv.Atoi(md.Get(diagnosticsUptimeHeader)[0])
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, uptime, 90)
+}
+
+func TestHealthCheckDiagnosticsDisabled(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+	md := h.healthCheckHeader()
+	require.Empty(t, md.Get(diagnosticsVersionHeader))
+	require.Empty(t, md.Get(diagnosticsActiveStreamsHeader))
+}
@@ -0,0 +1,28 @@
+package processor
+
+import (
+	"net"
+	"strings"
+)
+
+// formatDecision renders the raw decision through the template so it matches the cluster naming convention Envoy
+// expects. The raw decision is read as service[.namespace][:port] and the template can reference {decision},
+// {service}, {namespace} and {port}. An empty template passes the decision through unchanged.
+func formatDecision(tmpl string, decision string) string {
+	if tmpl == "" {
+		return decision
+	}
+
+	host, port := decision, ""
+	if h, p, err := net.SplitHostPort(decision); err == nil {
+		host, port = h, p
+	}
+	service, namespace, _ := strings.Cut(host, ".")
+
+	return strings.NewReplacer(
+		"{decision}", decision,
+		"{service}", service,
+		"{namespace}", namespace,
+		"{port}", port,
+	).Replace(tmpl)
+}
@@ -0,0 +1,42 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestFormatDecision(t *testing.T) {
+	const istio = "outbound|{port}||{service}.{namespace}.svc.cluster.local"
+
+	tests := []struct {
+		name     string
+		tmpl     string
+		decision string
+		want     string
+	}{
+		{name: "pass-through", tmpl: "", decision: "reviews.bookinfo:9080", want: "reviews.bookinfo:9080"},
+		{name: "all placeholders", tmpl: istio, decision: "reviews.bookinfo:9080", want: "outbound|9080||reviews.bookinfo.svc.cluster.local"},
+		{name: "missing port", tmpl: istio, decision: "reviews.bookinfo", want: "outbound|||reviews.bookinfo.svc.cluster.local"},
+		{name: "service only", tmpl: "{service}-{namespace}", decision: "reviews", want: "reviews-"},
+		{name: "raw decision", tmpl: "cluster-{decision}", decision: "reviews", want: "cluster-reviews"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, formatDecision(tt.tmpl, tt.decision))
+		})
+	}
+}
+
+func TestDecisionFormattedOnEmission(t *testing.T) {
+	setConfig(t, &config.DecisionFormat, "outbound|{port}||{service}.{namespace}.svc.cluster.local")
+
+	s := New(zap.NewNop())
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "reviews.bookinfo:9080"))
+	require.NoError(t, err)
+	require.Equal(t, "outbound|9080||reviews.bookinfo.svc.cluster.local", decisionHeader(resp))
+}
@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// query parameters carrying the request to the decision server
+const (
+	forwardPathParam      = "path"
+	forwardMethodParam    = "method"
+	forwardAuthorityParam = "authority"
+	// prefix of the parameters carrying the forwarded headers, see config.DecisionServerConfig.ForwardHeaders, e.g.
+	// header.x-tenant
+	forwardHeaderPrefix = "header."
+)
+
+// decisionURL adds the path, method, authority and the allowlisted headers of the request to the decision server URL
+// as query parameters so the decision server can make an informed decision. Values are percent-encoded and headers
+// missing from the request are left out rather than sent empty.
+func decisionURL(conf *config.Config, server string, in *ext_proc_v3.HttpHeaders) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	if in.GetHeaders() == nil {
+		return server, nil
+	}
+
+	q := u.Query()
+	add := func(param, header string) {
+		if v := getHeaderValue(conf, in, header); v != "" {
+			q.Set(param, v)
+		}
+	}
+	add(forwardPathParam, ":path")
+	add(forwardMethodParam, ":method")
+	add(forwardAuthorityParam, ":authority")
+	for _, h := range conf.DecisionServer.ForwardHeaders {
+		add(forwardHeaderPrefix+headerName(conf, h), h)
+	}
+
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// forwardedHeaders keeps the request headers a GET decision request forwards, see decisionURL
+func forwardedHeaders(conf *config.Config, in *ext_proc_v3.HttpHeaders) *ext_proc_v3.HttpHeaders {
+	keep := map[string]bool{":path": true, ":method": true, ":authority": true}
+	for _, h := range conf.DecisionServer.ForwardHeaders {
+		keep[headerName(conf, h)] = true
+	}
+	out := &ext_proc_v3.HttpHeaders{Headers: &core_v3.HeaderMap{}}
+	for _, h := range in.GetHeaders().GetHeaders() {
+		if keep[headerName(conf, h.Key)] {
+			out.Headers.Headers = append(out.Headers.Headers, h)
+		}
+	}
+	return out
+}
+
+// headersBody serializes every request header, pseudo-headers included, into a JSON object (see headerValues).
+// Bodies larger than the decision request limit are refused rather than sent.
+func headersBody(conf *config.Config, in *ext_proc_v3.HttpHeaders) ([]byte, error) {
+	body, err := json.Marshal(headerValues(conf, in))
+	if err != nil {
+		return nil, err
+	}
+	if maxBytes := conf.DecisionServer.RequestMaxBodyBytes; maxBytes > 0 && len(body) > maxBytes {
+		return nil, fmt.Errorf("request headers are %d bytes which exceeds the %d byte limit of the decision request", len(body), maxBytes)
+	}
+	return body, nil
+}
+
+// headerValues maps the name of every request header to its value. A header seen more than once maps to a list of
+// its values.
+func headerValues(conf *config.Config, in *ext_proc_v3.HttpHeaders) map[string]any {
+	values := map[string][]any{}
+	for _, h := range in.GetHeaders().GetHeaders() {
+		name := headerName(conf, h.Key)
+		values[name] = append(values[name], string(h.RawValue))
+	}
+
+	headers := make(map[string]any, len(values))
+	for name, v := range values {
+		if len(v) == 1 {
+			headers[name] = v[0]
+		} else {
+			headers[name] = v
+		}
+	}
+	return headers
+}
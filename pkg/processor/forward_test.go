@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// queryCapturingServer decides foo and hands over the query of every request it receives
+func queryCapturingServer(t *testing.T) (*httptest.Server, <-chan url.Values) {
+	queries := make(chan url.Values, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.Query()
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, queries
+}
+
+func TestForwardRequestToDecisionServer(t *testing.T) {
+	srv, queries := queryCapturingServer(t)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL+"/decision?static=1")
+	setConfig(t, &config.DecisionForwardHeaders, []string{"X-Tenant", "x-labels", "x-missing"})
+
+	_, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(
+		":path", "/api/users?id=1&x=2",
+		":method", "POST",
+		":authority", "example.com",
+		"x-tenant", "acmé",
+		"x-labels", "a,b, c",
+		"x-other", "not forwarded",
+	))
+	require.NoError(t, err)
+
+	require.Equal(t, url.Values{
+		"static":          {"1"},
+		"path":            {"/api/users?id=1&x=2"},
+		"method":          {"POST"},
+		"authority":       {"example.com"},
+		"header.x-tenant": {"acmé"},
+		"header.x-labels": {"a,b, c"},
+	}, <-queries)
+}
+
+func TestForwardOmitsMissingPseudoHeaders(t *testing.T) {
+	srv, queries := queryCapturingServer(t)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+
+	_, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":path", "/"))
+	require.NoError(t, err)
+
+	q := <-queries
+	require.Equal(t, "/", q.Get("path"))
+	require.NotContains(t, q, "method")
+	require.NotContains(t, q, "authority")
+}
+
+func TestPostHeadersToDecisionServer(t *testing.T) {
+	type captured struct {
+		method, contentType string
+		body                map[string]any
+	}
+	requests := make(chan captured, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := captured{method: r.Method, contentType: r.Header.Get("Content-Type")}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&c.body))
+		requests <- c
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.DecisionRequestMethod, http.MethodPost)
+
+	decision, err := New(zap.NewNop()).fetchRoutingDecision(context.Background(), "key", requestHeaders(
+		":path", "/api",
+		":method", "GET",
+		"X-Tenant", "acme",
+		"cookie", "a=1",
+		"cookie", "b=2",
+	))
+	require.NoError(t, err)
+	require.Equal(t, "foo", decision)
+
+	c := <-requests
+	require.Equal(t, http.MethodPost, c.method)
+	require.Equal(t, "application/json", c.contentType)
+	require.Equal(t, map[string]any{
+		":path":    "/api",
+		":method":  "GET",
+		"x-tenant": "acme",
+		"cookie":   []any{"a=1", "b=2"},
+	}, c.body)
+}
+
+func TestPostHeadersBodyBounded(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "foo")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.DecisionRequestMethod, http.MethodPost)
+	setConfig(t, &config.DecisionRequestMaxBodyBytes, 64)
+
+	_, err := New(zap.NewNop()).fetchRoutingDecision(context.Background(), "key", requestHeaders("x-big", strings.Repeat("a", 100)))
+	require.ErrorContains(t, err, "exceeds the 64 byte limit")
+	require.Zero(t, calls.Load())
+}
@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"context"
+	"crypto/tls"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	decisionv1 "github.com/day0ops/ext-proc-routing-decision/pkg/decision/v1"
+)
+
+// grpcDecisionProvider asks a decision service implementing decision.v1.DecisionService, for decision logic that
+// runs as a gRPC service rather than behind HTTP
+type grpcDecisionProvider struct {
+	conn   *grpc.ClientConn
+	client decisionv1.DecisionServiceClient
+	log    *zap.Logger
+}
+
+// newGRPCDecisionProvider connects to the decision service at the target, e.g. decision-service:9000, over TLS with
+// tlsConf or in plaintext when it is nil. Each call is bounded by the request timeout unless it is 0.
+func newGRPCDecisionProvider(log *zap.Logger, target string, tlsConf *tls.Config) (*grpcDecisionProvider, error) {
+	creds := insecure.NewCredentials()
+	if tlsConf != nil {
+		creds = credentials.NewTLS(tlsConf)
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcDecisionProvider{
+		conn:   conn,
+		client: decisionv1.NewDecisionServiceClient(conn),
+		log:    log,
+	}, nil
+}
+
+func (p *grpcDecisionProvider) Decide(ctx context.Context, req DecisionRequest) (string, error) {
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+	}
+	p.log.Debug("calling the decision service", zap.String("key", req.Key))
+	resp, err := p.client.Decide(ctx, &decisionv1.DecideRequest{Key: req.Key, Headers: decideHeaders(req.Config, req.Headers)})
+	if err != nil {
+		return "", err
+	}
+	return resp.GetDecision(), nil
+}
+
+// Close closes the connection to the decision service
+func (p *grpcDecisionProvider) Close() error {
+	return p.conn.Close()
+}
+
+// decideHeaders groups the values of the headers by name, like headerValues
+func decideHeaders(conf *config.Config, in *ext_proc_v3.HttpHeaders) map[string]*decisionv1.HeaderValues {
+	headers := map[string]*decisionv1.HeaderValues{}
+	for _, h := range in.GetHeaders().GetHeaders() {
+		name := headerName(conf, h.Key)
+		if headers[name] == nil {
+			headers[name] = &decisionv1.HeaderValues{}
+		}
+		headers[name].Values = append(headers[name].Values, string(h.RawValue))
+	}
+	return headers
+}
@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	decisionv1 "github.com/day0ops/ext-proc-routing-decision/pkg/decision/v1"
+)
+
+// fakeDecisionService decides the decision and hands over every request it receives
+type fakeDecisionService struct {
+	decisionv1.UnimplementedDecisionServiceServer
+	decision string
+	delay    time.Duration
+	requests chan *decisionv1.DecideRequest
+}
+
+func (f *fakeDecisionService) Decide(ctx context.Context, in *decisionv1.DecideRequest) (*decisionv1.DecideResponse, error) {
+	if f.requests != nil {
+		f.requests <- in
+	}
+	select {
+	case <-time.After(f.delay):
+		return &decisionv1.DecideResponse{Decision: f.decision}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startDecisionService serves the fake on a local port and returns its address
+func startDecisionService(t *testing.T, f *fakeDecisionService, opts ...grpc.ServerOption) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(opts...)
+	decisionv1.RegisterDecisionServiceServer(srv, f)
+	go srv.Serve(lis) // nolint:errcheck
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func TestGRPCDecisionProvider(t *testing.T) {
+	f := &fakeDecisionService{decision: "foo", requests: make(chan *decisionv1.DecideRequest, 1)}
+	setConfig(t, &config.DecisionProvider, config.DecisionProviderGRPC)
+	setConfig(t, &config.DecisionGRPCServer, startDecisionService(t, f))
+
+	s := New(zap.NewNop())
+	require.IsType(t, &grpcDecisionProvider{}, s.provider)
+
+	h := newTestHarness(t, s)
+	resp := h.send(h.stream(), requestHeadersMessage(":authority", "example.com", ":path", "/api", "x-tenant", "acme", "x-tenant", "other"))
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+
+	in := <-f.requests
+	require.Equal(t, "example.com/api", in.GetKey())
+	headers := map[string][]string{}
+	for name, v := range in.GetHeaders() {
+		headers[name] = v.GetValues()
+	}
+	require.Equal(t, map[string][]string{
+		":authority": {"example.com"},
+		":path":      {"/api"},
+		"x-tenant":   {"acme", "other"},
+	}, headers)
+
+	require.NoError(t, s.Close())
+	require.Equal(t, connectivity.Shutdown, s.provider.(*grpcDecisionProvider).conn.GetState(), "closing the server closes the connection")
+}
+
+func TestGRPCDecisionProviderTLS(t *testing.T) {
+	// the certificate of the httptest server is valid for 127.0.0.1
+	certSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certSrv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCAFile(t, caFile, certSrv)
+	creds := grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: certSrv.TLS.Certificates}))
+
+	setConfig(t, &config.DecisionProvider, config.DecisionProviderGRPC)
+	setConfig(t, &config.DecisionGRPCServer, startDecisionService(t, &fakeDecisionService{decision: "foo"}, creds))
+	setConfig(t, &config.DecisionGRPCTLS, true)
+	setConfig(t, &config.DecisionServerCAFile, caFile)
+
+	s := New(zap.NewNop())
+	defer s.Close()
+	decision, err := s.provider.Decide(context.Background(), DecisionRequest{Key: "key", Headers: requestHeaders(), Config: config.FromEnv()})
+	require.NoError(t, err)
+	require.Equal(t, "foo", decision)
+}
+
+func TestGRPCDecisionProviderTimeout(t *testing.T) {
+	f := &fakeDecisionService{decision: "foo", delay: 5 * time.Second}
+	p, err := newGRPCDecisionProvider(zap.NewNop(), startDecisionService(t, f), nil)
+	require.NoError(t, err)
+	defer p.Close()
+
+	start := time.Now()
+	_, err = p.Decide(context.Background(), DecisionRequest{Key: "key", Headers: requestHeaders(), Config: config.FromEnv(), Timeout: 50 * time.Millisecond})
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestGRPCDecisionProviderWithDecisionTimeout(t *testing.T) {
+	f := &fakeDecisionService{decision: "foo", delay: 5 * time.Second}
+	setConfig(t, &config.DecisionProvider, config.DecisionProviderGRPC)
+	setConfig(t, &config.DecisionGRPCServer, startDecisionService(t, f))
+	setConfig(t, &config.RoutingDecisionTimeout, 0)
+
+	s := New(zap.NewNop(), WithDecisionTimeout(50*time.Millisecond))
+	t.Cleanup(func() { s.Close() }) // nolint:errcheck
+
+	start := time.Now()
+	_, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders())
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second, "the timeout overridden on New bounds every provider")
+}
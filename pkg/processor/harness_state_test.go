@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestCacheSharedAcrossStreams(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "foo")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+
+	resp := h.send(h.stream(), requestHeadersMessage(":authority", "example.com", ":path", "/"))
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+	resp = h.send(h.stream(), requestHeadersMessage(":authority", "example.com", ":path", "/"))
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+	resp = h.send(h.streamOnNewConn(), requestHeadersMessage(":authority", "example.com", ":path", "/"))
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+	require.EqualValues(t, 1, calls.Load())
+
+	h.reset()
+	h.send(h.stream(), requestHeadersMessage(":authority", "example.com", ":path", "/"))
+	require.EqualValues(t, 2, calls.Load())
+}
+
+func TestStreamStateIsolated(t *testing.T) {
+	setConfig(t, &config.CorrelationHeader, "x-decision-correlation-id")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	first, second := h.stream(), h.streamOnNewConn()
+
+	resp := h.send(first, requestHeadersMessage("preferred-svc", "foo"))
+	id := setHeader(resp.GetRequestHeaders().GetResponse().GetHeaderMutation(), "x-decision-correlation-id")
+	require.NotEmpty(t, id)
+
+	// no decision was made on the second stream so nothing is correlated on its response
+	resp = h.send(second, responseHeadersMessage(":status", "200"))
+	require.Equal(t, ext_proc_v3.CommonResponse_CONTINUE, resp.GetResponseHeaders().GetResponse().GetStatus())
+	require.Nil(t, resp.GetResponseHeaders().GetResponse().GetHeaderMutation())
+
+	resp = h.send(first, responseHeadersMessage(":status", "200"))
+	require.Equal(t, id, setHeader(resp.GetResponseHeaders().GetResponse().GetHeaderMutation(), "x-decision-correlation-id"))
+}
+
+func TestStreamDecisionsIsolated(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+	first, second := h.stream(), h.streamOnNewConn()
+
+	h.send(first, requestHeadersMessage("preferred-svc", "foo"))
+	h.send(second, requestHeadersMessage("preferred-svc", "bar"))
+
+	resp := h.send(first, responseHeadersMessage(":status", "200"))
+	require.Equal(t, "foo", setHeader(resp.GetResponseHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionAppliedHeader))
+	resp = h.send(second, responseHeadersMessage(":status", "200"))
+	require.Equal(t, "bar", setHeader(resp.GetResponseHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionAppliedHeader))
+
+	// a new stream starts without a decision
+	resp = h.send(h.stream(), responseHeadersMessage(":status", "200"))
+	require.Nil(t, resp.GetResponseHeaders().GetResponse().GetHeaderMutation())
+}
+
+func TestConcurrentStreamDecisionsIsolated(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		stream := h.stream()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			svc := fmt.Sprintf("svc-%d", i)
+			for range 5 {
+				if !assert.NoError(t, stream.Send(requestHeadersMessage("preferred-svc", svc))) {
+					return
+				}
+				if _, err := stream.Recv(); !assert.NoError(t, err) {
+					return
+				}
+				if !assert.NoError(t, stream.Send(responseHeadersMessage(":status", "200"))) {
+					return
+				}
+				resp, err := stream.Recv()
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, svc, setHeader(resp.GetResponseHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionAppliedHeader))
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testHarness serves a ProcessingServer over an in-memory bufconn listener. Every stream opened by a harness
+// talks to the same ProcessingServer so tests can check which state is shared and which is per stream.
+type testHarness struct {
+	t  *testing.T
+	ps *ProcessingServer
+	// health is served alongside the ProcessingServer
+	health *HealthServer
+	lis    *bufconn.Listener
+	conn   *grpc.ClientConn
+}
+
+func newTestHarness(t *testing.T, ps *ProcessingServer) *testHarness {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	ext_proc_v3.RegisterExternalProcessorServer(srv, ps)
+	health := &HealthServer{Log: zap.NewNop(), Processor: ps}
+	grpc_health_v1.RegisterHealthServer(srv, health)
+	go srv.Serve(lis) // nolint:errcheck
+	t.Cleanup(srv.Stop)
+
+	h := &testHarness{t: t, ps: ps, health: health, lis: lis}
+	h.conn = h.dial()
+	return h
+}
+
+// dial opens a new client connection to the server
+func (h *testHarness) dial() *grpc.ClientConn {
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return h.lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(h.t, err)
+	h.t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// stream opens a new Process stream on the shared connection which is closed when the test ends
+func (h *testHarness) stream() ext_proc_v3.ExternalProcessor_ProcessClient {
+	return h.streamOn(h.conn)
+}
+
+// streamOnNewConn opens a new Process stream on its own connection, like a second Envoy would
+func (h *testHarness) streamOnNewConn() ext_proc_v3.ExternalProcessor_ProcessClient {
+	return h.streamOn(h.dial())
+}
+
+func (h *testHarness) streamOn(conn *grpc.ClientConn) ext_proc_v3.ExternalProcessor_ProcessClient {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.t.Cleanup(cancel)
+	stream, err := ext_proc_v3.NewExternalProcessorClient(conn).Process(ctx)
+	require.NoError(h.t, err)
+	return stream
+}
+
+// reset drops the state shared between streams, such as cached decisions
+func (h *testHarness) reset() {
+	h.ps.resetState()
+}
+
+// send sends the request on the stream and waits for the response
+func (h *testHarness) send(stream ext_proc_v3.ExternalProcessor_ProcessClient, req *ext_proc_v3.ProcessingRequest) *ext_proc_v3.ProcessingResponse {
+	require.NoError(h.t, stream.Send(req))
+	resp, err := stream.Recv()
+	require.NoError(h.t, err)
+	return resp
+}
+
+func requestHeadersMessage(kv ...string) *ext_proc_v3.ProcessingRequest {
+	return &ext_proc_v3.ProcessingRequest{
+		Request: &ext_proc_v3.ProcessingRequest_RequestHeaders{RequestHeaders: requestHeaders(kv...)},
+	}
+}
+
+func responseHeadersMessage(kv ...string) *ext_proc_v3.ProcessingRequest {
+	return &ext_proc_v3.ProcessingRequest{
+		Request: &ext_proc_v3.ProcessingRequest_ResponseHeaders{ResponseHeaders: requestHeaders(kv...)},
+	}
+}
+
+// setHeader returns the value set for the header by the mutation or an empty string when it isn't set
+func setHeader(m *ext_proc_v3.HeaderMutation, key string) string {
+	for _, h := range m.GetSetHeaders() {
+		if h.Header.Key == key {
+			return string(h.Header.RawValue)
+		}
+	}
+	return ""
+}
+
+func requestBodyMessage(body string, endOfStream bool) *ext_proc_v3.ProcessingRequest {
+	return &ext_proc_v3.ProcessingRequest{
+		Request: &ext_proc_v3.ProcessingRequest_RequestBody{
+			RequestBody: &ext_proc_v3.HttpBody{Body: []byte(body), EndOfStream: endOfStream},
+		},
+	}
+}
@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestMixedCaseHeadersLowercased(t *testing.T) {
+	setConfig(t, &config.DecisionKeyTemplate, "{X-Tenant}:{x-REGION}")
+	setConfig(t, &config.CorrelationHeader, "X-Decision-Correlation-ID")
+
+	in := requestHeaders("Preferred-Svc", "foo", "X-TENANT", "acme", "X-Region", "eu", "X-Request-Id", "req-1")
+
+	s := New(zap.NewNop())
+	value, present := s.getPreferredSvcFromHeaders(s.settings.Load(), in)
+	require.True(t, present)
+	require.Equal(t, "foo", value)
+	require.Equal(t, "req-1", getHeaderValue(config.FromEnv(), in, "x-request-id"))
+	require.Equal(t, "acme:eu", decisionKey(config.FromEnv(), in))
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("Preferred-Svc", "foo"))
+	for _, header := range resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+		require.Equal(t, headerName(config.FromEnv(), header.Header.Key), header.Header.Key)
+	}
+	require.NotEmpty(t, setHeader(resp.GetRequestHeaders().GetResponse().GetHeaderMutation(), "x-decision-correlation-id"))
+}
+
+func TestHeaderCasePreservedWhenDisabled(t *testing.T) {
+	setConfig(t, &config.LowercaseHeaders, false)
+	setConfig(t, &config.DecisionKeyTemplate, "{X-Tenant}")
+	setConfig(t, &config.RequestStartHeader, "X-Request-Start")
+
+	in := requestHeaders("x-tenant", "acme")
+	require.Empty(t, decisionKey(config.FromEnv(), in), "names are matched exactly")
+	require.Equal(t, "acme", decisionKey(config.FromEnv(), requestHeaders("X-Tenant", "acme")))
+
+	// the preferred svc header is always matched regardless of case
+	s := New(zap.NewNop())
+	_, present := s.getPreferredSvcFromHeaders(s.settings.Load(), requestHeaders("Preferred-Svc", "foo"))
+	require.True(t, present)
+
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "foo"))
+	require.NoError(t, err)
+	require.Equal(t, "foo", decisionHeader(resp))
+
+	h := newTestHarness(t, s)
+	msg := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+	require.NotEmpty(t, setHeader(msg.GetRequestHeaders().GetResponse().GetHeaderMutation(), "X-Request-Start"))
+}
+
+func TestHeaderNameOptions(t *testing.T) {
+	s := New(zap.NewNop(), WithPreferredSvcHeader("X-Preferred-SVC"), WithRoutingDecisionHeader("X-Upstream-Cluster"))
+
+	for _, key := range []string{"x-preferred-svc", "X-PREFERRED-SVC", "X-Preferred-Svc"} {
+		value, present := s.getPreferredSvcFromHeaders(s.settings.Load(), requestHeaders(key, "foo"))
+		require.True(t, present, key)
+		require.Equal(t, "foo", value)
+	}
+	_, present := s.getPreferredSvcFromHeaders(s.settings.Load(), requestHeaders(config.PreferredSvcHeader, "foo"))
+	require.False(t, present, "the default header no longer applies")
+
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("X-PREFERRED-svc", "foo"))
+	require.NoError(t, err)
+	mutation := resp.GetResponse().GetHeaderMutation()
+	require.Equal(t, "foo", setHeader(mutation, "x-upstream-cluster"))
+	require.Empty(t, setHeader(mutation, config.RoutingDecisionHeader))
+	require.Equal(t, []string{"x-preferred-svc"}, mutation.GetRemoveHeaders())
+}
+
+func TestPreferredSvcHeaderCaseInsensitiveWhenNotLowercasing(t *testing.T) {
+	setConfig(t, &config.LowercaseHeaders, false)
+
+	s := New(zap.NewNop(), WithPreferredSvcHeader("Preferred-Svc"))
+	value, present := s.getPreferredSvcFromHeaders(s.settings.Load(), requestHeaders("PREFERRED-SVC", "foo"))
+	require.True(t, present)
+	require.Equal(t, "foo", value)
+}
+
+func TestEmptyHeaderNameOptionsKeepDefaults(t *testing.T) {
+	s := New(zap.NewNop(), WithPreferredSvcHeader(""), WithRoutingDecisionHeader(""))
+	require.Equal(t, config.PreferredSvcHeader, s.settings.Load().preferredSvcHeader)
+	require.Equal(t, config.RoutingDecisionHeader, s.settings.Load().decisionHeader)
+}
+
+func TestLegacyPreferredSvcDeprecation(t *testing.T) {
+	setConfig(t, &config.LegacyPreferredSvcHeader, "x-preferred-service")
+	setConfig(t, &config.LegacyPreferredSvcDeprecation, true)
+	setConfig(t, &config.LegacyPreferredSvcDeprecationDate, time.Date(2026, time.June, 30, 0, 0, 0, 0, time.UTC))
+	setConfig(t, &config.LegacyPreferredSvcWarning, "use preferred-svc instead")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	respond := func(kv ...string) (string, *ext_proc_v3.HeaderMutation) {
+		stream := h.stream()
+		decision := decisionHeader(h.send(stream, requestHeadersMessage(kv...)).GetRequestHeaders())
+		return decision, h.send(stream, responseHeadersMessage()).GetResponseHeaders().GetResponse().GetHeaderMutation()
+	}
+
+	decision, mutation := respond("x-preferred-service", "legacy")
+	require.Equal(t, "legacy", decision, "the legacy header is still honoured")
+	require.Equal(t, "@1782777600", setHeader(mutation, "deprecation"))
+	require.Equal(t, `299 - "use preferred-svc instead"`, setHeader(mutation, "warning"))
+
+	decision, mutation = respond("preferred-svc", "current", "x-preferred-service", "legacy")
+	require.Equal(t, "current", decision)
+	require.Empty(t, setHeader(mutation, "deprecation"), "only requests using the legacy header are warned")
+	require.Empty(t, setHeader(mutation, "warning"))
+
+	setConfig(t, &config.LegacyPreferredSvcDeprecation, false)
+	_, mutation = respond("x-preferred-service", "legacy")
+	require.Empty(t, setHeader(mutation, "deprecation"))
+}
@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// flakyDecisionServer answers probes with a 503 while unhealthy, counting them
+func flakyDecisionServer(t *testing.T) (*httptest.Server, *atomic.Bool, *atomic.Int32) {
+	var healthy atomic.Bool
+	var probes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &healthy, &probes
+}
+
+func checkHealth(t *testing.T, hs *HealthServer) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	resp, err := hs.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	return resp.Status
+}
+
+func TestHealthCheckDependency(t *testing.T) {
+	srv, healthy, probes := flakyDecisionServer(t)
+	healthy.Store(true)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.HealthCheckDependency, true)
+
+	ps := New(zap.NewNop())
+	now := time.Now()
+	ps.probe.Load().now = func() time.Time { return now }
+	hs := &HealthServer{Log: zap.NewNop(), Processor: ps}
+
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, checkHealth(t, hs))
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, checkHealth(t, hs))
+	require.EqualValues(t, 1, probes.Load(), "the probe result is reused within the probe interval")
+
+	healthy.Store(false)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, checkHealth(t, hs))
+	now = now.Add(config.ProbeInterval)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, checkHealth(t, hs), "a failing decision server degrades the health")
+
+	healthy.Store(true)
+	now = now.Add(config.ProbeInterval)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, checkHealth(t, hs))
+}
+
+func TestHealthCheckIgnoresDependencyByDefault(t *testing.T) {
+	srv, _, probes := flakyDecisionServer(t)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+
+	hs := &HealthServer{Log: zap.NewNop(), Processor: New(zap.NewNop())}
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, checkHealth(t, hs))
+	require.Zero(t, probes.Load())
+}
+
+func TestHealthWatch(t *testing.T) {
+	srv, healthy, _ := flakyDecisionServer(t)
+	healthy.Store(true)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.HealthCheckDependency, true)
+
+	ps := New(zap.NewNop())
+	// probe on every status computation
+	ps.probe.Load().interval = 0
+	h := newTestHarness(t, ps)
+	h.health.watchInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch, err := grpc_health_v1.NewHealthClient(h.conn).Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	resp, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+
+	healthy.Store(false)
+	resp, err = watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, resp.Status)
+
+	healthy.Store(true)
+	resp, err = watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+}
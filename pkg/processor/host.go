@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+)
+
+var hostnameLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// isValidHost reports whether the value can be used as the :authority, i.e. a hostname or IP with an optional port
+func isValidHost(value string) bool {
+	host := value
+	if h, port, err := net.SplitHostPort(value); err == nil {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return false
+		}
+		host = h
+	}
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	if net.ParseIP(host) != nil {
+		return true
+	}
+
+	start := 0
+	for i := 0; i <= len(host); i++ {
+		if i == len(host) || host[i] == '.' {
+			if !hostnameLabel.MatchString(host[start:i]) {
+				return false
+			}
+			start = i + 1
+		}
+	}
+	return true
+}
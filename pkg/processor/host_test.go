@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestIsValidHost(t *testing.T) {
+	for _, host := range []string{"svc", "svc.ns.svc.cluster.local", "svc:8080", "10.0.0.1", "10.0.0.1:443", "[::1]:8080", "::1"} {
+		require.True(t, isValidHost(host), "%q should be valid", host)
+	}
+	for _, host := range []string{"", "svc:0", "svc:http", "-svc", "svc..ns", "svc/path", "outbound|8080||svc", "svc.ns."} {
+		require.False(t, isValidHost(host), "%q should be invalid", host)
+	}
+}
+
+func TestHostRewrite(t *testing.T) {
+	setConfig(t, &config.HostRewrite, true)
+
+	for _, clear := range []bool{true, false} {
+		setConfig(t, &config.HostRewriteClearRouteCache, clear)
+
+		s := New(zap.NewNop())
+		resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":authority", "example.com", "preferred-svc", "svc.ns:8080"))
+		require.NoError(t, err)
+		require.Equal(t, "svc.ns:8080", decisionHeader(resp))
+		require.Equal(t, "svc.ns:8080", setHeader(resp.Response.HeaderMutation, ":authority"))
+		require.Equal(t, clear, resp.Response.ClearRouteCache)
+	}
+}
+
+func TestHostRewriteSkipsInvalidHost(t *testing.T) {
+	setConfig(t, &config.HostRewrite, true)
+
+	s := New(zap.NewNop())
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "not a host"))
+	require.NoError(t, err)
+	require.Equal(t, "not a host", decisionHeader(resp))
+	require.Empty(t, setHeader(resp.Response.HeaderMutation, ":authority"))
+}
+
+func TestHostRewriteDisabled(t *testing.T) {
+	setConfig(t, &config.HostRewrite, false)
+
+	s := New(zap.NewNop())
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "svc.ns:8080"))
+	require.NoError(t, err)
+	require.Empty(t, setHeader(resp.Response.HeaderMutation, ":authority"))
+}
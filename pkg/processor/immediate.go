@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+const problemContentType = "application/problem+json"
+
+// rules a request can be rejected by, reported in debug responses
+const (
+	ruleRequiredHeader     = "required-header"
+	ruleDeniedService      = "denied-service"
+	ruleDisallowedUpstream = "disallowed-upstream"
+	ruleCircuitBreakerOpen = "circuit-breaker-open"
+	ruleMaxBufferedBody    = "max-buffered-body"
+	ruleDecisionDenied     = "decision-denied"
+)
+
+// Problem is an RFC 7807 problem details body returned whenever a request is rejected
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Debug is only filled in with debug responses
+	Debug *ProblemDebug `json:"debug,omitempty"`
+}
+
+// ProblemDebug tells what led to a rejection
+type ProblemDebug struct {
+	Rule      string `json:"rule"`
+	Source    string `json:"source,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// newProblem fills in the configured type and title, defaulting the title to the status text
+func newProblem(conf *config.Config, status int, detail string) Problem {
+	title := conf.Problem.Title
+	if title == "" {
+		title = http.StatusText(status)
+	}
+	return Problem{
+		Type:   conf.Problem.Type,
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// rejection is returned when the request must be denied. Process answers it with an immediate response, filling in
+// the configured type and title of the problem.
+type rejection struct {
+	problem Problem
+	// headers added to the immediate response, e.g. retry-after
+	headers []*core_v3.HeaderValueOption
+	// rule is what rejected the request and source where the rejected decision came from, if any
+	rule   string
+	source string
+}
+
+func (r *rejection) Error() string {
+	return fmt.Sprintf("request rejected with %d: %s", r.problem.Status, r.problem.Detail)
+}
+
+// reject denies the request by the rule with the status and detail
+func reject(rule string, status int, detail string) error {
+	return &rejection{problem: Problem{Status: status, Detail: detail}, rule: rule}
+}
+
+// rejectionResponse answers the rejection, telling what led to it with debug responses. Debug responses must never be
+// enabled in production as they tell clients how requests are routed.
+func rejectionResponse(conf *config.Config, rej *rejection, st *streamState, in *ext_proc_v3.HttpHeaders) *ext_proc_v3.ProcessingResponse {
+	p := newProblem(conf, rej.problem.Status, rej.problem.Detail)
+	if conf.DebugResponses {
+		source := rej.source
+		if source == "" {
+			source = st.source
+		}
+		p.Debug = &ProblemDebug{Rule: rej.rule, Source: source, RequestID: getHeaderValue(conf, in, "x-request-id")}
+	}
+	return immediateResponse(p, rej.headers...)
+}
+
+// immediateResponse rejects the request with the problem along with any extra headers. Every deny path goes through
+// here so rejections look the same to clients.
+func immediateResponse(p Problem, headers ...*core_v3.HeaderValueOption) *ext_proc_v3.ProcessingResponse {
+	body, _ := json.Marshal(p) // nolint:errcheck
+	return &ext_proc_v3.ProcessingResponse{
+		Response: &ext_proc_v3.ProcessingResponse_ImmediateResponse{
+			ImmediateResponse: &ext_proc_v3.ImmediateResponse{
+				Status: &type_v3.HttpStatus{Code: type_v3.StatusCode(p.Status)},
+				Headers: &ext_proc_v3.HeaderMutation{
+					SetHeaders: append([]*core_v3.HeaderValueOption{
+						{
+							Header:       &core_v3.HeaderValue{Key: "content-type", RawValue: []byte(problemContentType)},
+							AppendAction: core_v3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+						},
+					}, headers...),
+				},
+				Body:    string(body),
+				Details: p.Detail,
+			},
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestImmediateResponseProblemBody(t *testing.T) {
+	resp := immediateResponse(newProblem(config.FromEnv(), http.StatusForbidden, "service is not allowed"))
+
+	ir := resp.GetImmediateResponse()
+	require.NotNil(t, ir)
+	require.EqualValues(t, http.StatusForbidden, ir.Status.Code)
+	require.Equal(t, problemContentType, setHeader(ir.Headers, "content-type"))
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal([]byte(ir.Body), &body))
+	require.Equal(t, map[string]any{
+		"type":   "about:blank",
+		"title":  "Forbidden",
+		"status": float64(http.StatusForbidden),
+		"detail": "service is not allowed",
+	}, body)
+}
+
+func TestImmediateResponseConfiguredProblem(t *testing.T) {
+	setConfig(t, &config.ProblemType, "https://example.com/problems/routing")
+	setConfig(t, &config.ProblemTitle, "Routing rejected")
+
+	ir := immediateResponse(newProblem(config.FromEnv(), http.StatusBadRequest, "")).GetImmediateResponse()
+
+	var p Problem
+	require.NoError(t, json.Unmarshal([]byte(ir.Body), &p))
+	require.Equal(t, Problem{Type: "https://example.com/problems/routing", Title: "Routing rejected", Status: http.StatusBadRequest}, p)
+	require.NotContains(t, ir.Body, "detail")
+}
+
+func TestDebugResponsesDescribeTheRejection(t *testing.T) {
+	setConfig(t, &config.DeniedServices, []string{"admin"})
+	setConfig(t, &config.DebugResponses, true)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	ir := h.send(h.stream(), requestHeadersMessage("preferred-svc", "admin", "x-request-id", "req-1")).GetImmediateResponse()
+
+	var p Problem
+	require.NoError(t, json.Unmarshal([]byte(ir.Body), &p))
+	require.Equal(t, &ProblemDebug{Rule: ruleDeniedService, Source: sourceHeader, RequestID: "req-1"}, p.Debug)
+	require.Equal(t, config.DeniedServiceDetail, p.Detail)
+}
+
+func TestDebugResponsesDisabledByDefault(t *testing.T) {
+	setConfig(t, &config.DeniedServices, []string{"admin"})
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	ir := h.send(h.stream(), requestHeadersMessage("preferred-svc", "admin", "x-request-id", "req-1")).GetImmediateResponse()
+	require.NotNil(t, ir)
+	require.NotContains(t, ir.Body, "debug")
+	require.NotContains(t, ir.Body, "req-1")
+}
@@ -0,0 +1,39 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaAuditProducer publishes audit records as JSON to a Kafka topic, keyed by the decision so the records of a
+// service stay in order
+type kafkaAuditProducer struct {
+	writer *kafka.Writer
+}
+
+func newKafkaAuditProducer(brokers []string, topic string) *kafkaAuditProducer {
+	return &kafkaAuditProducer{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireOne,
+	}}
+}
+
+func (p *kafkaAuditProducer) Publish(ctx context.Context, records []AuditRecord) error {
+	messages := make([]kafka.Message, 0, len(records))
+	for _, r := range records {
+		value, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, kafka.Message{Key: []byte(r.Decision), Value: value, Time: r.Time})
+	}
+	return p.writer.WriteMessages(ctx, messages...)
+}
+
+func (p *kafkaAuditProducer) Close() error {
+	return p.writer.Close()
+}
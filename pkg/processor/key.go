@@ -0,0 +1,33 @@
+package processor
+
+import (
+	"regexp"
+	"strings"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+var keyPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// decisionKey identifies the request for caching, rule matching and the decision server. It is rendered from
+// the decision key template when set, otherwise it is the authority and path of the request.
+func decisionKey(conf *config.Config, in *ext_proc_v3.HttpHeaders) string {
+	if conf.Decision.KeyTemplate == "" {
+		return getHeaderValue(conf, in, ":authority") + requestPath(conf, in)
+	}
+	return renderKey(conf, conf.Decision.KeyTemplate, in)
+}
+
+// renderKey substitutes each {header-name} in the template with the header value, or nothing when the header is missing.
+// {:path} is the normalized path.
+func renderKey(conf *config.Config, tmpl string, in *ext_proc_v3.HttpHeaders) string {
+	return keyPlaceholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := m[1 : len(m)-1]
+		if strings.EqualFold(name, ":path") {
+			return requestPath(conf, in)
+		}
+		return getHeaderValue(conf, in, name)
+	})
+}
@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestRenderKey(t *testing.T) {
+	const tmpl = "{x-tenant}:{x-region}"
+
+	require.Equal(t, "acme:eu", renderKey(config.FromEnv(), tmpl, requestHeaders("x-tenant", "acme", "X-Region", "eu")))
+	require.Equal(t, "acme:", renderKey(config.FromEnv(), tmpl, requestHeaders("x-tenant", "acme")))
+	require.Equal(t, ":", renderKey(config.FromEnv(), tmpl, requestHeaders()))
+	require.Equal(t, "acme", renderKey(config.FromEnv(), "{X-Tenant}", requestHeaders("x-tenant", "acme")))
+}
+
+func TestDecisionKeyDefault(t *testing.T) {
+	setConfig(t, &config.DecisionKeyTemplate, "")
+	require.Equal(t, "example.com/a", decisionKey(config.FromEnv(), requestHeaders(":authority", "example.com", ":path", "/a")))
+}
+
+func TestDecisionKeyUsedForCachingAndForwarding(t *testing.T) {
+	var calls atomic.Int32
+	var got atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		got.Store(r.Header.Get("x-decision-key"))
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	defer srv.Close()
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+	setConfig(t, &config.DecisionKeyTemplate, "{x-tenant}:{x-region}")
+
+	s := New(zap.NewNop())
+	_, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":path", "/a", "x-tenant", "acme"))
+	require.NoError(t, err)
+	require.Equal(t, "acme:", got.Load())
+
+	// a different path for the same tenant shares the cached decision
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":path", "/b", "x-tenant", "acme"))
+	require.NoError(t, err)
+	require.Equal(t, "foo", decisionHeader(resp))
+	require.EqualValues(t, 1, calls.Load())
+
+	entries, _ := s.DumpCache(10)
+	require.Equal(t, "acme:", entries[0].Key)
+}
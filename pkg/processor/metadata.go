@@ -0,0 +1,46 @@
+package processor
+
+import (
+	"strings"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// decisionMetadata builds the dynamic metadata describing the decision of the stream, nested under
+// the dynamic metadata namespace so both the rate limit filter and access logs can read it. Fields without a value,
+// such as the tenant of a request without the tenant header, are left out.
+func decisionMetadata(conf *config.Config, st *streamState, in *ext_proc_v3.HttpHeaders, latency time.Duration) *structpb.Struct {
+	metadata := conf.DynamicMetadata
+	fields := map[string]*structpb.Value{}
+	for _, f := range metadata.Fields {
+		switch f.Field {
+		case config.MetadataFieldDecision:
+			if st.decision != "" {
+				fields[f.Name] = metadataString(st.decision, metadata.MaxValueBytes)
+			}
+		case config.MetadataFieldSource:
+			fields[f.Name] = metadataString(st.source, metadata.MaxValueBytes)
+		case config.MetadataFieldTenant:
+			if tenant := getHeaderValue(conf, in, metadata.TenantHeader); tenant != "" {
+				fields[f.Name] = metadataString(tenant, metadata.MaxValueBytes)
+			}
+		case config.MetadataFieldLatency:
+			fields[f.Name] = structpb.NewNumberValue(float64(latency.Microseconds()) / 1000)
+		}
+	}
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		metadata.Namespace: structpb.NewStructValue(&structpb.Struct{Fields: fields}),
+	}}
+}
+
+// metadataString truncates the value to max bytes without splitting a character
+func metadataString(v string, max int) *structpb.Value {
+	if max > 0 && len(v) > max {
+		v = strings.ToValidUTF8(v[:max], "")
+	}
+	return structpb.NewStringValue(v)
+}
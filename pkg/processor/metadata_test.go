@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestDecisionMetadata(t *testing.T) {
+	setConfig(t, &config.DynamicMetadataNamespace, "envoy.filters.http.ext_proc")
+	setConfig(t, &config.DecisionMetadataFields, []config.MetadataField{
+		{Field: config.MetadataFieldDecision, Name: "routing_decision"},
+		{Field: config.MetadataFieldSource, Name: config.MetadataFieldSource},
+		{Field: config.MetadataFieldTenant, Name: "tenant_id"},
+		{Field: config.MetadataFieldLatency, Name: config.MetadataFieldLatency},
+	})
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo", "x-tenant", "acme"))
+
+	ns := resp.GetDynamicMetadata().GetFields()["envoy.filters.http.ext_proc"].GetStructValue().AsMap()
+	require.Len(t, ns, 4)
+	require.Equal(t, "foo", ns["routing_decision"])
+	require.Equal(t, sourceHeader, ns["source"])
+	require.Equal(t, "acme", ns["tenant_id"])
+	require.IsType(t, float64(0), ns["latency_ms"])
+	require.GreaterOrEqual(t, ns["latency_ms"], float64(0))
+}
+
+func TestDecisionMetadataFallback(t *testing.T) {
+	setConfig(t, &config.DynamicMetadataNamespace, "routing")
+	setConfig(t, &config.EmptyPreferredSvcNoDecision, true)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", ""))
+
+	ns := resp.GetDynamicMetadata().GetFields()["routing"].GetStructValue().AsMap()
+	require.Equal(t, sourceFallback, ns[config.MetadataFieldSource])
+	require.NotContains(t, ns, config.MetadataFieldDecision)
+	require.NotContains(t, ns, config.MetadataFieldTenant)
+}
+
+func TestDecisionMetadataValuesBounded(t *testing.T) {
+	setConfig(t, &config.DynamicMetadataNamespace, "routing")
+	setConfig(t, &config.DecisionMetadataMaxValueBytes, 8)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo", "x-tenant", "tenant-"+strings.Repeat("é", 10)))
+
+	ns := resp.GetDynamicMetadata().GetFields()["routing"].GetStructValue().AsMap()
+	require.Equal(t, "tenant-", ns[config.MetadataFieldTenant], "a value should never be cut within a character")
+}
+
+func TestDecisionMetadataSource(t *testing.T) {
+	srv, _ := countingDecisionServer(t, "bar")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.DynamicMetadataNamespace, "envoy.ext_proc.routing")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+	ns := resp.GetDynamicMetadata().GetFields()[config.DynamicMetadataNamespace].GetStructValue().AsMap()
+	require.Equal(t, "foo", ns[config.MetadataFieldDecision])
+	require.Equal(t, sourceHeader, ns[config.MetadataFieldSource])
+
+	resp = h.send(h.stream(), requestHeadersMessage())
+	ns = resp.GetDynamicMetadata().GetFields()[config.DynamicMetadataNamespace].GetStructValue().AsMap()
+	require.Equal(t, "bar", ns[config.MetadataFieldDecision])
+	require.Equal(t, sourceExternal, ns[config.MetadataFieldSource])
+}
+
+func TestDecisionMetadataDisabled(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+	require.Nil(t, resp.GetDynamicMetadata())
+}
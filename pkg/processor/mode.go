@@ -0,0 +1,53 @@
+package processor
+
+import (
+	ext_proc_filter_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// unhandledPhasesMode tells Envoy to stop sending the bodies and trailers, which aren't processed.
+// Response headers are left as configured since they carry the decision back to the client. Envoy only honours it
+// when the filter sets allow_mode_override.
+func unhandledPhasesMode(conf *config.Config) *ext_proc_filter_v3.ProcessingMode {
+	mode := &ext_proc_filter_v3.ProcessingMode{
+		RequestBodyMode:     ext_proc_filter_v3.ProcessingMode_NONE,
+		RequestTrailerMode:  ext_proc_filter_v3.ProcessingMode_SKIP,
+		ResponseBodyMode:    ext_proc_filter_v3.ProcessingMode_NONE,
+		ResponseTrailerMode: ext_proc_filter_v3.ProcessingMode_SKIP,
+	}
+	if conf.Decision.Trailer != "" {
+		// the decision may come in the request trailers
+		mode.RequestTrailerMode = ext_proc_filter_v3.ProcessingMode_SEND
+	}
+	return mode
+}
+
+// modeOverride is the processing mode asked of Envoy along with the request headers response, nil leaves the mode as
+// configured. The request body is asked for in one piece when the decision is taken from it, or chunk by chunk in the
+// streamed mode, and the response body in one piece when it is annotated.
+func modeOverride(conf *config.Config, awaitingBody bool) *ext_proc_filter_v3.ProcessingMode {
+	var mode *ext_proc_filter_v3.ProcessingMode
+	if conf.Stream.SkipUnhandledPhases {
+		mode = unhandledPhasesMode(conf)
+	}
+	if conf.Body.ProcessingMode == config.BodyProcessingStreamed {
+		if mode == nil {
+			mode = &ext_proc_filter_v3.ProcessingMode{}
+		}
+		mode.RequestBodyMode = ext_proc_filter_v3.ProcessingMode_STREAMED
+	}
+	if awaitingBody {
+		if mode == nil {
+			mode = &ext_proc_filter_v3.ProcessingMode{}
+		}
+		mode.RequestBodyMode = ext_proc_filter_v3.ProcessingMode_BUFFERED
+	}
+	if conf.AnnotateResponseBody.Enabled {
+		if mode == nil {
+			mode = &ext_proc_filter_v3.ProcessingMode{}
+		}
+		mode.ResponseBodyMode = ext_proc_filter_v3.ProcessingMode_BUFFERED
+	}
+	return mode
+}
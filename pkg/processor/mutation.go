@@ -0,0 +1,60 @@
+package processor
+
+import (
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// headerMutation returns the header mutation carried by the response if there is one
+func headerMutation(resp *ext_proc_v3.ProcessingResponse) *ext_proc_v3.HeaderMutation {
+	switch r := resp.Response.(type) {
+	case *ext_proc_v3.ProcessingResponse_RequestHeaders:
+		return r.RequestHeaders.GetResponse().GetHeaderMutation()
+	case *ext_proc_v3.ProcessingResponse_ResponseHeaders:
+		return r.ResponseHeaders.GetResponse().GetHeaderMutation()
+	case *ext_proc_v3.ProcessingResponse_RequestBody:
+		return r.RequestBody.GetResponse().GetHeaderMutation()
+	case *ext_proc_v3.ProcessingResponse_ResponseBody:
+		return r.ResponseBody.GetResponse().GetHeaderMutation()
+	case *ext_proc_v3.ProcessingResponse_RequestTrailers:
+		return r.RequestTrailers.GetHeaderMutation()
+	case *ext_proc_v3.ProcessingResponse_ResponseTrailers:
+		return r.ResponseTrailers.GetHeaderMutation()
+	case *ext_proc_v3.ProcessingResponse_ImmediateResponse:
+		return r.ImmediateResponse.GetHeaders()
+	}
+	return nil
+}
+
+// observeMutationSize records the size of the header mutation sent to Envoy. Oversized mutations are logged
+// since Envoy rejects ext_proc responses that grow the headers past its limits.
+func (s *ProcessingServer) observeMutationSize(conf *config.Config, resp *ext_proc_v3.ProcessingResponse) {
+	m := headerMutation(resp)
+	if m == nil {
+		return
+	}
+
+	var setBytes, removeBytes int
+	for _, h := range m.SetHeaders {
+		setBytes += len(h.GetHeader().GetKey()) + len(h.GetHeader().GetRawValue()) + len(h.GetHeader().GetValue())
+	}
+	for _, h := range m.RemoveHeaders {
+		removeBytes += len(h)
+	}
+
+	metrics.HeaderMutationHeaders.WithLabelValues("set").Observe(float64(len(m.SetHeaders)))
+	metrics.HeaderMutationHeaders.WithLabelValues("remove").Observe(float64(len(m.RemoveHeaders)))
+	metrics.HeaderMutationBytes.WithLabelValues("set").Observe(float64(setBytes))
+	metrics.HeaderMutationBytes.WithLabelValues("remove").Observe(float64(removeBytes))
+
+	if warnBytes := conf.Mutation.WarnBytes; warnBytes > 0 && setBytes+removeBytes > warnBytes {
+		s.log.Warn("header mutation is larger than the configured threshold",
+			zap.Int("set_headers", len(m.SetHeaders)),
+			zap.Int("remove_headers", len(m.RemoveHeaders)),
+			zap.Int("bytes", setBytes+removeBytes),
+			zap.Int("threshold", warnBytes))
+	}
+}
@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// histogram returns the sample count and sum observed by the histogram
+func histogram(t *testing.T, o prometheus.Observer) (uint64, float64) {
+	m := &dto.Metric{}
+	require.NoError(t, o.(prometheus.Metric).Write(m))
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestMutationSizeObserved(t *testing.T) {
+	setConfig(t, &config.HeaderMutationWarnBytes, 0)
+
+	setCount, _ := histogram(t, metrics.HeaderMutationHeaders.WithLabelValues("set"))
+	_, setBytes := histogram(t, metrics.HeaderMutationBytes.WithLabelValues("set"))
+	_, removeBytes := histogram(t, metrics.HeaderMutationBytes.WithLabelValues("remove"))
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+
+	count, _ := histogram(t, metrics.HeaderMutationHeaders.WithLabelValues("set"))
+	require.Equal(t, setCount+1, count)
+	_, sum := histogram(t, metrics.HeaderMutationBytes.WithLabelValues("set"))
+	require.Equal(t, setBytes+float64(len(config.RoutingDecisionHeader)+len("foo")), sum)
+	_, sum = histogram(t, metrics.HeaderMutationBytes.WithLabelValues("remove"))
+	require.Equal(t, removeBytes+float64(len(config.PreferredSvcHeader)), sum)
+}
+
+func TestMutationSizeWarning(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	setConfig(t, &config.HeaderMutationWarnBytes, 64)
+
+	h := newTestHarness(t, New(zap.New(core)))
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+	require.Zero(t, logs.FilterMessage("header mutation is larger than the configured threshold").Len())
+
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", strings.Repeat("a", 100)))
+	warnings := logs.FilterMessage("header mutation is larger than the configured threshold").All()
+	require.Len(t, warnings, 1)
+	require.EqualValues(t, 64, warnings[0].ContextMap()["threshold"])
+}
+
+func TestMutationSkippedOnCurrentRoute(t *testing.T) {
+	setConfig(t, &config.CurrentRouteHeader, "x-current-route")
+	setConfig(t, &config.ClearRouteCache, true)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo", "x-current-route", "foo"))
+	require.Empty(t, resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders())
+	require.Equal(t, []string{config.PreferredSvcHeader}, resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders())
+	require.False(t, resp.GetRequestHeaders().GetResponse().GetClearRouteCache())
+
+	resp = h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo", "x-current-route", "bar"))
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+	require.True(t, resp.GetRequestHeaders().GetResponse().GetClearRouteCache())
+}
+
+func TestMutationSkippedOnFormattedCurrentRoute(t *testing.T) {
+	setConfig(t, &config.CurrentRouteHeader, "x-current-route")
+	setConfig(t, &config.DecisionFormat, "outbound|80||{service}")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo", "x-current-route", "foo"))
+	require.Equal(t, "outbound|80||foo", decisionHeader(resp.GetRequestHeaders()))
+
+	stream := h.stream()
+	resp = h.send(stream, requestHeadersMessage("preferred-svc", "foo", "x-current-route", "outbound|80||foo"))
+	require.Empty(t, resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders())
+
+	// the decision is still known to the response phase
+	resp = h.send(stream, responseHeadersMessage())
+	require.Equal(t, "foo", setHeader(resp.GetResponseHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionAppliedHeader))
+}
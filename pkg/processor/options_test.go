@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestProcessorsWithDifferentDecisionServers(t *testing.T) {
+	srvA, callsA := countingDecisionServer(t, "a")
+	srvB, callsB := countingDecisionServer(t, "b")
+	setConfig(t, &config.RoutingDecisionServer, "")
+
+	a := newTestHarness(t, New(zap.NewNop(), WithDecisionServer(srvA.URL)))
+	b := newTestHarness(t, New(zap.NewNop(), WithDecisionServer(srvB.URL), WithPreferredSvcHeader("x-svc")))
+
+	require.Equal(t, "a", decisionHeader(a.send(a.stream(), requestHeadersMessage()).GetRequestHeaders()))
+	require.Equal(t, "b", decisionHeader(b.send(b.stream(), requestHeadersMessage()).GetRequestHeaders()))
+	require.EqualValues(t, 1, callsA.Load())
+	require.EqualValues(t, 1, callsB.Load())
+
+	// each processor only honours its own preferred svc header
+	require.Equal(t, "a", decisionHeader(a.send(a.stream(), requestHeadersMessage("x-svc", "foo")).GetRequestHeaders()))
+	require.Equal(t, "foo", decisionHeader(b.send(b.stream(), requestHeadersMessage("x-svc", "foo")).GetRequestHeaders()))
+
+	require.True(t, a.ps.DecisionServerReachable(context.Background()), "the probe checks the decision server of the processor")
+}
+
+func TestWithDecisionTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.Write([]byte(`{"decision":"slow"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RoutingDecisionTimeout, 0)
+
+	impatient := New(zap.NewNop(), WithDecisionTimeout(50*time.Millisecond))
+	require.Equal(t, 50*time.Millisecond, impatient.currentCallLimits(context.Background()).timeout)
+	_, err := impatient.fetchRoutingDecision(context.Background(), "key", requestHeaders())
+	require.Error(t, err)
+
+	patient := New(zap.NewNop())
+	require.Zero(t, patient.currentCallLimits(context.Background()).timeout)
+	decision, err := patient.fetchRoutingDecision(context.Background(), "key", requestHeaders())
+	require.NoError(t, err)
+	require.Equal(t, "slow", decision)
+}
+
+func TestProcessorsWithDifferentConfigs(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, "")
+
+	confA := config.FromEnv()
+	confA.DecisionServer.URL = srv.URL
+	confB := config.FromEnv()
+	confB.DefaultDecision = "fallback"
+	confB.DeniedServices.Services = []string{"internal"}
+
+	a := newTestHarness(t, New(zap.NewNop(), WithConfig(confA)))
+	b := newTestHarness(t, New(zap.NewNop(), WithConfig(confB)))
+
+	require.Equal(t, "external", decisionHeader(a.send(a.stream(), requestHeadersMessage()).GetRequestHeaders()))
+	require.EqualValues(t, 1, calls.Load())
+	require.Equal(t, "internal", decisionHeader(a.send(a.stream(), requestHeadersMessage("preferred-svc", "internal")).GetRequestHeaders()))
+
+	require.Equal(t, "fallback", decisionHeader(b.send(b.stream(), requestHeadersMessage()).GetRequestHeaders()))
+	stream := b.stream()
+	require.NoError(t, stream.Send(requestHeadersMessage("preferred-svc", "internal")))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.EqualValues(t, http.StatusForbidden, resp.GetImmediateResponse().GetStatus().GetCode())
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestReloadKeepsConfig(t *testing.T) {
+	conf := config.FromEnv()
+	conf.DefaultDecision = "fallback"
+	ps := New(zap.NewNop(), WithConfig(conf))
+
+	setConfig(t, &config.DefaultRoutingDecision, "other")
+	ps.Reload()
+	require.Same(t, conf, ps.conf(), "a config given with WithConfig isn't replaced by the package config")
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestResponsesFollowRequestOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get(config.DecisionKeyHeader), "/slow") {
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{"decision":"slow"}`)) // nolint:errcheck
+			return
+		}
+		w.Write([]byte(`{"decision":"fast"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.DecisionKeyTemplate, "{:path}")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	// pipeline requests sharing the stream without waiting, slow and fast decisions interleaved
+	paths := []string{"/slow/1", "/fast/1", "/slow/2", "/fast/2"}
+	for _, path := range paths {
+		require.NoError(t, stream.Send(requestHeadersMessage(":authority", "example.com", ":path", path)))
+		require.NoError(t, stream.Send(responseHeadersMessage(":status", "200")))
+	}
+	// a decision taken from the header is immediate
+	require.NoError(t, stream.Send(requestHeadersMessage("preferred-svc", "header")))
+
+	var got []string
+	for range paths {
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		require.IsType(t, &ext_proc_v3.ProcessingResponse_RequestHeaders{}, resp.Response)
+		got = append(got, decisionHeader(resp.GetRequestHeaders()))
+
+		resp, err = stream.Recv()
+		require.NoError(t, err)
+		require.IsType(t, &ext_proc_v3.ProcessingResponse_ResponseHeaders{}, resp.Response, "the response headers of a request come after its request headers")
+	}
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	got = append(got, decisionHeader(resp.GetRequestHeaders()))
+
+	require.Equal(t, []string{"slow", "fast", "slow", "fast", "header"}, got)
+}
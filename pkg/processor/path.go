@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+var repeatedSlashes = regexp.MustCompile(`/{2,}`)
+
+// requestPath returns the :path of the request normalized by the path normalization transforms
+func requestPath(conf *config.Config, in *ext_proc_v3.HttpHeaders) string {
+	return normalizePath(getHeaderValue(conf, in, ":path"), conf.PathNormalization.Transforms)
+}
+
+// normalizePath applies the transforms to the path leaving the query string untouched
+func normalizePath(p string, transforms []string) string {
+	if len(transforms) == 0 || p == "" {
+		return p
+	}
+	p, query, hasQuery := strings.Cut(p, "?")
+
+	if slices.Contains(transforms, config.PathCollapseSlashes) {
+		p = repeatedSlashes.ReplaceAllString(p, "/")
+	}
+	if slices.Contains(transforms, config.PathResolveDots) {
+		p = resolveDotSegments(p)
+	}
+	if slices.Contains(transforms, config.PathTrimTrailingSlash) && len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+		if p == "" {
+			p = "/"
+		}
+	}
+	if slices.Contains(transforms, config.PathLowercase) {
+		p = strings.ToLower(p)
+	}
+
+	if hasQuery {
+		return p + "?" + query
+	}
+	return p
+}
+
+// resolveDotSegments removes . and .. segments (RFC 3986 section 5.2.4) without touching empty segments,
+// so it can be used independently of collapsing slashes
+func resolveDotSegments(p string) string {
+	segments := strings.Split(p, "/")
+	out := make([]string, 0, len(segments))
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		switch seg {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			// never pop the leading empty segment of an absolute path
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+	resolved := strings.Join(out, "/")
+	if strings.HasPrefix(p, "/") && !strings.HasPrefix(resolved, "/") {
+		resolved = "/" + resolved
+	}
+	return resolved
+}
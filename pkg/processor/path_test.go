@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestNormalizePath(t *testing.T) {
+	cases := []struct {
+		transform string
+		in, want  string
+	}{
+		{config.PathCollapseSlashes, "//api///v1//users", "/api/v1/users"},
+		{config.PathCollapseSlashes, "/api//v1?next=//x", "/api/v1?next=//x"},
+		{config.PathResolveDots, "/api/v1/../v2/./users", "/api/v2/users"},
+		{config.PathResolveDots, "/../../etc", "/etc"},
+		{config.PathResolveDots, "/api/v1/..", "/api/"},
+		{config.PathResolveDots, "/api//v1", "/api//v1"},
+		{config.PathTrimTrailingSlash, "/api/v1/", "/api/v1"},
+		{config.PathTrimTrailingSlash, "/", "/"},
+		{config.PathTrimTrailingSlash, "/api/?q=1", "/api?q=1"},
+		{config.PathLowercase, "/API/Users?Name=Bob", "/api/users?Name=Bob"},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, normalizePath(c.in, []string{c.transform}), "%s of %q", c.transform, c.in)
+	}
+}
+
+func TestNormalizePathCombined(t *testing.T) {
+	all := []string{config.PathLowercase, config.PathTrimTrailingSlash, config.PathResolveDots, config.PathCollapseSlashes}
+	require.Equal(t, "/api/v2", normalizePath("//API/v1/..//V2/", all))
+	require.Equal(t, "/API//v1/", normalizePath("/API//v1/", nil))
+}
+
+func TestNormalizedPathUsedForDecisionKey(t *testing.T) {
+	setConfig(t, &config.PathNormalization, []string{config.PathCollapseSlashes, config.PathLowercase})
+
+	require.Equal(t, "example.com/api/users", decisionKey(config.FromEnv(), requestHeaders(":authority", "example.com", ":path", "//API/Users")))
+
+	setConfig(t, &config.DecisionKeyTemplate, "{:path}")
+	require.Equal(t, "/api/users", decisionKey(config.FromEnv(), requestHeaders(":path", "/api//users")))
+}
+
+func TestNormalizedPathWriteBack(t *testing.T) {
+	setConfig(t, &config.PathNormalization, []string{config.PathCollapseSlashes})
+	s := New(zap.NewNop())
+
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "foo", ":path", "/api//users"))
+	require.NoError(t, err)
+	require.Empty(t, setHeader(resp.Response.HeaderMutation, ":path"), "the path is only written back when enabled")
+
+	setConfig(t, &config.PathNormalizationWriteBack, true)
+	resp, err = s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "foo", ":path", "/api//users"))
+	require.NoError(t, err)
+	require.Equal(t, "/api/users", setHeader(resp.Response.HeaderMutation, ":path"))
+
+	// an already normal path is left alone
+	resp, err = s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "foo", ":path", "/api/users"))
+	require.NoError(t, err)
+	require.Empty(t, setHeader(resp.Response.HeaderMutation, ":path"))
+}
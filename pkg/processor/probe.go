@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// reachabilityProbe checks whether the decision server is reachable. Only a single probe runs at a time
+// regardless of how many streams ask and the result is reused for the probe interval.
+type reachabilityProbe struct {
+	url      string
+	interval time.Duration
+	timeout  time.Duration
+	// client returns the client for the URL, see transportPools.client
+	client func(rawURL string) *http.Client
+	log    *zap.Logger
+	now    func() time.Time
+
+	group     singleflight.Group
+	mu        sync.Mutex
+	checkedAt time.Time
+	reachable bool
+	// reachableSince is when the decision server became reachable, zero while it is unreachable
+	reachableSince time.Time
+}
+
+func newReachabilityProbe(log *zap.Logger, url string, interval, timeout time.Duration, client func(string) *http.Client) *reachabilityProbe {
+	return &reachabilityProbe{
+		url:      url,
+		interval: interval,
+		timeout:  timeout,
+		client:   client,
+		log:      log,
+		now:      time.Now,
+	}
+}
+
+func (p *reachabilityProbe) cached() (bool, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.checkedAt.IsZero() || p.now().Sub(p.checkedAt) >= p.interval {
+		return false, false
+	}
+	return p.reachable, true
+}
+
+// reachableFor reports how long the decision server has been reachable according to the probes so far, false when
+// the latest probe failed or there wasn't one yet
+func (p *reachabilityProbe) reachableFor() (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reachableSince.IsZero() {
+		return 0, false
+	}
+	return p.now().Sub(p.reachableSince), true
+}
+
+// check returns the cached result when it is still fresh, otherwise it probes the decision server
+func (p *reachabilityProbe) check(ctx context.Context) bool {
+	if reachable, ok := p.cached(); ok {
+		return reachable
+	}
+
+	ch := p.group.DoChan(p.url, func() (any, error) {
+		// another caller may have refreshed the result while we were waiting to probe
+		if reachable, ok := p.cached(); ok {
+			return reachable, nil
+		}
+		reachable := p.probe()
+
+		p.mu.Lock()
+		switch {
+		case !reachable:
+			p.reachableSince = time.Time{}
+		case !p.reachable:
+			p.reachableSince = p.now()
+		}
+		p.reachable = reachable
+		p.checkedAt = p.now()
+		p.mu.Unlock()
+		return reachable, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return false
+	case res := <-ch:
+		return res.Val.(bool)
+	}
+}
+
+// probe issues a HEAD request where anything short of a transport error or a 5xx counts as reachable
+func (p *reachabilityProbe) probe() bool {
+	if p.url == "" {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.url, nil)
+	if err != nil {
+		p.log.Debug("unable to build the reachability probe", zap.Error(err))
+		return false
+	}
+	resp, err := p.client(p.url).Do(req)
+	if err != nil {
+		p.log.Debug("decision server is unreachable", zap.String("url", p.url), zap.Error(err))
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
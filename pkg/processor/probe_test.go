@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func defaultClient(string) *http.Client {
+	return http.DefaultClient
+}
+
+// slowProbeServer records the total and the maximum number of concurrent probes it has seen
+type slowProbeServer struct {
+	calls, inFlight, maxInFlight atomic.Int32
+}
+
+func (p *slowProbeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.calls.Add(1)
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		m := p.maxInFlight.Load()
+		if n <= m || p.maxInFlight.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestProbeSingleFlight(t *testing.T) {
+	handler := &slowProbeServer{}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	p := newReachabilityProbe(zap.NewNop(), srv.URL, time.Minute, time.Second, defaultClient)
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.True(t, p.check(context.Background()))
+		}()
+	}
+	wg.Wait()
+
+	require.EqualValues(t, 1, handler.calls.Load())
+	require.EqualValues(t, 1, handler.maxInFlight.Load())
+}
+
+func TestProbeResultCachedForInterval(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	healthy.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	p := newReachabilityProbe(zap.NewNop(), srv.URL, 10*time.Second, time.Second, defaultClient)
+	p.now = func() time.Time { return now }
+
+	require.True(t, p.check(context.Background()))
+	healthy.Store(false)
+
+	now = now.Add(5 * time.Second)
+	require.True(t, p.check(context.Background()), "result should be reused within the interval")
+	require.EqualValues(t, 1, calls.Load())
+
+	now = now.Add(5 * time.Second)
+	require.False(t, p.check(context.Background()), "result should be refreshed after the interval")
+	require.EqualValues(t, 2, calls.Load())
+}
+
+func TestProbeTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer srv.Close()
+
+	p := newReachabilityProbe(zap.NewNop(), srv.URL, time.Minute, 50*time.Millisecond, defaultClient)
+	start := time.Now()
+	require.False(t, p.check(context.Background()))
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestProbeTrustsDecisionServerCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCAFile(t, caFile, srv)
+	setConfig(t, &config.DecisionServerCAFile, caFile)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+
+	require.True(t, New(zap.NewNop()).DecisionServerReachable(context.Background()))
+}
+
+func TestProbeSkippedWithoutHTTPProvider(t *testing.T) {
+	setConfig(t, &config.DecisionProvider, config.DecisionProviderGRPC)
+	setConfig(t, &config.DecisionGRPCServer, startDecisionService(t, &fakeDecisionService{decision: "foo"}))
+	setConfig(t, &config.RoutingDecisionServer, "")
+
+	require.True(t, New(zap.NewNop()).DecisionServerReachable(context.Background()), "there is no http decision server to probe")
+}
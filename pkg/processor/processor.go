@@ -1,142 +1,688 @@
 package processor
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/logging"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
 
 	core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
+// errStreamClosed is the cause of the stream context being cancelled because Envoy closed the stream
+var errStreamClosed = errors.New("stream closed by envoy")
+
 type RoutingDecision struct {
 	Decision string `json:"decision"`
+	// Candidates are picked from by weight instead of using Decision when present
+	Candidates []Candidate `json:"candidates,omitempty"`
+	// Action deny rejects the request instead of routing it
+	Action string `json:"action,omitempty"`
 }
 
 type ProcessingServer struct {
 	log *zap.Logger
+	// used for calls to the decision server so they can be logged at their own level
+	clientLog *zap.Logger
+	// swapped when a reload changes the cache settings, nil when caching is disabled
+	cache     atomic.Pointer[decisionCache]
+	reloadMu  sync.Mutex
+	cacheConf cacheSettings
+	// swapped when a reload changes the decision server
+	probe    atomic.Pointer[reachabilityProbe]
+	provider DecisionProvider
+	sources  *windowCounter
+	// swapped when a reload changes its settings, nil when the circuit breaker is disabled
+	breaker     atomic.Pointer[circuitBreaker]
+	breakerConf breakerSettings
+	transport   *transportPools
+	// the configuration given with WithConfig or SetConfig, see conf
+	cfg atomic.Pointer[config.Config]
+	// fixedConfig is set along with cfg, the package config is read otherwise
+	fixedConfig atomic.Bool
+	// settings overridden on New, empty or nil when the config default is used
+	decisionHeader     string
+	preferredSvcHeader string
+	decisionServer     string
+	decisionTimeout    *time.Duration
+	// the reloadable settings request phases snapshot
+	settings atomic.Pointer[requestSettings]
+	picker   *weightedPicker
+	// nil when auditing is disabled
+	audit *auditSink
+	// nil when tenants don't have their own decision servers
+	tenants *tenantServers
+	// swapped when a reload changes its settings, nil when decisions aren't batched
+	batcher   atomic.Pointer[decisionBatcher]
+	batchConf batchSettings
+	started   time.Time
+	tracer    trace.Tracer
+	// Process streams currently open
+	activeStreams atomic.Int64
 }
 
 type HealthServer struct {
 	Log *zap.Logger
+	// Processor is probed for the reachability of its decision server when the health check depends on it, its
+	// configuration is the one of the health check
+	Processor *ProcessingServer
+	// how often Watch recomputes the status, the probe interval when zero
+	watchInterval time.Duration
 }
 
-func New(log *zap.Logger) *ProcessingServer {
-	ps := &ProcessingServer{log: log}
+type Option func(*ProcessingServer)
+
+func New(log *zap.Logger, opts ...Option) *ProcessingServer {
+	clientLog := log.Named(logging.DecisionClient)
+	ps := &ProcessingServer{
+		log:       log,
+		clientLog: clientLog,
+		picker:    newProcessPicker(),
+		started:   time.Now(),
+		tracer:    otel.Tracer(tracerName),
+	}
+	for _, opt := range opts {
+		opt(ps)
+	}
+	conf := ps.conf()
+	ps.sources = newWindowCounter(conf.Decision.SourceWindow, decisionSourceBuckets)
+
+	tlsConf, err := currentTLSSettings(conf)
+	if err != nil {
+		log.Error("failed to read the decision server CA file, using the system roots", zap.Error(err))
+	}
+	ps.transport = newTransportPools(clientLog, conf.DecisionServer.Pool, conf.DecisionServer.Pools, tlsConf)
+	ps.cacheConf = currentCacheSettings(conf)
+	ps.cache.Store(ps.cacheConf.newCache())
+	if conf.Cache.WarmFile != "" {
+		ps.warmCache(conf.Cache.WarmFile, conf.Cache.WarmTTL)
+	}
+
+	if tenants := conf.TenantServers; tenants.File != "" {
+		ps.tenants = newTenantServers(clientLog, tenants.File, tenants.CheckInterval)
+	}
+
+	ps.batchConf = currentBatchSettings(conf)
+	ps.batcher.Store(ps.batchConf.newBatcher(ps.sendBatch))
+	ps.breakerConf = currentBreakerSettings(conf)
+	ps.breaker.Store(ps.breakerConf.newBreaker())
+
+	if conf.DebugResponses {
+		log.Warn("debug responses are enabled, rejections tell clients how requests are routed")
+	}
+	ps.provider = ps.newDecisionProvider(conf)
+	if audit := conf.Audit; len(audit.KafkaBrokers) > 0 {
+		ps.audit = newAuditSink(log, newKafkaAuditProducer(audit.KafkaBrokers, audit.KafkaTopic), audit.BufferSize, audit.BatchSize)
+	}
+
+	ps.settings.Store(ps.currentRequestSettings())
+	ps.probe.Store(ps.newProbe(ps.settings.Load().decisionServer, conf))
 	return ps
 }
 
+// WithConfig sets the configuration of the server instead of the package config, which also stops Reload from
+// re-reading the package config.
+func WithConfig(c *config.Config) Option {
+	return func(s *ProcessingServer) {
+		s.cfg.Store(c)
+		s.fixedConfig.Store(true)
+	}
+}
+
+// conf is the configuration in effect, the one given with WithConfig or the current package config
+func (s *ProcessingServer) conf() *config.Config {
+	if s.fixedConfig.Load() {
+		return s.cfg.Load()
+	}
+	return config.FromEnv()
+}
+
+// WithRoutingDecisionHeader overrides the name of the header the decision is set on, config.RoutingDecisionHeader
+// by default
+func WithRoutingDecisionHeader(name string) Option {
+	return func(s *ProcessingServer) {
+		s.decisionHeader = name
+	}
+}
+
+// WithPreferredSvcHeader overrides the name of the header a client prefers a service with, config.PreferredSvcHeader
+// by default. It is matched regardless of case.
+func WithPreferredSvcHeader(name string) Option {
+	return func(s *ProcessingServer) {
+		s.preferredSvcHeader = name
+	}
+}
+
+// WithDecisionServer overrides the URL of the decision server, config.RoutingDecisionServer by default
+func WithDecisionServer(url string) Option {
+	return func(s *ProcessingServer) {
+		s.decisionServer = url
+	}
+}
+
+// WithDecisionTimeout overrides the budget for fetching a decision including any retries,
+// config.RoutingDecisionTimeout by default. A timeout of 0 means no budget.
+func WithDecisionTimeout(d time.Duration) Option {
+	return func(s *ProcessingServer) {
+		s.decisionTimeout = &d
+	}
+}
+
+// Close publishes the buffered audit records, stops auditing and closes the connections of the decision provider,
+// such as the Redis client
+func (s *ProcessingServer) Close() error {
+	var errs []error
+	if s.audit != nil {
+		errs = append(errs, s.audit.close())
+	}
+	if c, ok := s.provider.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// DecisionServerReachable reports whether the decision server responded to the most recent reachability probe. It is
+// always reachable when the decision provider doesn't call the HTTP decision server, there is nothing to probe then.
+func (s *ProcessingServer) DecisionServerReachable(ctx context.Context) bool {
+	if !usesDecisionServer(s.provider) {
+		return true
+	}
+	return s.probe.Load().check(ctx)
+}
+
+// newProbe creates a reachability probe for the decision server going through the same transports as the calls, so
+// that it trusts the decision server CA file
+func (s *ProcessingServer) newProbe(server string, conf *config.Config) *reachabilityProbe {
+	return newReachabilityProbe(s.clientLog, server, conf.Probe.Interval, conf.Probe.Timeout, s.transport.client)
+}
+
+// resetState drops the state shared between streams
+func (s *ProcessingServer) resetState() {
+	if c := s.cache.Load(); c != nil {
+		c.reset()
+	}
+}
+
+// BreakerState returns the state of the circuit breaker around the decision server, closed when it is disabled
+func (s *ProcessingServer) BreakerState() BreakerState {
+	b := s.breaker.Load()
+	if b == nil {
+		return BreakerClosed
+	}
+	return b.current()
+}
+
+// cacheStats returns the hits and misses of the decision cache
+func (s *ProcessingServer) cacheStats() cacheStats {
+	c := s.cache.Load()
+	if c == nil {
+		return cacheStats{}
+	}
+	return c.stats()
+}
+
+// DumpCache returns up to limit cached decisions along with the total number of cached decisions
+func (s *ProcessingServer) DumpCache(limit int) ([]CacheEntry, int) {
+	c := s.cache.Load()
+	if c == nil {
+		return []CacheEntry{}, 0
+	}
+	return c.dump(limit)
+}
+
+// Check reports SERVING unless the health check depends on the decision server and it is unreachable. The probe
+// result is reused for the probe interval so health checks don't load the decision server.
 func (s *HealthServer) Check(ctx context.Context, in *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
 	s.Log.Debug("received health check request", zap.String("service", in.String()))
-	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+	if s.Processor != nil && s.Processor.conf().HealthCheck.Diagnostics {
+		if err := grpc.SetHeader(ctx, s.Processor.diagnostics()); err != nil {
+			s.Log.Debug("failed to set the diagnostics header", zap.Error(err))
+		}
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: s.servingStatus(ctx)}, nil
 }
 
+// Watch sends the current status straight away and then again whenever it changes, recomputing it the same way as
+// Check every probe interval until the client closes the stream.
 func (s *HealthServer) Watch(in *grpc_health_v1.HealthCheckRequest, srv grpc_health_v1.Health_WatchServer) error {
-	return status.Error(codes.Unimplemented, "watch is not implemented")
-}
+	s.Log.Debug("received health watch request", zap.String("service", in.String()))
+	interval := s.watchInterval
+	if interval <= 0 {
+		interval = config.ProbeInterval
+		if s.Processor != nil {
+			interval = s.Processor.conf().Probe.Interval
+		}
+	}
+	tck := time.NewTicker(interval)
+	defer tck.Stop()
 
-func (s *ProcessingServer) Process(srv ext_proc_v3.ExternalProcessor_ProcessServer) error {
 	ctx := srv.Context()
+	var last grpc_health_v1.HealthCheckResponse_ServingStatus
 	for {
+		if current := s.servingStatus(ctx); current != last {
+			if err := srv.Send(&grpc_health_v1.HealthCheckResponse{Status: current}); err != nil {
+				return err
+			}
+			last = current
+		}
 		select {
 		case <-ctx.Done():
-			s.log.Debug("processing server context done")
-			return ctx.Err()
-		default:
+			return nil
+		case <-tck.C:
 		}
+	}
+}
 
-		req, err := srv.Recv()
-		if err == io.EOF {
-			// envoy has closed the stream. Don't return anything and close this stream entirely
-			return nil
+func (s *HealthServer) servingStatus(ctx context.Context) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	if s.Processor != nil && s.Processor.conf().HealthCheck.Dependency && !s.Processor.DecisionServerReachable(ctx) {
+		s.Log.Debug("decision server is unreachable, reporting not serving")
+		return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+	return grpc_health_v1.HealthCheckResponse_SERVING
+}
+
+// Process handles the messages of a stream strictly one at a time, so responses go out in the order the messages
+// arrived even when a decision is slow and a later one would be quick, e.g. with requests reusing a connection. Reading
+// ahead (see receive) only ever holds on to the next message, it is never handled early.
+func (s *ProcessingServer) Process(srv ext_proc_v3.ExternalProcessor_ProcessServer) error {
+	s.activeStreams.Add(1)
+	defer s.activeStreams.Add(-1)
+	ctx, cancel := context.WithCancelCause(srv.Context())
+	defer cancel(nil)
+	// the whole stream uses the settings in effect when it started, so a reload only applies to new streams
+	ctx, rs := s.withRequestSettings(ctx)
+	conf := rs.conf
+	onEOF := func() {}
+	if conf.Stream.CancelDecisionOnClose {
+		// aborts any decision still in flight when envoy closes the stream
+		onEOF = func() { cancel(errStreamClosed) }
+	}
+	recvCh := receive(ctx, srv, onEOF)
+	st := &streamState{}
+	// started once the request headers, which may carry the trace context, arrive
+	var span trace.Span
+	defer func() {
+		if span != nil {
+			endStreamSpan(span, st)
 		}
-		if err != nil {
-			return status.Errorf(codes.Unknown, "cannot receive stream request: %v", err)
+	}()
+	for {
+		var req *ext_proc_v3.ProcessingRequest
+		select {
+		case <-ctx.Done():
+			if errors.Is(context.Cause(ctx), errStreamClosed) {
+				return nil
+			}
+			s.logFor(st).Debug("processing server context done")
+			return ctx.Err()
+		case r := <-recvCh:
+			if r.err == io.EOF {
+				// envoy has closed the stream. Don't return anything and close this stream entirely
+				return nil
+			}
+			if r.err != nil {
+				return status.Errorf(codes.Unknown, "cannot receive stream request: %v", r.err)
+			}
+			req = r.req
+		}
+		if st.awaitingBody && req.GetRequestBody() == nil {
+			// e.g. envoy doesn't allow the mode override, the request went on without a decision
+			s.logFor(st).Warn("request body did not arrive, the request was not routed on it")
+			st.awaitingBody = false
 		}
 
 		// build response based on request type
 		resp := &ext_proc_v3.ProcessingResponse{}
 		switch v := req.Request.(type) {
 		case *ext_proc_v3.ProcessingRequest_RequestHeaders:
-			s.log.Debug("got RequestHeaders")
+			s.logFor(st).Debug("got RequestHeaders")
+			st.requestStart = time.Now()
 			h := req.Request.(*ext_proc_v3.ProcessingRequest_RequestHeaders)
-			headersResp, err := s.generateRoutingDecision(h.RequestHeaders)
+			if span == nil {
+				ctx, span = s.startStreamSpan(ctx, h.RequestHeaders)
+			}
+			st.log = requestLogger(conf, s.log, h.RequestHeaders)
+			st.startRequest(h.RequestHeaders, awaitBody(conf, h.RequestHeaders))
+			headersResp, err := s.generateRoutingDecision(ctx, st, h.RequestHeaders)
+			if errors.Is(context.Cause(ctx), errStreamClosed) {
+				s.logFor(st).Debug("stream closed while deciding, dropping the routing decision")
+				return nil
+			}
+			var rej *rejection
+			if errors.As(err, &rej) {
+				resp = rejectionResponse(conf, rej, st, h.RequestHeaders)
+				break
+			}
 			if err != nil {
 				return err
 			}
+			if header := conf.Headers.Correlation; header != "" && headersResp.GetResponse().GetHeaderMutation() != nil {
+				st.correlationID = uuid.NewString()
+				headersResp.Response.HeaderMutation.SetHeaders = append(headersResp.Response.HeaderMutation.SetHeaders, setHeaderOption(conf, header, st.correlationID))
+			}
+			if start := conf.RequestStart; start.Header != "" {
+				// the stamp is added whether or not a decision was applied
+				addSetHeader(headersResp, setHeaderOption(conf, start.Header, formatTimestamp(st.requestStart, start.Format)))
+			}
 			resp = &ext_proc_v3.ProcessingResponse{
 				Response: &ext_proc_v3.ProcessingResponse_RequestHeaders{
 					RequestHeaders: headersResp,
 				},
 			}
+			if conf.DynamicMetadata.Namespace != "" && st.source != "" {
+				resp.DynamicMetadata = decisionMetadata(conf, st, h.RequestHeaders, time.Since(st.requestStart))
+			}
+			resp.ModeOverride = modeOverride(conf, st.awaitingBody)
 
 		case *ext_proc_v3.ProcessingRequest_RequestBody:
-			s.log.Debug("got RequestBody (not currently implemented)")
+			s.logFor(st).Debug("got RequestBody")
+			bodyResp, err := s.handleRequestBody(ctx, st, v.RequestBody)
+			if errors.Is(context.Cause(ctx), errStreamClosed) {
+				s.logFor(st).Debug("stream closed while deciding, dropping the routing decision")
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			resp = bodyResp
 
 		case *ext_proc_v3.ProcessingRequest_RequestTrailers:
-			s.log.Debug("got RequestTrailers (not currently implemented)")
+			s.logFor(st).Debug("got RequestTrailers")
+			resp = &ext_proc_v3.ProcessingResponse{
+				Response: &ext_proc_v3.ProcessingResponse_RequestTrailers{
+					RequestTrailers: s.generateTrailersDecision(ctx, st, v.RequestTrailers),
+				},
+			}
 
 		case *ext_proc_v3.ProcessingRequest_ResponseHeaders:
-			s.log.Debug("got ResponseHeaders (not currently implemented)")
+			s.logFor(st).Debug("got ResponseHeaders")
+			resp = &ext_proc_v3.ProcessingResponse{
+				Response: &ext_proc_v3.ProcessingResponse_ResponseHeaders{
+					ResponseHeaders: s.generateResponseHeaderMutation(ctx, st),
+				},
+			}
 
 		case *ext_proc_v3.ProcessingRequest_ResponseBody:
-			s.log.Debug("got ResponseBody (not currently implemented)")
+			s.logFor(st).Debug("got ResponseBody")
+			resp = &ext_proc_v3.ProcessingResponse{
+				Response: &ext_proc_v3.ProcessingResponse_ResponseBody{
+					ResponseBody: s.annotateResponseBody(conf, st, v.ResponseBody),
+				},
+			}
 
 		case *ext_proc_v3.ProcessingRequest_ResponseTrailers:
-			s.log.Debug("got ResponseTrailers (not currently handled)")
+			s.logFor(st).Debug("got ResponseTrailers (not currently handled)")
 
 		default:
-			s.log.Error("unknown Request type", zap.Any("v", v))
+			if conf.Stream.OnUnknownRequestType == config.UnknownRequestTypeError {
+				s.logFor(st).Error("unknown Request type, closing the stream", zap.Any("v", v))
+				return status.Errorf(codes.InvalidArgument, "unknown request type %T", v)
+			}
+			s.logFor(st).Debug("ignoring unknown Request type", zap.Any("v", v))
 		}
 
-		s.log.Info("sending ProcessingResponse")
-		if err := srv.Send(resp); err != nil {
-			s.log.Error("send error", zap.Error(err))
+		s.logFor(st).Info("sending ProcessingResponse")
+		s.observeMutationSize(conf, resp)
+		if err := s.send(ctx, conf, srv, resp); err != nil {
+			s.logFor(st).Error("send error", zap.Error(err))
 			return err
 		}
 
 	}
 }
 
+type recvResult struct {
+	req *ext_proc_v3.ProcessingRequest
+	err error
+}
+
+// receive reads the stream in the background so that processing can wait on other events at the same time.
+// onEOF is called as soon as envoy closes the stream, even when processing is busy and not reading the channel.
+func receive(ctx context.Context, srv ext_proc_v3.ExternalProcessor_ProcessServer, onEOF func()) <-chan recvResult {
+	ch := make(chan recvResult)
+	go func() {
+		for {
+			req, err := srv.Recv()
+			if err == io.EOF {
+				onEOF()
+			}
+			select {
+			case ch <- recvResult{req: req, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
 // look at the preferred svc header value so we can take a short-circuiting routing decision from the list of headers
-func (s *ProcessingServer) getPreferredSvcFromHeaders(in *ext_proc_v3.HttpHeaders) string {
+// also reports whether the header was present at all since a present but empty value can carry intent
+func (s *ProcessingServer) getPreferredSvcFromHeaders(rs *requestSettings, in *ext_proc_v3.HttpHeaders) (string, bool) {
+	for _, n := range in.Headers.Headers {
+		// header names are case insensitive whatever the case of the configured name
+		if strings.EqualFold(n.Key, rs.preferredSvcHeader) {
+			return string(n.RawValue), true
+		}
+	}
+	return "", false
+}
+
+// headerName normalizes a header name for lookups and emission. With conf.Headers.Lowercase names are lowercased like
+// Envoy does, otherwise they are used exactly as given.
+func headerName(conf *config.Config, name string) string {
+	if conf.Headers.Lowercase {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// hasHeader reports whether the request carries the header, even with an empty value
+func hasHeader(conf *config.Config, in *ext_proc_v3.HttpHeaders, key string) bool {
+	key = headerName(conf, key)
 	for _, n := range in.Headers.Headers {
-		if strings.ToLower(n.Key) == config.PreferredSvcHeader {
+		if headerName(conf, n.Key) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func getHeaderValue(conf *config.Config, in *ext_proc_v3.HttpHeaders, key string) string {
+	key = headerName(conf, key)
+	for _, n := range in.Headers.Headers {
+		if headerName(conf, n.Key) == key {
 			return string(n.RawValue)
 		}
 	}
 	return ""
 }
 
-func (s *ProcessingServer) generateRoutingDecision(in *ext_proc_v3.HttpHeaders) (*ext_proc_v3.HeadersResponse, error) {
-	header := s.getPreferredSvcFromHeaders(in)
+// generateRoutingDecision decides where the request is routed and records the applied decision in the stream state
+func (s *ProcessingServer) generateRoutingDecision(ctx context.Context, st *streamState, in *ext_proc_v3.HttpHeaders) (*ext_proc_v3.HeadersResponse, error) {
+	ctx, rs := s.withRequestSettings(withClientLog(ctx, st))
+	conf := rs.conf
+	if required := conf.RequiredHeader; required.Name != "" && !hasHeader(conf, in, required.Name) {
+		s.logFor(st).Debug("required header is missing, rejecting the request", zap.String("header", required.Name))
+		return nil, reject(ruleRequiredHeader, required.Status, fmt.Sprintf("the %s header is required", headerName(conf, required.Name)))
+	}
+	header, present := s.getPreferredSvcFromHeaders(rs, in)
+	if legacy := conf.Headers.LegacyPreferredSvc; !present && legacy != "" && hasHeader(conf, in, legacy) {
+		header, present = getHeaderValue(conf, in, legacy), true
+		st.legacyPreferredSvc = true
+	}
+	st.preferredSvc = header
+	if header != "" && slices.Contains(conf.DeniedServices.Services, header) {
+		s.logFor(st).Debug("preferred svc is denied, rejecting the request", zap.String("service", header))
+		return nil, &rejection{problem: Problem{Status: conf.DeniedServices.Status, Detail: conf.DeniedServices.Detail}, rule: ruleDeniedService, source: sourceHeader}
+	}
+	if present && header == "" && conf.Decision.EmptyPreferredSvcNoDecision {
+		// the client explicitly asked for no routing decision
+		s.logFor(st).Debug("preferred svc header is empty, skipping routing decision")
+		s.recordSource(st, sourceFallback)
+		return &ext_proc_v3.HeadersResponse{}, nil
+	}
+
+	ctx, roll := withWeightedRoll(ctx)
 
+	source := sourceHeader
+	if header == "" && st.awaitingBody {
+		// decided once the whole body has arrived, see handleRequestBody
+		s.logFor(st).Debug("deferring the routing decision to the request body")
+		return &ext_proc_v3.HeadersResponse{}, nil
+	}
+	st.awaitingBody = false
+	if header == "" && st.bodyDecision != "" {
+		header, source = st.bodyDecision, sourceBody
+	}
+	if header == "" {
+		if decision, ok := stickyWebSocketDecision(conf, in); ok {
+			s.logFor(st).Debug("routing the websocket upgrade by its session", zap.String("decision", decision))
+			header, source = decision, sourceSticky
+		}
+	}
 	if header == "" {
+		key := decisionKey(conf, in)
+		cache := s.cache.Load()
+		if cache != nil {
+			if decision, ok := cache.get(key); ok {
+				s.logFor(st).Debug("using cached routing decision", zap.String("key", key))
+				st.cacheOutcome = cacheHit
+				return s.applyDecision(rs, st, in, decision, sourceCache)
+			}
+			st.cacheOutcome = cacheMiss
+		}
+
 		// let's call the outbound service for any routing decisions
-		decision, err := s.fetchRoutingDecision()
+		decision, err := s.provider.Decide(ctx, DecisionRequest{Key: key, Headers: in, Timeout: s.currentCallLimits(ctx).timeout, Config: conf})
 		if err != nil {
-			s.log.Error("failed to fetch routing decision", zap.Error(err))
+			if errors.Is(context.Cause(ctx), errStreamClosed) {
+				metrics.Decisions.WithLabelValues("cancelled").Inc()
+				s.logFor(st).Debug("routing decision cancelled as the stream was closed", zap.Error(err))
+				return &ext_proc_v3.HeadersResponse{}, err
+			}
+			var rej *rejection
+			if errors.As(err, &rej) && rej.rule == ruleCircuitBreakerOpen {
+				// expected while the decision server recovers, the failures which tripped the breaker were logged
+				metrics.Decisions.WithLabelValues("breaker_open").Inc()
+				s.logFor(st).Debug("circuit breaker is open, rejecting the request")
+				return nil, rej
+			}
+			metrics.Decisions.WithLabelValues("failure").Inc()
+			s.logFor(st).Error("failed to fetch routing decision", zap.Error(err))
+			if errors.As(err, &rej) {
+				// the request is rejected on purpose rather than failing open
+				return nil, rej
+			}
+			if conf.DefaultDecision != "" {
+				return s.applyDecision(rs, st, in, conf.DefaultDecision, sourceFallback)
+			}
 			return &ext_proc_v3.HeadersResponse{}, err
-		} else if decision == "" {
+		}
+		metrics.Decisions.WithLabelValues("success").Inc()
+		if decision == "" {
+			s.logFor(st).Error("no decision is present")
+			if conf.DefaultDecision != "" {
+				return s.applyDecision(rs, st, in, conf.DefaultDecision, sourceFallback)
+			}
 			// let's just fall through
-			s.log.Error("no decision is present")
+			s.recordSource(st, sourceFallback)
 			return &ext_proc_v3.HeadersResponse{}, nil
 		}
 		header = decision
+		source = sourceExternal
+		// a pick from candidates is rolled again for every request, caching it would send all of them to the same one
+		if cache != nil && roll.total == 0 {
+			cache.set(key, decision)
+		}
+	}
+
+	resp, err := s.applyDecision(rs, st, in, header, source)
+	if err == nil && conf.DebugResponses && conf.Headers.WeightedRoll != "" && roll.total > 0 && resp.GetResponse().GetHeaderMutation() != nil {
+		// lets the pick be reproduced offline, see pickAt
+		addSetHeader(resp, setHeaderOption(conf, conf.Headers.WeightedRoll, roll.String()))
+	}
+	return resp, err
+}
+
+// applyDecision builds the response applying the decision unless the request is outside the mutation rollout.
+// Decisions routing to an upstream which isn't allowed fall back to no decision or reject the request.
+// The source the decision came from is recorded unless the request is rejected.
+func (s *ProcessingServer) applyDecision(rs *requestSettings, st *streamState, in *ext_proc_v3.HttpHeaders, decision, source string) (*ext_proc_v3.HeadersResponse, error) {
+	conf := rs.conf
+	if !upstreamAllowed(decision, conf.Decision.AllowedUpstreamHosts) {
+		s.logFor(st).Warn("decision routes to an upstream which isn't allowed", zap.String("decision", decision), zap.String("action", conf.Decision.DisallowedUpstreamAction))
+		if conf.Decision.DisallowedUpstreamAction == config.DisallowedUpstreamDeny {
+			return nil, &rejection{problem: Problem{Status: http.StatusForbidden, Detail: "the routing decision is not an allowed upstream"}, rule: ruleDisallowedUpstream, source: source}
+		}
+		s.recordSource(st, sourceFallback)
+		return &ext_proc_v3.HeadersResponse{}, nil
+	}
+	s.recordSource(st, source)
+	if header := conf.Headers.CurrentRoute; header != "" && getHeaderValue(conf, in, header) == formatDecision(rs.decisionFormat, decision) {
+		// envoy already routes there, so neither setting the decision header nor clearing the route cache would change
+		// anything, the preferred service header is still dropped so it doesn't reach the upstream
+		s.logFor(st).Debug("decision matches the current route, skipping the mutation", zap.String("decision", decision))
+		st.applied(decision, time.Now())
+		return &ext_proc_v3.HeadersResponse{
+			Response: &ext_proc_v3.CommonResponse{
+				Status: ext_proc_v3.CommonResponse_CONTINUE,
+				HeaderMutation: &ext_proc_v3.HeaderMutation{
+					RemoveHeaders: []string{headerName(conf, rs.preferredSvcHeader)},
+				},
+			},
+		}, nil
+	}
+
+	resp, applied := s.applyRollout(rs, in, decision, s.buildRoutingDecisionResponse(rs, in, decision))
+	if applied {
+		now := time.Now()
+		st.applied(decision, now)
+		metrics.AppliedDecisions.WithLabelValues(decisionLabel(conf, decision), source).Inc()
+		if s.audit != nil {
+			s.audit.enqueue(AuditRecord{
+				Time:      now,
+				Decision:  decision,
+				Source:    source,
+				RequestID: getHeaderValue(conf, in, "x-request-id"),
+				Authority: getHeaderValue(conf, in, ":authority"),
+				Path:      getHeaderValue(conf, in, ":path"),
+			})
+		}
 	}
+	return resp, nil
+}
 
+func (s *ProcessingServer) buildRoutingDecisionResponse(rs *requestSettings, in *ext_proc_v3.HttpHeaders, header string) *ext_proc_v3.HeadersResponse {
+	conf := rs.conf
 	// build the response
 	resp := &ext_proc_v3.HeadersResponse{
 		Response: &ext_proc_v3.CommonResponse{},
@@ -146,29 +692,116 @@ func (s *ProcessingServer) generateRoutingDecision(in *ext_proc_v3.HttpHeaders)
 
 	resp.Response.HeaderMutation = &ext_proc_v3.HeaderMutation{
 		SetHeaders: []*core_v3.HeaderValueOption{
-			{
-				Header: &core_v3.HeaderValue{
-					Key:      config.RoutingDecisionHeader,
-					RawValue: []byte(header),
-				},
-				AppendAction: core_v3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD,
-			},
+			setHeaderOption(conf, rs.decisionHeader, formatDecision(rs.decisionFormat, header)),
 		},
 		RemoveHeaders: []string{
-			config.PreferredSvcHeader,
+			headerName(conf, rs.preferredSvcHeader),
 		},
 	}
 
-	// clear the route cache
-	resp.Response.ClearRouteCache = true
+	// clear the route cache so envoy routes on the decision header
+	resp.Response.ClearRouteCache = conf.Mutation.ClearRouteCache
 
-	return resp, nil
+	if token := conf.Decision.Token; token.Enabled {
+		signed, err := signDecisionToken([]byte(token.Key), header, getHeaderValue(conf, in, "x-request-id"), time.Now())
+		if err != nil {
+			s.log.Error("unable to sign the decision token", zap.Error(err))
+		} else {
+			resp.Response.HeaderMutation.SetHeaders = append(resp.Response.HeaderMutation.SetHeaders, setHeaderOption(conf, token.Header, signed))
+		}
+	}
+
+	if conf.PathNormalization.WriteBack {
+		if path := requestPath(conf, in); path != getHeaderValue(conf, in, ":path") {
+			resp.Response.HeaderMutation.SetHeaders = append(resp.Response.HeaderMutation.SetHeaders, &core_v3.HeaderValueOption{
+				Header:       &core_v3.HeaderValue{Key: ":path", RawValue: []byte(path)},
+				AppendAction: core_v3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			})
+		}
+	}
+
+	if conf.Mutation.HostRewrite {
+		if isValidHost(header) {
+			resp.Response.HeaderMutation.SetHeaders = append(resp.Response.HeaderMutation.SetHeaders, &core_v3.HeaderValueOption{
+				Header:       &core_v3.HeaderValue{Key: ":authority", RawValue: []byte(header)},
+				AppendAction: core_v3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+			})
+			resp.Response.ClearRouteCache = conf.Mutation.HostRewriteClearRouteCache
+		} else {
+			s.log.Warn("decision is not a valid host, skipping host rewrite", zap.String("decision", header))
+		}
+	}
+
+	return resp
+}
+
+// generateResponseHeaderMutation tells the client which decision was applied earlier in the stream and echoes the
+// correlation id, dropping the content length of a response body which is annotated. When neither is known the
+// response headers are passed through with a no-op CONTINUE.
+func (s *ProcessingServer) generateResponseHeaderMutation(ctx context.Context, st *streamState) *ext_proc_v3.HeadersResponse {
+	conf := s.confFor(ctx)
+	resp := &ext_proc_v3.HeadersResponse{
+		Response: &ext_proc_v3.CommonResponse{Status: ext_proc_v3.CommonResponse_CONTINUE},
+	}
+
+	var headers []*core_v3.HeaderValueOption
+	if st.decision != "" {
+		headers = append(headers, setHeaderOption(conf, config.RoutingDecisionAppliedHeader, st.decision))
+	}
+	if st.correlationID != "" {
+		headers = append(headers, setHeaderOption(conf, conf.Headers.Correlation, st.correlationID))
+	}
+	if cache := conf.Cache; cache.HeaderEnabled && st.cacheOutcome != "" {
+		headers = append(headers, setHeaderOption(conf, cache.Header, st.cacheOutcome))
+	}
+	if deprecation := conf.LegacyPreferredSvcDeprecation; deprecation.Enabled && st.legacyPreferredSvc {
+		// nudges the client to move off the legacy header. Deprecation is the structured date of RFC 9745, which has no
+		// room for a message, so it is carried by a 299 Warning: RFC 9111 obsoletes the header but clients such as
+		// kubectl still surface it for this very purpose.
+		headers = append(headers,
+			setHeaderOption(conf, "deprecation", fmt.Sprintf("@%d", deprecation.Date.Unix())),
+			setHeaderOption(conf, "warning", fmt.Sprintf("299 - %q", deprecation.Warning)))
+	}
+	if len(headers) > 0 {
+		resp.Response.HeaderMutation = &ext_proc_v3.HeaderMutation{SetHeaders: headers}
+	}
+	if conf.AnnotateResponseBody.Enabled && st.decision != "" {
+		// the annotated body no longer matches the length sent by the upstream
+		if resp.Response.HeaderMutation == nil {
+			resp.Response.HeaderMutation = &ext_proc_v3.HeaderMutation{}
+		}
+		resp.Response.HeaderMutation.RemoveHeaders = append(resp.Response.HeaderMutation.RemoveHeaders, "content-length")
+	}
+	return resp
 }
 
-func (s *ProcessingServer) doExternalServiceCall(url string, rc chan *http.Response) error {
-	s.log.Debug("calling the external service", zap.String("url", url))
+// addSetHeader adds the header to the mutation of the response, turning an empty response into a CONTINUE
+func addSetHeader(resp *ext_proc_v3.HeadersResponse, h *core_v3.HeaderValueOption) {
+	if resp.Response == nil {
+		resp.Response = &ext_proc_v3.CommonResponse{Status: ext_proc_v3.CommonResponse_CONTINUE}
+	}
+	if resp.Response.HeaderMutation == nil {
+		resp.Response.HeaderMutation = &ext_proc_v3.HeaderMutation{}
+	}
+	resp.Response.HeaderMutation.SetHeaders = append(resp.Response.HeaderMutation.SetHeaders, h)
+}
+
+func setHeaderOption(conf *config.Config, key string, value string) *core_v3.HeaderValueOption {
+	return &core_v3.HeaderValueOption{
+		Header: &core_v3.HeaderValue{
+			Key:      headerName(conf, key),
+			RawValue: []byte(value),
+		},
+		AppendAction: core_v3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD,
+	}
+}
 
-	resp, err := http.Get(url)
+// doExternalServiceCall pushes the response on success and always closes rc so a receiver never blocks
+func (s *ProcessingServer) doExternalServiceCall(ctx context.Context, method, url string, header http.Header, body []byte, rc chan *http.Response) error {
+	defer close(rc)
+	s.clientLogFor(ctx).Debug("calling the external service", zap.String("method", method), zap.String("url", url))
+
+	resp, err := s.doWithRetry(ctx, method, url, header, body)
 
 	if err == nil {
 		rc <- resp
@@ -177,34 +810,148 @@ func (s *ProcessingServer) doExternalServiceCall(url string, rc chan *http.Respo
 	return err
 }
 
-func (s *ProcessingServer) fetchRoutingDecision() (string, error) {
-	if config.RoutingDecisionServer == "" {
+// outboundHeaders are the headers sent along with the decision server request
+func (s *ProcessingServer) outboundHeaders(ctx context.Context, key string) http.Header {
+	conf := s.confFor(ctx)
+	header := http.Header{}
+	if conf.Decision.KeyTemplate != "" {
+		header.Set(conf.Headers.DecisionKey, key)
+	}
+	if conf.Headers.PeerAddress != "" {
+		if addr := peerAddress(ctx); addr != "" {
+			header.Set(conf.Headers.PeerAddress, addr)
+		}
+	}
+	return header
+}
+
+// peerAddress returns the IP of the Envoy instance on the other end of the stream. Unix socket peers have no address.
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil || p.Addr.Network() == "unix" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// fetchRoutingDecision asks the decision server. While the circuit breaker is open the call is skipped and there is
+// no decision, or the request is rejected when the circuit breaker open action is reject.
+func (s *ProcessingServer) fetchRoutingDecision(ctx context.Context, key string, in *ext_proc_v3.HttpHeaders) (decision string, err error) {
+	ctx, span := s.tracer.Start(ctx, "fetchRoutingDecision", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, err.Error())
+		} else if decision != "" {
+			span.SetAttributes(attrDecision.String(decision))
+		}
+		span.End()
+	}()
+	_, rs := s.withRequestSettings(ctx)
+	server := rs.decisionServer
+	if s.tenants != nil {
+		if tenantServer, ok := s.tenants.server(getHeaderValue(rs.conf, in, rs.conf.Headers.Tenant)); ok {
+			server = tenantServer
+		}
+	}
+	if server == "" {
 		err := fmt.Errorf("routing decision server has not been configured")
-		s.log.Error("unable to get the routing decision from external service", zap.Error(err))
+		s.clientLogFor(ctx).Error("unable to get the routing decision from external service", zap.Error(err))
 		return "", err
 	}
+	breaker := s.breaker.Load()
+	if breaker == nil {
+		return s.callDecisionServer(ctx, server, key, in)
+	}
+
+	if !breaker.allow() {
+		s.clientLogFor(ctx).Debug("circuit breaker is open, skipping the decision server")
+		if rs.conf.CircuitBreaker.OpenAction == config.CircuitBreakerOpenReject {
+			return "", breakerOpenRejection(breaker, rs.conf)
+		}
+		return "", nil
+	}
+	decision, err = s.callDecisionServer(ctx, server, key, in)
+	var rej *rejection
+	switch {
+	case err == nil, errors.As(err, &rej):
+		// the decision server answered even if it was to deny the request
+		breaker.success()
+	case ctx.Err() != nil:
+		// the caller gave up which says nothing about the decision server
+		breaker.abandon()
+	default:
+		breaker.failure()
+	}
+	return decision, err
+}
+
+func (s *ProcessingServer) callDecisionServer(ctx context.Context, server, key string, in *ext_proc_v3.HttpHeaders) (string, error) {
+	// the budget covers every attempt as well as reading the response
+	if timeout := s.currentCallLimits(ctx).timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if batcher := s.batcher.Load(); batcher != nil {
+		return s.batchedDecision(ctx, batcher, server, key, in)
+	}
+
+	conf := s.confFor(ctx)
+	u, err := decisionURL(conf, server, in)
+	if err != nil {
+		return "", fmt.Errorf("invalid routing decision server: %w", err)
+	}
+	method := conf.DecisionServer.Method
+	var body []byte
+	if method == http.MethodPost {
+		if body, err = headersBody(conf, in); err != nil {
+			return "", err
+		}
+	}
 
 	start := time.Now()
 
+	header := s.outboundHeaders(ctx, key)
 	rChan := make(chan *http.Response, 1)
 	errGrp, _ := errgroup.WithContext(context.Background())
-	errGrp.Go(func() error { return s.doExternalServiceCall(config.RoutingDecisionServer, rChan) })
-	err := errGrp.Wait()
-	if err != nil {
-		s.log.Sugar().Errorf("unable to get the routing decision from external service %s: %v", config.RoutingDecisionServer, zap.Error(err))
+	errGrp.Go(func() error {
+		return s.doExternalServiceCall(ctx, method, u, header, body, rChan)
+	})
+	if err := errGrp.Wait(); err != nil {
+		observeDecisionCall(start, err, 0)
+		s.clientLogFor(ctx).Error("unable to get the routing decision from external service", zap.String("url", server), zap.Error(err))
+		return "", err
+	}
+	resp, ok := <-rChan
+	if !ok || resp == nil {
+		return "", fmt.Errorf("no response from the routing decision server %s", server)
 	}
-	resp := <-rChan
 	defer resp.Body.Close()
+	observeDecisionCall(start, nil, resp.StatusCode)
 
 	end := time.Now()
 	duration := end.Sub(start)
-	s.log.Debug("fetching took", zap.Duration("duration", duration))
+	s.clientLogFor(ctx).Debug("fetching took", zap.Duration("duration", duration))
 
-	var decisionResp RoutingDecision
-	err = json.NewDecoder(resp.Body).Decode(&decisionResp)
-	if err != nil {
-		s.log.Error("error decoding response from external service", zap.Error(err))
+	var respBody io.Reader = resp.Body
+	var sampled *bytes.Buffer
+	if sampleExchange(conf) {
+		sampled = &bytes.Buffer{}
+		respBody = io.TeeReader(resp.Body, sampled)
+	}
+	decision, err := s.decodeDecision(ctx, respBody)
+	var rej *rejection
+	if err != nil && !errors.As(err, &rej) {
+		s.clientLogFor(ctx).Error("error decoding response from external service", zap.Error(err))
+	}
+	if sampled != nil {
+		s.logExchange(conf, s.clientLogFor(ctx), method, u, header, body, resp.StatusCode, sampled.Bytes())
 	}
 
-	return decisionResp.Decision, err
+	return decision, err
 }
@@ -0,0 +1,318 @@
+package processor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc_filter_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func requestHeaders(kv ...string) *ext_proc_v3.HttpHeaders {
+	headers := &core_v3.HeaderMap{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		headers.Headers = append(headers.Headers, &core_v3.HeaderValue{Key: kv[i], RawValue: []byte(kv[i+1])})
+	}
+	return &ext_proc_v3.HttpHeaders{Headers: headers}
+}
+
+func decisionServer(t *testing.T, decision string) *httptest.Server {
+	srv, _ := countingDecisionServer(t, decision)
+	return srv
+}
+
+// countingDecisionServer responds with the decision and counts how many times it has been called
+func countingDecisionServer(t *testing.T, decision string) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"decision":"` + decision + `"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// setConfig overrides a config value for the duration of the test
+func setConfig[T any](t *testing.T, v *T, value T) {
+	prev := *v
+	*v = value
+	t.Cleanup(func() { *v = prev })
+}
+
+// decisionHeader returns the routing decision set by the response or an empty string when nothing is set
+func decisionHeader(resp *ext_proc_v3.HeadersResponse) string {
+	return setHeader(resp.GetResponse().GetHeaderMutation(), config.RoutingDecisionHeader)
+}
+
+func TestPreferredSvcHeaderShortCircuits(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+
+	s := New(zap.NewNop())
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("Preferred-Svc", "foo"))
+	require.NoError(t, err)
+	require.Equal(t, "foo", decisionHeader(resp))
+	require.True(t, resp.Response.ClearRouteCache)
+	require.Equal(t, []string{config.PreferredSvcHeader}, resp.Response.HeaderMutation.RemoveHeaders)
+	require.Zero(t, calls.Load())
+}
+
+func TestClearRouteCache(t *testing.T) {
+	for _, clear := range []bool{true, false} {
+		setConfig(t, &config.ClearRouteCache, clear)
+
+		resp, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "foo"))
+		require.NoError(t, err)
+		require.Equal(t, &ext_proc_v3.CommonResponse{
+			Status: ext_proc_v3.CommonResponse_CONTINUE,
+			HeaderMutation: &ext_proc_v3.HeaderMutation{
+				SetHeaders:    []*core_v3.HeaderValueOption{setHeaderOption(config.FromEnv(), config.RoutingDecisionHeader, "foo")},
+				RemoveHeaders: []string{config.PreferredSvcHeader},
+			},
+			ClearRouteCache: clear,
+		}, resp.GetResponse())
+	}
+}
+
+func TestModeOverrideSkipsUnhandledPhases(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+	mode := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo")).GetModeOverride()
+	require.NotNil(t, mode)
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_NONE, mode.GetRequestBodyMode())
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_SKIP, mode.GetRequestTrailerMode())
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_NONE, mode.GetResponseBodyMode())
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_SKIP, mode.GetResponseTrailerMode())
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_DEFAULT, mode.GetResponseHeaderMode(), "response headers are still processed")
+
+	setConfig(t, &config.SkipUnhandledPhases, false)
+	require.Nil(t, h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo")).GetModeOverride())
+}
+
+func TestModeOverrideStreamsRequestBody(t *testing.T) {
+	setConfig(t, &config.BodyProcessingMode, config.BodyProcessingStreamed)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	mode := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo")).GetModeOverride()
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_STREAMED, mode.GetRequestBodyMode())
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_NONE, mode.GetResponseBodyMode(), "the other unhandled phases are still skipped")
+
+	setConfig(t, &config.SkipUnhandledPhases, false)
+	mode = h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo")).GetModeOverride()
+	require.Equal(t, &ext_proc_filter_v3.ProcessingMode{RequestBodyMode: ext_proc_filter_v3.ProcessingMode_STREAMED}, mode)
+}
+
+func TestEmptyPreferredSvcFallsThrough(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.EmptyPreferredSvcNoDecision, false)
+
+	s := New(zap.NewNop())
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", ""))
+	require.NoError(t, err)
+	require.Equal(t, "external", decisionHeader(resp))
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestEmptyPreferredSvcMeansNoDecision(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.EmptyPreferredSvcNoDecision, true)
+
+	s := New(zap.NewNop())
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", ""))
+	require.NoError(t, err)
+	require.Nil(t, resp.Response)
+	require.Zero(t, calls.Load())
+
+	// an absent header still calls the external service
+	resp, err = s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":path", "/"))
+	require.NoError(t, err)
+	require.Equal(t, "external", decisionHeader(resp))
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestPeerAddress(t *testing.T) {
+	tcp := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 43210}})
+	require.Equal(t, "10.0.0.7", peerAddress(tcp))
+
+	unix := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.UnixAddr{Name: "/var/run/extproc.sock", Net: "unix"}})
+	require.Empty(t, peerAddress(unix))
+
+	require.Empty(t, peerAddress(context.Background()))
+}
+
+func TestPeerAddressForwarded(t *testing.T) {
+	var got atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Store(r.Header.Get("x-envoy-peer"))
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	defer srv.Close()
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.PeerAddressHeader, "x-envoy-peer")
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 43210}})
+	s := New(zap.NewNop())
+	resp, err := s.generateRoutingDecision(ctx, &streamState{}, requestHeaders(":path", "/"))
+	require.NoError(t, err)
+	require.Equal(t, "foo", decisionHeader(resp))
+	require.Equal(t, "10.0.0.7", got.Load())
+}
+
+func TestCorrelationHeaderOnBothPhases(t *testing.T) {
+	setConfig(t, &config.CorrelationHeader, "x-decision-correlation-id")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	reqResp := h.send(stream, requestHeadersMessage("preferred-svc", "foo"))
+	id := setHeader(reqResp.GetRequestHeaders().GetResponse().GetHeaderMutation(), "x-decision-correlation-id")
+	require.NotEmpty(t, id)
+
+	respResp := h.send(stream, responseHeadersMessage(":status", "200"))
+	require.Equal(t, id, setHeader(respResp.GetResponseHeaders().GetResponse().GetHeaderMutation(), "x-decision-correlation-id"))
+
+	// every decision gets its own id
+	reqResp = h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+	require.NotEqual(t, id, setHeader(reqResp.GetRequestHeaders().GetResponse().GetHeaderMutation(), "x-decision-correlation-id"))
+}
+
+func TestCorrelationHeaderDisabled(t *testing.T) {
+	setConfig(t, &config.CorrelationHeader, "")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	reqResp := h.send(stream, requestHeadersMessage("preferred-svc", "foo"))
+	require.Len(t, reqResp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders(), 1)
+
+	respResp := h.send(stream, responseHeadersMessage(":status", "200"))
+	require.Empty(t, setHeader(respResp.GetResponseHeaders().GetResponse().GetHeaderMutation(), "x-decision-correlation-id"))
+}
+
+func TestResponseHeadersReflectDecision(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	h.send(stream, requestHeadersMessage("preferred-svc", "foo"))
+	resp := h.send(stream, responseHeadersMessage(":status", "200"))
+	require.Equal(t, ext_proc_v3.CommonResponse_CONTINUE, resp.GetResponseHeaders().GetResponse().GetStatus())
+	require.Equal(t, "foo", setHeader(resp.GetResponseHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionAppliedHeader))
+}
+
+func TestResponseHeadersWithoutDecision(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+
+	// the response is a no-op CONTINUE rather than an empty ProcessingResponse
+	resp := h.send(h.stream(), responseHeadersMessage(":status", "200"))
+	require.NotNil(t, resp.GetResponseHeaders())
+	require.Equal(t, ext_proc_v3.CommonResponse_CONTINUE, resp.GetResponseHeaders().GetResponse().GetStatus())
+	require.Nil(t, resp.GetResponseHeaders().GetResponse().GetHeaderMutation())
+}
+
+func TestUnknownRequestTypeIgnored(t *testing.T) {
+	setConfig(t, &config.OnUnknownRequestType, config.UnknownRequestTypeIgnore)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	resp := h.send(stream, &ext_proc_v3.ProcessingRequest{})
+	require.Nil(t, resp.Response)
+
+	// the stream is still usable
+	resp = h.send(stream, requestHeadersMessage("preferred-svc", "foo"))
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+}
+
+func TestUnknownRequestTypeClosesStream(t *testing.T) {
+	setConfig(t, &config.OnUnknownRequestType, config.UnknownRequestTypeError)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	require.NoError(t, stream.Send(&ext_proc_v3.ProcessingRequest{}))
+	_, err := stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestFetchRoutingDecisionClosedPort(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+	setConfig(t, &config.RoutingDecisionServer, "http://"+addr)
+
+	s := New(zap.NewNop())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.fetchRoutingDecision(context.Background(), "key", requestHeaders())
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetching from a closed port should fail instead of hanging")
+	}
+}
+
+// sleepyDecisionServer answers after the delay unless the caller gives up first. It reports each request it starts
+// on started and each request given up by the caller on cancelled.
+func sleepyDecisionServer(t *testing.T, delay time.Duration) (*httptest.Server, <-chan struct{}, <-chan struct{}) {
+	started := make(chan struct{}, 1)
+	cancelled := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-time.After(delay):
+			w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, started, cancelled
+}
+
+func TestFetchRoutingDecisionTimeout(t *testing.T) {
+	srv, _, _ := sleepyDecisionServer(t, 5*time.Second)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RoutingDecisionTimeout, 100*time.Millisecond)
+
+	start := time.Now()
+	_, err := New(zap.NewNop()).fetchRoutingDecision(context.Background(), "key", requestHeaders())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestFetchRoutingDecisionCancelledWithStream(t *testing.T) {
+	srv, started, cancelled := sleepyDecisionServer(t, 5*time.Second)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.CancelDecisionOnStreamClose, true)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+	require.NoError(t, stream.Send(requestHeadersMessage(":path", "/")))
+	<-started
+	require.NoError(t, stream.CloseSend())
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the decision server call should be cancelled when the stream closes")
+	}
+}
@@ -0,0 +1,177 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// DecisionRequest carries what a provider needs to know about the request to decide where it goes
+type DecisionRequest struct {
+	// Key identifies the request, see decisionKey
+	Key     string
+	Headers *ext_proc_v3.HttpHeaders
+	// Timeout bounds the decision unless it is 0. It is resolved when the request is decided, see currentCallLimits,
+	// so that a reload, WithDecisionTimeout and the slow start window apply to the providers already built.
+	Timeout time.Duration
+	// Config is the configuration the request is decided with, see confFor
+	Config *config.Config
+}
+
+// DecisionProvider looks up the routing decision for a request. An empty decision means there is no decision.
+type DecisionProvider interface {
+	Decide(ctx context.Context, req DecisionRequest) (string, error)
+}
+
+// newDecisionProvider builds the provider selected by conf. With a fan out every listed provider is asked at once,
+// otherwise the named provider is used.
+func (s *ProcessingServer) newDecisionProvider(conf *config.Config) DecisionProvider {
+	httpProvider := &httpDecisionProvider{s: s}
+
+	if len(conf.Provider.FanOut) > 0 {
+		var providers []DecisionProvider
+		for _, name := range conf.Provider.FanOut {
+			p, err := s.namedDecisionProvider(conf, name, httpProvider, nil)
+			if err != nil {
+				s.log.Error("skipping decision provider", zap.String("provider", name), zap.Error(err))
+				continue
+			}
+			providers = append(providers, p)
+		}
+		if len(providers) > 0 {
+			return newFirstSuccessProvider(s.clientLog, providers)
+		}
+	}
+
+	p, err := s.namedDecisionProvider(conf, conf.Provider.Name, httpProvider, httpProvider)
+	if err != nil {
+		s.log.Error("invalid decision provider configuration, using the http decision provider", zap.Error(err))
+		return httpProvider
+	}
+	return p
+}
+
+// usesDecisionServer reports whether the provider calls the HTTP decision server, on its own, as the fallback or as one
+// of the providers fanned out to
+func usesDecisionServer(p DecisionProvider) bool {
+	switch p := p.(type) {
+	case *httpDecisionProvider:
+		return true
+	case *redisDecisionProvider:
+		return usesDecisionServer(p.fallback)
+	case *firstSuccessProvider:
+		return slices.ContainsFunc(p.providers, usesDecisionServer)
+	}
+	return false
+}
+
+// namedDecisionProvider builds a provider by name where fallback decides on a redis miss
+func (s *ProcessingServer) namedDecisionProvider(conf *config.Config, name string, httpProvider *httpDecisionProvider, fallback DecisionProvider) (DecisionProvider, error) {
+	switch name {
+	case config.DecisionProviderHTTP:
+		return httpProvider, nil
+	case config.DecisionProviderRedis:
+		redis := conf.Provider.Redis
+		return newRedisDecisionProvider(s.clientLog, redis.URL, redis.PoolSize, redis.KeyTemplate, redis.Timeout, fallback)
+	case config.DecisionProviderGRPC:
+		if !conf.Provider.GRPC.TLS {
+			return newGRPCDecisionProvider(s.clientLog, conf.Provider.GRPC.Server, nil)
+		}
+		settings, err := currentTLSSettings(conf)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the decision server CA file: %w", err)
+		}
+		tlsConf, err := settings.clientConfig()
+		if err != nil {
+			return nil, err
+		}
+		return newGRPCDecisionProvider(s.clientLog, conf.Provider.GRPC.Server, tlsConf)
+	}
+	return nil, fmt.Errorf("unknown decision provider %q", name)
+}
+
+// httpDecisionProvider asks the external routing decision server
+type httpDecisionProvider struct {
+	s *ProcessingServer
+}
+
+func (p *httpDecisionProvider) Decide(ctx context.Context, req DecisionRequest) (string, error) {
+	return p.s.fetchRoutingDecision(ctx, req.Key, req.Headers)
+}
+
+// firstSuccessProvider asks every provider in parallel and uses the first decision, or rejection, that comes back
+// within the request timeout, cancelling the providers which are still deciding
+type firstSuccessProvider struct {
+	providers []DecisionProvider
+	log       *zap.Logger
+}
+
+func newFirstSuccessProvider(log *zap.Logger, providers []DecisionProvider) *firstSuccessProvider {
+	return &firstSuccessProvider{providers: providers, log: log}
+}
+
+// Close closes the providers which hold connections
+func (p *firstSuccessProvider) Close() error {
+	var errs []error
+	for _, provider := range p.providers {
+		if c, ok := provider.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type providerResult struct {
+	index    int
+	decision string
+	err      error
+}
+
+func (p *firstSuccessProvider) Decide(ctx context.Context, req DecisionRequest) (string, error) {
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan providerResult, len(p.providers))
+	for i, provider := range p.providers {
+		go func() {
+			decision, err := provider.Decide(ctx, req)
+			results <- providerResult{index: i, decision: decision, err: err}
+		}()
+	}
+
+	var errs []error
+	for range p.providers {
+		select {
+		case <-ctx.Done():
+			return "", errors.Join(append(errs, ctx.Err())...)
+		case r := <-results:
+			if r.err == nil && r.decision != "" {
+				p.log.Debug("decision provider responded first", zap.Int("provider", r.index))
+				return r.decision, nil
+			}
+			// a provider denying the request has decided just as much as one routing it
+			var rej *rejection
+			if errors.As(r.err, &rej) {
+				p.log.Debug("decision provider rejected the request first", zap.Int("provider", r.index))
+				return "", r.err
+			}
+			if r.err != nil {
+				errs = append(errs, fmt.Errorf("provider %d: %w", r.index, r.err))
+			}
+		}
+	}
+	return "", errors.Join(errs...)
+}
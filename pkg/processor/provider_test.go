@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// staticProvider always returns the same decision and counts how many times it was asked
+type staticProvider struct {
+	decision string
+	err      error
+	// atomic as fanned out providers are asked concurrently
+	calls atomic.Int64
+}
+
+func (p *staticProvider) Decide(_ context.Context, _ DecisionRequest) (string, error) {
+	p.calls.Add(1)
+	return p.decision, p.err
+}
+
+// slowProvider decides after the delay unless it is cancelled first
+type slowProvider struct {
+	decision  string
+	delay     time.Duration
+	started   atomic.Bool
+	cancelled atomic.Bool
+}
+
+func (p *slowProvider) Decide(ctx context.Context, _ DecisionRequest) (string, error) {
+	p.started.Store(true)
+	select {
+	case <-time.After(p.delay):
+		return p.decision, nil
+	case <-ctx.Done():
+		p.cancelled.Store(true)
+		return "", ctx.Err()
+	}
+}
+
+func TestFirstSuccessProviderUsesFastest(t *testing.T) {
+	slow := &slowProvider{decision: "slow", delay: 5 * time.Second}
+	fast := &slowProvider{decision: "fast", delay: 10 * time.Millisecond}
+	p := newFirstSuccessProvider(zap.NewNop(), []DecisionProvider{slow, fast})
+
+	start := time.Now()
+	decision, err := p.Decide(context.Background(), DecisionRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "fast", decision)
+	require.Less(t, time.Since(start), time.Second)
+	require.Eventually(t, slow.cancelled.Load, time.Second, 10*time.Millisecond)
+}
+
+func TestFirstSuccessProviderSkipsFailures(t *testing.T) {
+	failing := &staticProvider{err: errors.New("boom")}
+	slow := &slowProvider{decision: "slow", delay: 50 * time.Millisecond}
+	p := newFirstSuccessProvider(zap.NewNop(), []DecisionProvider{failing, slow})
+
+	decision, err := p.Decide(context.Background(), DecisionRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "slow", decision)
+}
+
+func TestFirstSuccessProviderReturnsRejection(t *testing.T) {
+	deny := &staticProvider{err: reject(ruleDecisionDenied, http.StatusForbidden, "denied")}
+	slow := &slowProvider{decision: "slow", delay: 5 * time.Second}
+	p := newFirstSuccessProvider(zap.NewNop(), []DecisionProvider{deny, slow})
+
+	start := time.Now()
+	_, err := p.Decide(context.Background(), DecisionRequest{})
+	var rej *rejection
+	require.ErrorAs(t, err, &rej)
+	require.Less(t, time.Since(start), time.Second, "the rejection is returned without waiting for the other providers")
+}
+
+func TestFirstSuccessProviderAggregatesErrors(t *testing.T) {
+	first := &staticProvider{err: errors.New("first failed")}
+	second := &staticProvider{err: errors.New("second failed")}
+	empty := &staticProvider{}
+	p := newFirstSuccessProvider(zap.NewNop(), []DecisionProvider{first, second, empty})
+
+	_, err := p.Decide(context.Background(), DecisionRequest{})
+	require.ErrorContains(t, err, "first failed")
+	require.ErrorContains(t, err, "second failed")
+}
+
+func TestFirstSuccessProviderRespectsBudget(t *testing.T) {
+	slow := &slowProvider{decision: "slow", delay: 5 * time.Second}
+	p := newFirstSuccessProvider(zap.NewNop(), []DecisionProvider{slow})
+
+	start := time.Now()
+	_, err := p.Decide(context.Background(), DecisionRequest{Timeout: 50 * time.Millisecond})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestFanOutSelectedByConfig(t *testing.T) {
+	setConfig(t, &config.DecisionProviderFanOut, []string{config.DecisionProviderHTTP, "unknown"})
+
+	s := New(zap.NewNop())
+	require.IsType(t, &firstSuccessProvider{}, s.provider)
+	require.Len(t, s.provider.(*firstSuccessProvider).providers, 1)
+}
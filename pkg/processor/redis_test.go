@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func newTestRedisProvider(t *testing.T, url string, fallback DecisionProvider) *redisDecisionProvider {
+	p, err := newRedisDecisionProvider(zap.NewNop(), url, 2, "routing:{x-tenant}", 100*time.Millisecond, fallback)
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestRedisProviderHit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	require.NoError(t, mr.Set("routing:acme", "acme-svc"))
+
+	fallback := &staticProvider{decision: "http-svc"}
+	p := newTestRedisProvider(t, "redis://"+mr.Addr(), fallback)
+
+	decision, err := p.Decide(context.Background(), DecisionRequest{Headers: requestHeaders("x-tenant", "acme"), Config: config.FromEnv()})
+	require.NoError(t, err)
+	require.Equal(t, "acme-svc", decision)
+	require.Zero(t, fallback.calls.Load())
+}
+
+func TestRedisProviderMissFallsBack(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	fallback := &staticProvider{decision: "http-svc"}
+	p := newTestRedisProvider(t, "redis://"+mr.Addr(), fallback)
+
+	decision, err := p.Decide(context.Background(), DecisionRequest{Headers: requestHeaders("x-tenant", "other"), Config: config.FromEnv()})
+	require.NoError(t, err)
+	require.Equal(t, "http-svc", decision)
+	require.EqualValues(t, 1, fallback.calls.Load())
+}
+
+func TestRedisProviderMissWithoutFallback(t *testing.T) {
+	mr := miniredis.RunT(t)
+	p := newTestRedisProvider(t, "redis://"+mr.Addr(), nil)
+
+	decision, err := p.Decide(context.Background(), DecisionRequest{Headers: requestHeaders("x-tenant", "other"), Config: config.FromEnv()})
+	require.NoError(t, err)
+	require.Empty(t, decision)
+}
+
+func TestRedisProviderConnectionErrorFallsBack(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	fallback := &staticProvider{decision: "http-svc"}
+	p := newTestRedisProvider(t, "redis://"+addr, fallback)
+
+	decision, err := p.Decide(context.Background(), DecisionRequest{Headers: requestHeaders("x-tenant", "acme"), Config: config.FromEnv()})
+	require.NoError(t, err)
+	require.Equal(t, "http-svc", decision)
+	require.EqualValues(t, 1, fallback.calls.Load())
+
+	p = newTestRedisProvider(t, "redis://"+addr, nil)
+	_, err = p.Decide(context.Background(), DecisionRequest{Headers: requestHeaders("x-tenant", "acme"), Config: config.FromEnv()})
+	require.Error(t, err)
+}
+
+func TestRedisProviderSelectedByConfig(t *testing.T) {
+	mr := miniredis.RunT(t)
+	require.NoError(t, mr.Set("routing:acme", "acme-svc"))
+	setConfig(t, &config.DecisionProvider, config.DecisionProviderRedis)
+	setConfig(t, &config.RedisURL, "redis://"+mr.Addr())
+	setConfig(t, &config.RedisKeyTemplate, "routing:{x-tenant}")
+
+	s := New(zap.NewNop())
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("x-tenant", "acme"))
+	require.NoError(t, err)
+	require.Equal(t, "acme-svc", decisionHeader(resp))
+
+	require.NoError(t, s.Close())
+	require.ErrorIs(t, s.provider.(*redisDecisionProvider).client.Ping(context.Background()).Err(), redis.ErrClosed, "closing the server closes the redis client")
+}
@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// cacheSettings are the settings cached decisions depend on. The cache is only reset when one of them changes.
+type cacheSettings struct {
+	ttl               time.Duration
+	ttlJitter         int
+	size              int
+	keyTemplate       string
+	pathNormalization string
+	decisionServer    string
+}
+
+func currentCacheSettings(conf *config.Config) cacheSettings {
+	return cacheSettings{
+		ttl:               conf.Cache.TTL,
+		ttlJitter:         conf.Cache.TTLJitter,
+		size:              conf.Cache.Size,
+		keyTemplate:       conf.Decision.KeyTemplate,
+		pathNormalization: strings.Join(conf.PathNormalization.Transforms, ","),
+		decisionServer:    conf.DecisionServer.URL,
+	}
+}
+
+// newCache creates an empty cache for the settings or returns nil when caching is disabled
+func (c cacheSettings) newCache() *decisionCache {
+	if c.ttl <= 0 {
+		return nil
+	}
+	cache := newDecisionCache(c.ttl, c.size)
+	cache.jitter = c.ttlJitter
+	return cache
+}
+
+// breakerSettings are the settings the circuit breaker is built with, it is rebuilt closed when one of them changes
+type breakerSettings struct {
+	threshold int
+	cooldown  time.Duration
+}
+
+func currentBreakerSettings(conf *config.Config) breakerSettings {
+	return breakerSettings{threshold: conf.CircuitBreaker.Threshold, cooldown: conf.CircuitBreaker.Cooldown}
+}
+
+// newBreaker creates a closed circuit breaker for the settings or returns nil when it is disabled
+func (b breakerSettings) newBreaker() *circuitBreaker {
+	if b.threshold <= 0 {
+		return nil
+	}
+	return newCircuitBreaker(b.threshold, b.cooldown)
+}
+
+// batchSettings are the settings the batcher is built with. The batches already pending on the batcher replaced by a
+// reload are still sent when their window ends.
+type batchSettings struct {
+	window  time.Duration
+	maxSize int
+}
+
+func currentBatchSettings(conf *config.Config) batchSettings {
+	return batchSettings{window: conf.DecisionServer.BatchWindow, maxSize: conf.DecisionServer.BatchMaxSize}
+}
+
+// newBatcher creates a batcher for the settings or returns nil when decisions aren't batched
+func (b batchSettings) newBatcher(send func(context.Context, string, []batchItem) ([]json.RawMessage, error)) *decisionBatcher {
+	if b.window <= 0 {
+		return nil
+	}
+	return newDecisionBatcher(b.window, b.maxSize, send)
+}
+
+// Reload applies the package config as it currently is, e.g. after Config.Apply, and re-reads the decision server CA
+// file. The environment isn't read again. Only subsystems whose settings changed are reset so that unrelated changes,
+// such as the log level, keep the warm decision cache, the circuit breaker state and TLS sessions.
+// A configuration given with WithConfig is kept, only the settings read from the package config are reloaded.
+func (s *ProcessingServer) Reload() {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.applyConfig()
+}
+
+// SetConfig swaps the configuration of the running server, as if it had been given with WithConfig, and applies it
+// like Reload. Streams already open finish with the configuration they started with.
+func (s *ProcessingServer) SetConfig(c *config.Config) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	// an unchanged configuration keeps the request settings
+	if !s.fixedConfig.Load() || !reflect.DeepEqual(c, s.cfg.Load()) {
+		s.cfg.Store(c)
+	}
+	s.fixedConfig.Store(true)
+	s.applyConfig()
+}
+
+// applyConfig resets the subsystems whose settings changed with the configuration
+func (s *ProcessingServer) applyConfig() {
+	conf := s.conf()
+
+	if next := currentCacheSettings(conf); next != s.cacheConf {
+		s.log.Info("cache settings changed, resetting the decision cache")
+		s.cacheConf = next
+		s.cache.Store(next.newCache())
+	} else {
+		s.log.Debug("cache settings unchanged, keeping the decision cache")
+	}
+
+	if next := currentBreakerSettings(conf); next != s.breakerConf {
+		s.log.Info("circuit breaker settings changed, resetting the circuit breaker")
+		s.breakerConf = next
+		s.breaker.Store(next.newBreaker())
+		metrics.CircuitBreakerState.Set(float64(BreakerClosed))
+	}
+
+	if next := currentBatchSettings(conf); next != s.batchConf {
+		s.log.Info("batch settings changed, batching new decision requests with them")
+		s.batchConf = next
+		s.batcher.Store(next.newBatcher(s.sendBatch))
+	}
+
+	if next := s.currentRequestSettings(); *next != *s.settings.Load() {
+		s.log.Info("request settings changed, applying them to new request phases")
+		s.settings.Store(next)
+	}
+
+	if server := s.settings.Load().decisionServer; server != s.probe.Load().url {
+		s.log.Info("decision server changed, probing the new one for reachability")
+		s.probe.Store(s.newProbe(server, conf))
+	}
+
+	if next, err := currentTLSSettings(conf); err != nil {
+		s.log.Error("failed to read the decision server CA file, keeping the current TLS settings", zap.Error(err))
+	} else if next != s.transport.tlsSettings() {
+		s.log.Info("decision server TLS settings changed, dropping connections and TLS sessions")
+		s.transport.rotate(next)
+	}
+}
@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// warmCache makes a decision so it is cached
+func warmCache(t *testing.T, s *ProcessingServer) {
+	_, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(":authority", "example.com", ":path", "/"))
+	require.NoError(t, err)
+	require.Equal(t, 1, s.cacheStats().Size)
+}
+
+func TestReloadKeepsCacheOnUnrelatedChange(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "foo").URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+
+	s := New(zap.NewNop())
+	warmCache(t, s)
+
+	setConfig(t, &config.LogLevel, "debug")
+	s.Reload()
+	require.Equal(t, 1, s.cacheStats().Size)
+}
+
+func TestReloadResetsCacheOnKeyChange(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "foo").URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+
+	s := New(zap.NewNop())
+	warmCache(t, s)
+
+	setConfig(t, &config.DecisionKeyTemplate, "{x-tenant}")
+	s.Reload()
+	require.Zero(t, s.cacheStats().Size)
+}
+
+func TestReloadTogglesCache(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "foo").URL)
+
+	s := New(zap.NewNop())
+	require.Nil(t, s.cache.Load())
+
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+	s.Reload()
+	warmCache(t, s)
+
+	setConfig(t, &config.RoutingDecisionCacheTTL, 0)
+	s.Reload()
+	require.Nil(t, s.cache.Load())
+}
+
+func TestReloadProbesNewDecisionServer(t *testing.T) {
+	unreachable, _, _ := flakyDecisionServer(t)
+	reachable, healthy, probes := flakyDecisionServer(t)
+	healthy.Store(true)
+	setConfig(t, &config.RoutingDecisionServer, unreachable.URL)
+
+	s := New(zap.NewNop())
+	require.False(t, s.DecisionServerReachable(context.Background()))
+
+	setConfig(t, &config.RoutingDecisionServer, reachable.URL)
+	s.Reload()
+	require.True(t, s.DecisionServerReachable(context.Background()), "the probe follows the decision server")
+	require.EqualValues(t, 1, probes.Load())
+}
+
+func TestReloadRebuildsCircuitBreakerOnChange(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "foo").URL)
+
+	s := New(zap.NewNop())
+	require.Nil(t, s.breaker.Load())
+
+	setConfig(t, &config.CircuitBreakerThreshold, 1)
+	setConfig(t, &config.CircuitBreakerCooldown, time.Minute)
+	s.Reload()
+	breaker := s.breaker.Load()
+	require.NotNil(t, breaker)
+	require.Equal(t, time.Minute, breaker.cooldown)
+
+	setConfig(t, &config.LogLevel, "debug")
+	s.Reload()
+	require.Same(t, breaker, s.breaker.Load(), "an unrelated change keeps the breaker state")
+
+	setConfig(t, &config.CircuitBreakerCooldown, time.Second)
+	s.Reload()
+	require.Equal(t, time.Second, s.breaker.Load().cooldown)
+}
+
+func TestReloadTogglesBatching(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "foo").URL)
+
+	s := New(zap.NewNop())
+	require.Nil(t, s.batcher.Load())
+
+	setConfig(t, &config.DecisionBatchWindow, 10*time.Millisecond)
+	s.Reload()
+	require.Equal(t, 10*time.Millisecond, s.batcher.Load().window)
+
+	setConfig(t, &config.DecisionBatchWindow, 0)
+	s.Reload()
+	require.Nil(t, s.batcher.Load())
+}
+
+func TestReloadDuringRequestsUsesConsistentSettings(t *testing.T) {
+	a, b := config.FromEnv(), config.FromEnv()
+	a.DecisionServer.URL, b.DecisionServer.URL = decisionServer(t, "a").URL, decisionServer(t, "b").URL
+	a.Decision.Format, b.Decision.Format = "A:{decision}", "B:{decision}"
+
+	s := New(zap.NewNop(), WithConfig(a))
+	h := newTestHarness(t, s)
+
+	done := make(chan struct{})
+	var reloads sync.WaitGroup
+	reloads.Add(1)
+	go func() {
+		defer reloads.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// every reload switches both settings so a request mixing them would be routed to A:b or B:a
+			if i%2 == 0 {
+				s.SetConfig(b)
+			} else {
+				s.SetConfig(a)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		stream := h.stream()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if !assert.NoError(t, stream.Send(requestHeadersMessage(":authority", "example.com", ":path", "/"))) {
+					return
+				}
+				resp, err := stream.Recv()
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Contains(t, []string{"A:a", "B:b"}, decisionHeader(resp.GetRequestHeaders()))
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	reloads.Wait()
+}
+
+func TestSetConfigAppliesEverySetting(t *testing.T) {
+	initial := config.FromEnv()
+	initial.DecisionServer.URL = decisionServer(t, "foo").URL
+	conf := *initial
+	conf.RequiredHeader = config.RequiredHeaderConfig{Name: "x-tenant", Status: http.StatusPreconditionFailed}
+	conf.Decision.Format = "svc-{decision}"
+
+	s := New(zap.NewNop(), WithConfig(initial))
+	h := newTestHarness(t, s)
+	require.Equal(t, "foo", decisionHeader(h.send(h.stream(), requestHeadersMessage()).GetRequestHeaders()))
+
+	s.SetConfig(&conf)
+	ir := h.send(h.stream(), requestHeadersMessage()).GetImmediateResponse()
+	require.EqualValues(t, http.StatusPreconditionFailed, ir.GetStatus().GetCode())
+	require.Equal(t, "svc-foo", decisionHeader(h.send(h.stream(), requestHeadersMessage("x-tenant", "acme")).GetRequestHeaders()))
+}
+
+func TestSetConfig(t *testing.T) {
+	confA := config.FromEnv()
+	confA.DecisionServer.URL = decisionServer(t, "a").URL
+	confA.Headers.Correlation = "x-correlation-a"
+	confB := config.FromEnv()
+	confB.DecisionServer.URL = decisionServer(t, "b").URL
+	confB.Headers.Correlation = "x-correlation-b"
+
+	s := New(zap.NewNop(), WithConfig(confA))
+	h := newTestHarness(t, s)
+
+	inFlight := h.stream()
+	require.Equal(t, "a", decisionHeader(h.send(inFlight, requestHeadersMessage()).GetRequestHeaders()))
+
+	s.SetConfig(confB)
+	require.Equal(t, "b", decisionHeader(h.send(h.stream(), requestHeadersMessage()).GetRequestHeaders()), "new streams use the new config")
+
+	resp := h.send(inFlight, responseHeadersMessage())
+	mutation := resp.GetResponseHeaders().GetResponse().GetHeaderMutation()
+	require.NotEmpty(t, setHeader(mutation, "x-correlation-a"), "a stream already open finishes with the config it started with")
+	require.Empty(t, setHeader(mutation, "x-correlation-b"))
+}
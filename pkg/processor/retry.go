@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// statusError is the retryable status the decision server still responded with once the retries were exhausted
+type statusError struct {
+	status int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("decision server responded with status %d", e.status)
+}
+
+// doWithRetry calls the decision server retrying on connection errors, 5xx and 429 responses with exponential backoff.
+// A 429 carrying a Retry-After header is retried after the delay requested by the server instead of our own backoff.
+// Once the retries are exhausted a 5xx or 429 response is closed and returned as a *statusError.
+// A body is sent as config.DecisionContentType unless the header already sets a content type.
+func (s *ProcessingServer) doWithRetry(ctx context.Context, method, url string, header http.Header, body []byte) (*http.Response, error) {
+	attempts := s.currentCallLimits(ctx).retries + 1
+	for attempt := 1; ; attempt++ {
+		s.clientLogFor(ctx).Debug("calling the decision server", zap.Int("attempt", attempt), zap.Int("attempts", attempts))
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = header.Clone()
+		if body != nil && req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", s.confFor(ctx).DecisionServer.ContentType)
+		}
+		resp, err := s.transport.client(url).Do(req)
+		if err == nil && !isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt >= attempts {
+			if err != nil {
+				return nil, err
+			}
+			io.Copy(io.Discard, resp.Body) // nolint:errcheck
+			resp.Body.Close()
+			return nil, &statusError{status: resp.StatusCode}
+		}
+
+		conf := s.confFor(ctx).DecisionServer
+		delay := retryBackoff(attempt, conf.RetryBackoff, conf.RetryMaxBackoff)
+		if resp != nil {
+			if resp.StatusCode == http.StatusTooManyRequests {
+				if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+					delay = d
+				}
+			}
+			// drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body) // nolint:errcheck
+			resp.Body.Close()
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, fmt.Errorf("retry delay of %s exceeds the remaining routing decision budget", delay)
+		}
+
+		s.clientLogFor(ctx).Debug("retrying the external service call", zap.Int("attempt", attempt), zap.Duration("delay", delay))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryBackoff is the delay before retrying the attempt. It doubles with each attempt up to max, unless max is 0, and
+// is jittered between half and the full delay so that processors don't retry in lockstep.
+func retryBackoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && (max <= 0 || delay < max) && delay <= math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	if delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// parseRetryAfter parses the Retry-After header which can either be delay-seconds or an HTTP-date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if d := at.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
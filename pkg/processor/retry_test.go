@@ -0,0 +1,208 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func setRetryConfig(t *testing.T, retries int, backoff time.Duration) {
+	setConfig(t, &config.RoutingDecisionRetries, retries)
+	setConfig(t, &config.RoutingDecisionRetryBackoff, backoff)
+}
+
+// rateLimitedServer responds with a 429 carrying the given Retry-After on the first call and a decision afterwards
+func rateLimitedServer(t *testing.T, retryAfter func() string) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", retryAfter())
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+	d, ok := parseRetryAfter("3", now)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, d)
+
+	d, ok = parseRetryAfter(now.Add(5*time.Second).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	require.Equal(t, 5*time.Second, d)
+
+	d, ok = parseRetryAfter(now.Add(-5*time.Second).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	require.Zero(t, d)
+
+	for _, v := range []string{"", "-1", "soon"} {
+		_, ok = parseRetryAfter(v, now)
+		require.False(t, ok, "value %q should not parse", v)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	// our own backoff is far longer than the server's request so honoring Retry-After is observable
+	setRetryConfig(t, 1, time.Minute)
+	srv, calls := rateLimitedServer(t, func() string { return "1" })
+
+	s := New(zap.NewNop())
+	start := time.Now()
+	resp, err := s.doWithRetry(context.Background(), http.MethodGet, srv.URL, http.Header{}, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.EqualValues(t, 2, calls.Load())
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestRetryAfterHTTPDate(t *testing.T) {
+	setRetryConfig(t, 1, time.Minute)
+	srv, calls := rateLimitedServer(t, func() string {
+		return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)
+	})
+
+	s := New(zap.NewNop())
+	start := time.Now()
+	resp, err := s.doWithRetry(context.Background(), http.MethodGet, srv.URL, http.Header{}, nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.EqualValues(t, 2, calls.Load())
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestRetryAfterExceedsBudget(t *testing.T) {
+	setRetryConfig(t, 1, 10*time.Millisecond)
+	srv, calls := rateLimitedServer(t, func() string { return "120" })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	s := New(zap.NewNop())
+	start := time.Now()
+	_, err := s.doWithRetry(ctx, http.MethodGet, srv.URL, http.Header{}, nil)
+	require.Error(t, err)
+	require.EqualValues(t, 1, calls.Load())
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestDecisionContentType(t *testing.T) {
+	setConfig(t, &config.DecisionContentType, "application/vnd.acme.decision+json; version=2")
+
+	contentType := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType <- r.Header.Get("Content-Type")
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	defer srv.Close()
+
+	resp, err := New(zap.NewNop()).doWithRetry(context.Background(), http.MethodPost, srv.URL, http.Header{}, []byte(`{}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "application/vnd.acme.decision+json; version=2", <-contentType)
+}
+
+func TestRetryBackoffExponentialWithJitter(t *testing.T) {
+	for range 100 {
+		d := retryBackoff(1, 100*time.Millisecond, time.Second)
+		require.GreaterOrEqual(t, d, 50*time.Millisecond)
+		require.LessOrEqual(t, d, 100*time.Millisecond)
+
+		d = retryBackoff(3, 100*time.Millisecond, time.Second)
+		require.GreaterOrEqual(t, d, 200*time.Millisecond)
+		require.LessOrEqual(t, d, 400*time.Millisecond)
+
+		d = retryBackoff(10, 100*time.Millisecond, time.Second)
+		require.GreaterOrEqual(t, d, 500*time.Millisecond)
+		require.LessOrEqual(t, d, time.Second, "the backoff is capped")
+	}
+}
+
+func TestRetryBackoffUncapped(t *testing.T) {
+	for range 100 {
+		d := retryBackoff(5, 100*time.Millisecond, 0)
+		require.GreaterOrEqual(t, d, 800*time.Millisecond)
+		require.LessOrEqual(t, d, 1600*time.Millisecond, "a max of 0 doesn't cap the backoff")
+	}
+	require.Positive(t, retryBackoff(100, time.Second, 0), "the backoff doesn't overflow")
+}
+
+// flakyServer fails with the status the given number of times before returning a decision
+func flakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetryFailsTwiceThenSucceeds(t *testing.T) {
+	setRetryConfig(t, 3, time.Millisecond)
+	srv, calls := flakyServer(t, 2, http.StatusBadGateway)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+
+	decision, err := New(zap.NewNop()).fetchRoutingDecision(context.Background(), "key", requestHeaders())
+	require.NoError(t, err)
+	require.Equal(t, "foo", decision)
+	require.EqualValues(t, 3, calls.Load())
+}
+
+func TestRetriesExhaustedIsAnError(t *testing.T) {
+	setRetryConfig(t, 1, time.Millisecond)
+	srv, calls := flakyServer(t, 5, http.StatusServiceUnavailable)
+
+	resp, err := New(zap.NewNop()).doWithRetry(context.Background(), http.MethodGet, srv.URL, http.Header{}, nil)
+	require.Nil(t, resp)
+	var statusErr *statusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusServiceUnavailable, statusErr.status)
+	require.EqualValues(t, 2, calls.Load())
+}
+
+func TestRetryNotOnClientError(t *testing.T) {
+	setRetryConfig(t, 3, time.Millisecond)
+	srv, calls := flakyServer(t, 2, http.StatusBadRequest)
+
+	resp, err := New(zap.NewNop()).doWithRetry(context.Background(), http.MethodGet, srv.URL, http.Header{}, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestRetryAbortsOnCancel(t *testing.T) {
+	setRetryConfig(t, 5, time.Minute)
+	srv, calls := flakyServer(t, 5, http.StatusServiceUnavailable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := New(zap.NewNop()).doWithRetry(ctx, http.MethodGet, srv.URL, http.Header{}, nil)
+	require.ErrorIs(t, err, context.Canceled)
+	require.EqualValues(t, 1, calls.Load())
+	require.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// inRollout reports whether the request is part of the percentage of traffic that receives the mutation.
+// The same request id always gets the same answer so retries of a request are routed consistently,
+// requests without an id are selected at random.
+func inRollout(requestID string, percent int) bool {
+	if percent >= 100 {
+		return true
+	}
+	if percent <= 0 {
+		return false
+	}
+	if requestID == "" {
+		return rand.IntN(100) < percent
+	}
+	h := fnv.New32a()
+	h.Write([]byte(requestID)) // nolint:errcheck
+	return int(h.Sum32()%100) < percent
+}
+
+// applyRollout passes the request through without the decision when it isn't selected for the mutation rollout, the
+// preferred service header is still dropped so it doesn't reach the upstream. The decision is still logged and counted
+// so the would-be behavior can be compared before rolling out further. It reports whether the decision was applied.
+func (s *ProcessingServer) applyRollout(rs *requestSettings, in *ext_proc_v3.HttpHeaders, decision string, resp *ext_proc_v3.HeadersResponse) (*ext_proc_v3.HeadersResponse, bool) {
+	percent := rs.conf.Mutation.RolloutPercent
+	requestID := getHeaderValue(rs.conf, in, "x-request-id")
+	if inRollout(requestID, percent) {
+		return resp, true
+	}
+	metrics.MutationsSuppressed.Inc()
+	s.log.Debug("suppressing routing decision outside of the mutation rollout",
+		zap.String("decision", decision), zap.String("request_id", requestID), zap.Int("percent", percent))
+	return &ext_proc_v3.HeadersResponse{
+		Response: &ext_proc_v3.CommonResponse{
+			Status: ext_proc_v3.CommonResponse_CONTINUE,
+			HeaderMutation: &ext_proc_v3.HeaderMutation{
+				RemoveHeaders: []string{headerName(rs.conf, rs.preferredSvcHeader)},
+			},
+		},
+	}, false
+}
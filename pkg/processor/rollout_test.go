@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// mutatedRequests returns how many of n requests, each with its own request id, received the mutation
+func mutatedRequests(t *testing.T, s *ProcessingServer, n int) int {
+	mutated := 0
+	for i := range n {
+		resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "foo", "x-request-id", fmt.Sprintf("req-%d", i)))
+		require.NoError(t, err)
+		if len(resp.GetResponse().GetHeaderMutation().GetSetHeaders()) > 0 {
+			mutated++
+		}
+	}
+	return mutated
+}
+
+func TestMutationRolloutNone(t *testing.T) {
+	setConfig(t, &config.MutationRolloutPercent, 0)
+	suppressed := counter(t, metrics.MutationsSuppressed)
+
+	require.Zero(t, mutatedRequests(t, New(zap.NewNop()), 100))
+	require.Equal(t, suppressed+100, counter(t, metrics.MutationsSuppressed))
+}
+
+func TestMutationRolloutSuppressedDropsPreferredSvc(t *testing.T) {
+	setConfig(t, &config.MutationRolloutPercent, 0)
+
+	resp, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "foo", "x-request-id", "req-1"))
+	require.NoError(t, err)
+	require.Empty(t, resp.GetResponse().GetHeaderMutation().GetSetHeaders())
+	require.Equal(t, []string{"preferred-svc"}, resp.GetResponse().GetHeaderMutation().GetRemoveHeaders())
+}
+
+func TestMutationRolloutAll(t *testing.T) {
+	setConfig(t, &config.MutationRolloutPercent, 100)
+	suppressed := counter(t, metrics.MutationsSuppressed)
+
+	require.Equal(t, 100, mutatedRequests(t, New(zap.NewNop()), 100))
+	require.Equal(t, suppressed, counter(t, metrics.MutationsSuppressed))
+}
+
+func TestMutationRolloutHalf(t *testing.T) {
+	setConfig(t, &config.MutationRolloutPercent, 50)
+
+	mutated := mutatedRequests(t, New(zap.NewNop()), 1000)
+	require.InDelta(t, 500, mutated, 75)
+}
+
+func TestMutationRolloutDeterministic(t *testing.T) {
+	const keys = 10000
+	for _, percent := range []int{0, 10, 50, 90, 100} {
+		selected := 0
+		for i := range keys {
+			id := fmt.Sprintf("req-%d", i)
+			in := inRollout(id, percent)
+			require.Equal(t, in, inRollout(id, percent), "request %s should always get the same answer", id)
+			if in {
+				selected++
+			}
+		}
+		switch percent {
+		case 0:
+			require.Zero(t, selected, "no request is in a 0%% rollout")
+		case 100:
+			require.Equal(t, keys, selected, "every request is in a 100%% rollout")
+		default:
+			require.InDelta(t, percent, 100*float64(selected)/keys, 2, "%d%% of the requests should be in the rollout", percent)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+const redacted = "[REDACTED]"
+
+// names always redacted from logged calls, matched regardless of case
+var redactedNames = []string{"authorization", "proxy-authorization", "cookie", "set-cookie", "x-api-key"}
+
+// sampleExchange reports whether this decision server call should have its bodies logged
+func sampleExchange(conf *config.Config) bool {
+	rate := conf.DecisionServer.BodyLog.SampleRate
+	return rate > 0 && (rate >= 1 || rand.Float64() < rate)
+}
+
+// isRedacted reports whether the header, query parameter or JSON field must not be logged
+func isRedacted(conf *config.Config, name string) bool {
+	name = strings.TrimPrefix(strings.ToLower(name), forwardHeaderPrefix)
+	if name == strings.ToLower(conf.Decision.Token.Header) {
+		return true
+	}
+	for _, n := range redactedNames {
+		if name == n {
+			return true
+		}
+	}
+	for _, n := range conf.DecisionServer.BodyLog.Redact {
+		if strings.EqualFold(name, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// logExchange logs a sampled decision server call with credentials redacted and bodies truncated. Bodies are only
+// truncated once redacted as a partial JSON document can't be.
+func (s *ProcessingServer) logExchange(conf *config.Config, log *zap.Logger, method, rawURL string, header http.Header, reqBody []byte, status int, respBody []byte) {
+	headers := make(map[string][]string, len(header))
+	for name, values := range header {
+		if isRedacted(conf, name) {
+			values = []string{redacted}
+		}
+		headers[name] = values
+	}
+	log.Info("sampled decision server call",
+		zap.String("method", method),
+		zap.String("url", redactURL(conf, rawURL)),
+		zap.Any("request_headers", headers),
+		zap.String("request_body", truncateBody(redactJSON(conf, reqBody), conf.DecisionServer.BodyLog.MaxBytes)),
+		zap.Int("status", status),
+		zap.String("response_body", truncateBody(redactJSON(conf, respBody), conf.DecisionServer.BodyLog.MaxBytes)),
+	)
+}
+
+// redactURL redacts query parameters, such as forwarded headers, that carry credentials
+func redactURL(conf *config.Config, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	for name := range q {
+		if isRedacted(conf, name) {
+			q.Set(name, redacted)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// redactJSON redacts fields carrying credentials at any depth. Bodies which aren't JSON are returned as they are.
+func redactJSON(conf *config.Config, body []byte) []byte {
+	var v any
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return body
+	}
+	out, err := json.Marshal(redactValue(conf, v))
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+func redactValue(conf *config.Config, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if isRedacted(conf, key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(conf, value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(conf, value)
+		}
+	}
+	return v
+}
+
+// truncateBody cuts the body down to max bytes unless max is 0
+func truncateBody(body []byte, max int) string {
+	if max > 0 && len(body) > max {
+		return string(body[:max]) + "..."
+	}
+	return string(body)
+}
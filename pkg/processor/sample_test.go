@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+const sampledMessage = "sampled decision server call"
+
+// sampledCall makes a POST decision call carrying credentials and returns the logs
+func sampledCall(t *testing.T) *observer.ObservedLogs {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"decision":"foo","session":{"secret":"s3cr3t"}}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.DecisionRequestMethod, http.MethodPost)
+	setConfig(t, &config.DecisionForwardHeaders, []string{"authorization", "x-tenant"})
+	setConfig(t, &config.DecisionBodyLogRedact, []string{"Secret"})
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	decision, err := New(zap.New(core)).fetchRoutingDecision(context.Background(), "key", requestHeaders(
+		"authorization", "Bearer abc",
+		"cookie", "session=xyz",
+		"x-tenant", "acme",
+	))
+	require.NoError(t, err)
+	require.Equal(t, "foo", decision)
+	return logs
+}
+
+func TestSampledBodiesLogged(t *testing.T) {
+	setConfig(t, &config.DecisionBodyLogSampleRate, 1.0)
+
+	entries := sampledCall(t).FilterMessage(sampledMessage).All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+
+	require.Equal(t, http.MethodPost, fields["method"])
+	require.EqualValues(t, http.StatusOK, fields["status"])
+	require.Contains(t, fields["url"], "header.x-tenant=acme")
+	require.Contains(t, fields["url"], "header.authorization=%5BREDACTED%5D")
+	require.JSONEq(t, `{"authorization":"[REDACTED]","cookie":"[REDACTED]","x-tenant":"acme"}`, fields["request_body"].(string))
+	require.JSONEq(t, `{"decision":"foo","session":{"secret":"[REDACTED]"}}`, fields["response_body"].(string))
+
+	for _, v := range fields {
+		if s, ok := v.(string); ok {
+			require.NotContains(t, s, "abc")
+			require.NotContains(t, s, "s3cr3t")
+		}
+	}
+}
+
+func TestSampledBodiesNotLoggedAtZeroRate(t *testing.T) {
+	setConfig(t, &config.DecisionBodyLogSampleRate, 0.0)
+
+	require.Zero(t, sampledCall(t).FilterMessage(sampledMessage).Len())
+}
+
+func TestSampledBodiesTruncated(t *testing.T) {
+	require.Equal(t, "0123456789...", truncateBody([]byte(strings.Repeat("0123456789", 3)), 10))
+	require.Equal(t, "short", truncateBody([]byte("short"), 10))
+}
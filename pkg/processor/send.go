@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+type responseSender interface {
+	Send(*ext_proc_v3.ProcessingResponse) error
+}
+
+// isTransientSendError reports whether a failed send is worth retrying. A cancelled stream never is.
+func isTransientSendError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// send sends the response, retrying transient failures with a bounded backoff before giving up on the stream
+func (s *ProcessingServer) send(ctx context.Context, conf *config.Config, srv responseSender, resp *ext_proc_v3.ProcessingResponse) error {
+	backoff := conf.Stream.SendRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := srv.Send(resp)
+		if err == nil {
+			if attempt > 0 {
+				metrics.Sends.WithLabelValues("retried").Inc()
+			} else {
+				metrics.Sends.WithLabelValues("ok").Inc()
+			}
+			return nil
+		}
+		if !isTransientSendError(err) || attempt >= conf.Stream.SendRetries {
+			metrics.Sends.WithLabelValues("failed").Inc()
+			return err
+		}
+
+		s.log.Warn("transient send error, retrying", zap.Int("attempt", attempt+1), zap.Duration("backoff", backoff), zap.Error(err))
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			metrics.Sends.WithLabelValues("failed").Inc()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
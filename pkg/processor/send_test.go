@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// flakySender fails with the queued errors before succeeding
+type flakySender struct {
+	errs  []error
+	calls int
+}
+
+func (f *flakySender) Send(*ext_proc_v3.ProcessingResponse) error {
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func TestSendRetriesTransientError(t *testing.T) {
+	setConfig(t, &config.SendRetries, 2)
+	setConfig(t, &config.SendRetryBackoff, time.Millisecond)
+	retried := counter(t, metrics.Sends.WithLabelValues("retried"))
+
+	f := &flakySender{errs: []error{status.Error(codes.Unavailable, "flow control")}}
+	require.NoError(t, New(zap.NewNop()).send(context.Background(), config.FromEnv(), f, &ext_proc_v3.ProcessingResponse{}))
+	require.Equal(t, 2, f.calls)
+	require.Equal(t, retried+1, counter(t, metrics.Sends.WithLabelValues("retried")))
+}
+
+func TestSendGivesUpAfterRetries(t *testing.T) {
+	setConfig(t, &config.SendRetries, 2)
+	setConfig(t, &config.SendRetryBackoff, time.Millisecond)
+	failed := counter(t, metrics.Sends.WithLabelValues("failed"))
+
+	unavailable := status.Error(codes.Unavailable, "flow control")
+	f := &flakySender{errs: []error{unavailable, unavailable, unavailable, unavailable}}
+	require.ErrorIs(t, New(zap.NewNop()).send(context.Background(), config.FromEnv(), f, &ext_proc_v3.ProcessingResponse{}), unavailable)
+	require.Equal(t, 3, f.calls)
+	require.Equal(t, failed+1, counter(t, metrics.Sends.WithLabelValues("failed")))
+}
+
+func TestSendPermanentErrorNotRetried(t *testing.T) {
+	setConfig(t, &config.SendRetries, 2)
+
+	for _, err := range []error{context.Canceled, status.Error(codes.Canceled, "cancelled"), status.Error(codes.Internal, "boom")} {
+		f := &flakySender{errs: []error{err}}
+		require.Error(t, New(zap.NewNop()).send(context.Background(), config.FromEnv(), f, &ext_proc_v3.ProcessingResponse{}))
+		require.Equal(t, 1, f.calls, "%v should not be retried", err)
+	}
+}
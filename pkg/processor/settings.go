@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// requestSettings are the reloadable settings a request phase reads more than once. A phase loads them once and
+// uses that snapshot throughout so a concurrent reload never mixes old and new header names or URLs.
+// A snapshot is never modified, a reload stores a new one.
+type requestSettings struct {
+	decisionHeader     string
+	preferredSvcHeader string
+	decisionServer     string
+	decisionFormat     string
+	// conf is the configuration given with WithConfig or SetConfig when the snapshot was taken. It is nil when the
+	// package config is used, withRequestSettings then reads the current one for each phase.
+	conf *config.Config
+}
+
+// currentRequestSettings builds the settings from config and the settings overridden on New
+func (s *ProcessingServer) currentRequestSettings() *requestSettings {
+	conf := s.conf()
+	rs := &requestSettings{
+		decisionHeader:     config.RoutingDecisionHeader,
+		preferredSvcHeader: config.PreferredSvcHeader,
+		decisionServer:     conf.DecisionServer.URL,
+		decisionFormat:     conf.Decision.Format,
+	}
+	if s.fixedConfig.Load() {
+		rs.conf = s.cfg.Load()
+	}
+	if s.decisionHeader != "" {
+		rs.decisionHeader = s.decisionHeader
+	}
+	if s.preferredSvcHeader != "" {
+		rs.preferredSvcHeader = s.preferredSvcHeader
+	}
+	if s.decisionServer != "" {
+		rs.decisionServer = s.decisionServer
+	}
+	return rs
+}
+
+type requestSettingsKey struct{}
+
+// withRequestSettings returns the snapshot already carried by the context, or loads the current one and returns a
+// context carrying it for the rest of the phase
+func (s *ProcessingServer) withRequestSettings(ctx context.Context) (context.Context, *requestSettings) {
+	if rs, ok := ctx.Value(requestSettingsKey{}).(*requestSettings); ok {
+		return ctx, rs
+	}
+	rs := s.settings.Load()
+	if rs.conf == nil {
+		phase := *rs
+		phase.conf = config.FromEnv()
+		rs = &phase
+	}
+	return context.WithValue(ctx, requestSettingsKey{}, rs), rs
+}
+
+// confFor is the configuration of the snapshot carried by the context, see withRequestSettings, or the one in effect
+// when there is none
+func (s *ProcessingServer) confFor(ctx context.Context) *config.Config {
+	if rs, ok := ctx.Value(requestSettingsKey{}).(*requestSettings); ok {
+		return rs.conf
+	}
+	return s.conf()
+}
@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"context"
+	"time"
+)
+
+// callLimits bound a call to the decision server
+type callLimits struct {
+	// timeout is the budget of the call including retries, 0 means no budget
+	timeout time.Duration
+	retries int
+}
+
+// currentCallLimits returns the limits configured in the settings snapshot carried by ctx, or those overridden on New,
+// relaxed for the slow start window after the reachability probe first finds the decision server reachable, e.g.
+// after a deploy, so a cold decision server has time to warm up. The window only starts when something probes, such
+// as the health check.
+func (s *ProcessingServer) currentCallLimits(ctx context.Context) callLimits {
+	conf := s.confFor(ctx)
+	limits := callLimits{timeout: conf.DecisionServer.Timeout, retries: conf.DecisionServer.Retries}
+	if s.decisionTimeout != nil {
+		limits.timeout = *s.decisionTimeout
+	}
+	slowStart := conf.SlowStart
+	if slowStart.Window <= 0 {
+		return limits
+	}
+	if d, ok := s.probe.Load().reachableFor(); ok && d < slowStart.Window {
+		if limits.timeout > 0 {
+			// no budget at all is already as generous as it gets
+			limits.timeout = max(limits.timeout, slowStart.Timeout)
+		}
+		limits.retries = max(limits.retries, slowStart.Retries)
+	}
+	return limits
+}
@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestSlowStartRelaxesLimitsAfterDeploy(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RoutingDecisionTimeout, 500*time.Millisecond)
+	setConfig(t, &config.RoutingDecisionRetries, 0)
+	setConfig(t, &config.SlowStartWindow, time.Minute)
+	setConfig(t, &config.SlowStartTimeout, 5*time.Second)
+	setConfig(t, &config.SlowStartRetries, 3)
+
+	s := New(zap.NewNop())
+	now := time.Now()
+	s.probe.Load().now = func() time.Time { return now }
+	normal := callLimits{timeout: 500 * time.Millisecond, retries: 0}
+	relaxed := callLimits{timeout: 5 * time.Second, retries: 3}
+
+	require.Equal(t, normal, s.currentCallLimits(context.Background()), "nothing is relaxed before the decision server has been probed")
+	require.False(t, s.DecisionServerReachable(context.Background()))
+	require.Equal(t, normal, s.currentCallLimits(context.Background()))
+
+	healthy.Store(true)
+	now = now.Add(config.ProbeInterval)
+	require.True(t, s.DecisionServerReachable(context.Background()))
+	require.Equal(t, relaxed, s.currentCallLimits(context.Background()), "the window starts once the decision server is reachable")
+
+	now = now.Add(config.ProbeInterval)
+	require.True(t, s.DecisionServerReachable(context.Background()))
+	require.Equal(t, relaxed, s.currentCallLimits(context.Background()), "staying reachable doesn't restart the window")
+
+	now = now.Add(time.Minute - config.ProbeInterval)
+	require.Equal(t, normal, s.currentCallLimits(context.Background()), "the limits tighten once the window has passed")
+}
+
+func TestSlowStartNeverTightensLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RoutingDecisionTimeout, 0)
+	setConfig(t, &config.RoutingDecisionRetries, 5)
+	setConfig(t, &config.SlowStartWindow, time.Minute)
+
+	s := New(zap.NewNop())
+	require.True(t, s.DecisionServerReachable(context.Background()))
+	limits := s.currentCallLimits(context.Background())
+	require.Equal(t, 5, limits.retries)
+	require.Zero(t, limits.timeout, "no budget stays no budget")
+}
+
+func TestSlowStartDisabled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+
+	s := New(zap.NewNop())
+	require.True(t, s.DecisionServerReachable(context.Background()))
+	require.Equal(t, callLimits{timeout: config.RoutingDecisionTimeout, retries: config.RoutingDecisionRetries}, s.currentCallLimits(context.Background()))
+}
+
+func TestCallLimitsFromSnapshot(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionTimeout, time.Second)
+	s := New(zap.NewNop())
+	ctx, _ := s.withRequestSettings(context.Background())
+
+	setConfig(t, &config.RoutingDecisionTimeout, 2*time.Second)
+	require.Equal(t, time.Second, s.currentCallLimits(ctx).timeout, "a phase keeps the limits of its snapshot")
+	require.Equal(t, 2*time.Second, s.currentCallLimits(context.Background()).timeout)
+}
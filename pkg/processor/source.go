@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"slices"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+// where a decision came from
+const (
+	sourceHeader   = "header"
+	sourceCache    = "cache"
+	sourceExternal = "external"
+	sourceBody     = "body"
+	sourceSticky   = "sticky"
+	// no decision was applied so the request takes its default route
+	sourceFallback = "fallback"
+)
+
+// otherDecisionLabel is the metric label of the decisions not in the metrics decision labels
+const otherDecisionLabel = "other"
+
+// number of buckets the decision source window is split into
+const decisionSourceBuckets = 60
+
+// DecisionSources is the breakdown of where decisions came from over the recent window
+type DecisionSources struct {
+	WindowSeconds float64            `json:"window_seconds"`
+	Total         uint64             `json:"total"`
+	Counts        map[string]uint64  `json:"counts"`
+	Fractions     map[string]float64 `json:"fractions"`
+}
+
+// recordSource records where the decision of the stream came from
+func (s *ProcessingServer) recordSource(st *streamState, source string) {
+	st.source = source
+	metrics.DecisionSources.WithLabelValues(source).Inc()
+	s.sources.add(source)
+}
+
+// decisionLabel is the metric label of the decision. Only allowlisted decisions get their own label so the number of
+// series stays bounded whatever the decision server returns.
+func decisionLabel(conf *config.Config, decision string) string {
+	if slices.Contains(conf.MetricsLabels, decision) {
+		return decision
+	}
+	return otherDecisionLabel
+}
+
+// DecisionSources returns where decisions came from over the recent window
+func (s *ProcessingServer) DecisionSources() DecisionSources {
+	counts := s.sources.counts()
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	fractions := make(map[string]float64, len(counts))
+	for source, n := range counts {
+		fractions[source] = float64(n) / float64(total)
+	}
+	return DecisionSources{
+		WindowSeconds: s.sources.window().Seconds(),
+		Total:         total,
+		Counts:        counts,
+		Fractions:     fractions,
+	}
+}
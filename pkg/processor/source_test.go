@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
+)
+
+func TestAppliedDecisionsLabelBounded(t *testing.T) {
+	setConfig(t, &config.MetricsDecisionLabels, []string{"checkout", "search"})
+
+	checkout := testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("checkout", sourceHeader))
+	other := testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues(otherDecisionLabel, sourceHeader))
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	for _, decision := range []string{"checkout", "checkout", "random-1", "random-2"} {
+		h.send(h.stream(), requestHeadersMessage("preferred-svc", decision))
+	}
+
+	require.Equal(t, checkout+2, testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("checkout", sourceHeader)))
+	require.Equal(t, other+2, testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues(otherDecisionLabel, sourceHeader)))
+	require.Zero(t, testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("random-1", sourceHeader)))
+}
+
+func TestAppliedDecisionsLabelsFollowSetConfig(t *testing.T) {
+	conf := config.FromEnv()
+	conf.MetricsLabels = nil
+	s := New(zap.NewNop(), WithConfig(conf))
+	h := newTestHarness(t, s)
+
+	labelled := testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("billing", sourceHeader))
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", "billing"))
+	require.Equal(t, labelled, testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("billing", sourceHeader)))
+
+	reloaded := *conf
+	reloaded.MetricsLabels = []string{"billing"}
+	s.SetConfig(&reloaded)
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", "billing"))
+	require.Equal(t, labelled+1, testutil.ToFloat64(metrics.AppliedDecisions.WithLabelValues("billing", sourceHeader)))
+}
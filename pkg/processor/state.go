@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"context"
+	"time"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/logging"
+)
+
+// streamState is what a single Process stream remembers between messages so the response phase can use the decision
+// made on the request phase. Each stream gets its own state which is never shared with other streams.
+type streamState struct {
+	// log carries the request ID of the stream once the request headers arrived, see logFor
+	log *zap.Logger
+	// decision is the decision applied to the request, empty when none was applied
+	decision string
+	// preferredSvc is the preferred svc header value sent by the client
+	preferredSvc string
+	// source is where the decision came from, empty until one was made
+	source string
+	// decidedAt is when the decision was applied
+	decidedAt time.Time
+	// requestStart is when the request phase of the stream started
+	requestStart time.Time
+	// correlationID correlates the decision made on the request path with the response sent to the client
+	correlationID string
+	// awaitingBody is set while the decision waits for the request body, see handleRequestBody
+	awaitingBody bool
+	// headers are the request headers kept for deciding once the body has arrived
+	headers *ext_proc_v3.HttpHeaders
+	// body is the request body buffered so far
+	body []byte
+	// bodyDecision is the decision found in the request body, empty when there was none
+	bodyDecision string
+	// cacheOutcome is whether the decision cache was hit, empty when it wasn't looked up
+	cacheOutcome string
+	// legacyPreferredSvc is set when the preferred svc came from config.LegacyPreferredSvcHeader
+	legacyPreferredSvc bool
+}
+
+// startRequest forgets the body of the previous request, waiting for the body of this one when awaitBody is set
+func (st *streamState) startRequest(in *ext_proc_v3.HttpHeaders, awaitBody bool) {
+	st.awaitingBody = awaitBody
+	st.headers = in
+	st.body = nil
+	st.bodyDecision = ""
+	st.cacheOutcome = ""
+	st.legacyPreferredSvc = false
+}
+
+// requestLogger ties the log lines of the stream to the request by its x-request-id, generating an ID when Envoy
+// didn't send one
+func requestLogger(conf *config.Config, log *zap.Logger, in *ext_proc_v3.HttpHeaders) *zap.Logger {
+	id := getHeaderValue(conf, in, "x-request-id")
+	if id == "" {
+		id = uuid.NewString()
+	}
+	return log.With(zap.String("request_id", id))
+}
+
+// logFor is the logger of the stream, which carries the request ID once it is known
+func (s *ProcessingServer) logFor(st *streamState) *zap.Logger {
+	if st.log != nil {
+		return st.log
+	}
+	return s.log
+}
+
+type clientLogKey struct{}
+
+// withClientLog derives the decision client logger from the logger of the stream so the decision server calls made for
+// the request carry its request ID too
+func withClientLog(ctx context.Context, st *streamState) context.Context {
+	if st.log == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, clientLogKey{}, st.log.Named(logging.DecisionClient))
+}
+
+// clientLogFor is the decision client logger of the request, see withClientLog
+func (s *ProcessingServer) clientLogFor(ctx context.Context) *zap.Logger {
+	if log, ok := ctx.Value(clientLogKey{}).(*zap.Logger); ok {
+		return log
+	}
+	return s.clientLog
+}
+
+// applied records the decision applied to the request
+func (st *streamState) applied(decision string, at time.Time) {
+	st.decision = decision
+	st.decidedAt = at
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/logging"
+)
+
+func TestStreamStateRecordsDecision(t *testing.T) {
+	st := &streamState{}
+	before := time.Now()
+	_, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), st, requestHeaders("preferred-svc", "foo"))
+	require.NoError(t, err)
+
+	require.Equal(t, "foo", st.decision)
+	require.Equal(t, "foo", st.preferredSvc)
+	require.False(t, st.decidedAt.Before(before))
+}
+
+func TestStreamStateSuppressedDecisionNotRecorded(t *testing.T) {
+	setConfig(t, &config.MutationRolloutPercent, 0)
+
+	st := &streamState{}
+	_, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), st, requestHeaders("preferred-svc", "foo"))
+	require.NoError(t, err)
+
+	require.Empty(t, st.decision)
+	require.True(t, st.decidedAt.IsZero())
+}
+
+func TestStreamLogsCarryRequestID(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	setConfig(t, &config.DeniedServices, []string{"internal"})
+	srv, _ := countingDecisionServer(t, "foo")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+
+	h := newTestHarness(t, New(zap.New(core)))
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", "internal", "x-request-id", "req-1"))
+	denied := logs.FilterMessage("preferred svc is denied, rejecting the request").All()
+	require.Len(t, denied, 1)
+	require.Equal(t, "req-1", denied[0].ContextMap()["request_id"])
+
+	h.send(h.stream(), requestHeadersMessage("preferred-svc", "internal"))
+	denied = logs.FilterMessage("preferred svc is denied, rejecting the request").All()
+	require.Len(t, denied, 2)
+	id, _ := denied[1].ContextMap()["request_id"].(string)
+	_, err := uuid.Parse(id)
+	require.NoError(t, err, "a request ID should be generated when Envoy didn't send one")
+
+	// the decision server calls made for the request are logged with its ID too
+	h.send(h.stream(), requestHeadersMessage("x-request-id", "req-2"))
+	calls := logs.FilterMessage("calling the external service").All()
+	require.Len(t, calls, 1)
+	require.Equal(t, "req-2", calls[0].ContextMap()["request_id"])
+	require.Equal(t, logging.DecisionClient, calls[0].LoggerName)
+}
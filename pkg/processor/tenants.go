@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// tenantServers maps tenants to their own decision server. The map is read from a JSON file of tenant to URL, e.g.
+// {"acme": "http://decision.acme:8080/decision"}, which is checked for changes at most once per interval so edits
+// are picked up without a restart. A file which can't be read or parsed keeps the last good map.
+type tenantServers struct {
+	path     string
+	interval time.Duration
+	log      *zap.Logger
+	now      func() time.Time
+
+	mu        sync.Mutex
+	servers   map[string]string
+	checkedAt time.Time
+	modTime   time.Time
+}
+
+func newTenantServers(log *zap.Logger, path string, interval time.Duration) *tenantServers {
+	t := &tenantServers{path: path, interval: interval, log: log, now: time.Now}
+	t.mu.Lock()
+	t.refresh()
+	t.mu.Unlock()
+	return t
+}
+
+// server returns the decision server of the tenant, reporting false for a tenant without its own server
+func (t *tenantServers) server(tenant string) (string, bool) {
+	if tenant == "" {
+		return "", false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.now().Sub(t.checkedAt) >= t.interval {
+		t.refresh()
+	}
+	server, ok := t.servers[tenant]
+	return server, ok
+}
+
+// refresh re-reads the file when it was modified since it was last read, t.mu must be held
+func (t *tenantServers) refresh() {
+	t.checkedAt = t.now()
+	info, err := os.Stat(t.path)
+	if err != nil {
+		t.log.Error("failed to stat the tenant decision servers file, keeping the current servers", zap.String("path", t.path), zap.Error(err))
+		return
+	}
+	if info.ModTime().Equal(t.modTime) {
+		return
+	}
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		t.log.Error("failed to read the tenant decision servers file, keeping the current servers", zap.String("path", t.path), zap.Error(err))
+		return
+	}
+	var servers map[string]string
+	if err := json.Unmarshal(data, &servers); err != nil {
+		t.log.Error("failed to parse the tenant decision servers file, keeping the current servers", zap.String("path", t.path), zap.Error(err))
+		return
+	}
+	for tenant, server := range servers {
+		normalized, err := config.ParseDecisionServer(server)
+		if err != nil || normalized == "" {
+			t.log.Error("skipping the invalid decision server of a tenant", zap.String("tenant", tenant), zap.Error(err))
+			delete(servers, tenant)
+			continue
+		}
+		servers[tenant] = normalized
+	}
+	t.log.Info("loaded the tenant decision servers", zap.String("path", t.path), zap.Int("tenants", len(servers)))
+	t.servers = servers
+	t.modTime = info.ModTime()
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// writeTenantServers writes the tenant servers file, moving its modification time on so the change is always noticed
+func writeTenantServers(t *testing.T, path, content string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestTenantDecisionServers(t *testing.T) {
+	def, defCalls := countingDecisionServer(t, "default")
+	acme, acmeCalls := countingDecisionServer(t, "acme")
+	globex, _ := countingDecisionServer(t, "globex")
+
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	writeTenantServers(t, path, `{"acme": "`+acme.URL+`"}`, time.Now().Add(-time.Minute))
+	setConfig(t, &config.RoutingDecisionServer, def.URL)
+	setConfig(t, &config.TenantServersFile, path)
+	setConfig(t, &config.TenantServersCheckInterval, 0)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+
+	resp := h.send(h.stream(), requestHeadersMessage("x-tenant", "acme"))
+	require.Equal(t, "acme", decisionHeader(resp.GetRequestHeaders()))
+	require.EqualValues(t, 1, acmeCalls.Load())
+
+	resp = h.send(h.stream(), requestHeadersMessage("x-tenant", "globex"))
+	require.Equal(t, "default", decisionHeader(resp.GetRequestHeaders()), "a tenant without its own server uses the default")
+	resp = h.send(h.stream(), requestHeadersMessage())
+	require.Equal(t, "default", decisionHeader(resp.GetRequestHeaders()))
+	require.EqualValues(t, 2, defCalls.Load())
+
+	writeTenantServers(t, path, `{"acme": "`+acme.URL+`", "globex": "`+globex.URL+`"}`, time.Now())
+	resp = h.send(h.stream(), requestHeadersMessage("x-tenant", "globex"))
+	require.Equal(t, "globex", decisionHeader(resp.GetRequestHeaders()), "a tenant added to the file should be picked up")
+}
+
+func TestTenantServersKeepLastGoodMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	writeTenantServers(t, path, `{"acme": "http://acme"}`, time.Now().Add(-time.Minute))
+
+	tenants := newTenantServers(zap.NewNop(), path, 0)
+	server, ok := tenants.server("acme")
+	require.True(t, ok)
+	require.Equal(t, "http://acme", server)
+
+	writeTenantServers(t, path, `{"acme": `, time.Now())
+	server, ok = tenants.server("acme")
+	require.True(t, ok, "a broken file should keep the servers already loaded")
+	require.Equal(t, "http://acme", server)
+
+	require.NoError(t, os.Remove(path))
+	_, ok = tenants.server("acme")
+	require.True(t, ok)
+	_, ok = tenants.server("")
+	require.False(t, ok)
+}
+
+func TestTenantServersCheckedOncePerInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	writeTenantServers(t, path, `{}`, time.Now().Add(-time.Minute))
+
+	tenants := newTenantServers(zap.NewNop(), path, time.Minute)
+	now := tenants.checkedAt
+	tenants.now = func() time.Time { return now }
+
+	writeTenantServers(t, path, `{"acme": "http://acme"}`, time.Now())
+	_, ok := tenants.server("acme")
+	require.False(t, ok, "the file isn't checked again within the interval")
+
+	now = now.Add(time.Minute)
+	_, ok = tenants.server("acme")
+	require.True(t, ok)
+}
+
+func TestTenantServersSkipInvalidURLs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	writeTenantServers(t, path, `{"acme": "decision.acme:8080", "globex": "ftp://globex"}`, time.Now())
+
+	tenants := newTenantServers(zap.NewNop(), path, time.Minute)
+	server, ok := tenants.server("acme")
+	require.True(t, ok)
+	require.Equal(t, "http://decision.acme:8080", server)
+	_, ok = tenants.server("globex")
+	require.False(t, ok)
+}
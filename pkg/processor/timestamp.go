@@ -0,0 +1,16 @@
+package processor
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// formatTimestamp renders the time as epoch milliseconds or, by default, as RFC3339 with sub-second precision
+func formatTimestamp(t time.Time, format string) string {
+	if format == config.TimestampEpochMillis {
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
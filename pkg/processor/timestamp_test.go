@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestRequestStartHeaderRFC3339(t *testing.T) {
+	setConfig(t, &config.RequestStartHeader, "x-request-start")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	before := time.Now()
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+
+	stamp, err := time.Parse(time.RFC3339Nano, setHeader(resp.GetRequestHeaders().GetResponse().GetHeaderMutation(), "x-request-start"))
+	require.NoError(t, err)
+	require.WithinDuration(t, before, stamp, time.Second)
+}
+
+func TestRequestStartHeaderEpochMillis(t *testing.T) {
+	setConfig(t, &config.RequestStartHeader, "x-request-start")
+	setConfig(t, &config.RequestStartFormat, config.TimestampEpochMillis)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	before := time.Now()
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+
+	millis, err := strconv.ParseInt(setHeader(resp.GetRequestHeaders().GetResponse().GetHeaderMutation(), "x-request-start"), 10, 64)
+	require.NoError(t, err)
+	require.WithinDuration(t, before, time.UnixMilli(millis), time.Second)
+}
+
+func TestRequestStartHeaderWithoutDecision(t *testing.T) {
+	setConfig(t, &config.RequestStartHeader, "x-request-start")
+	setConfig(t, &config.EmptyPreferredSvcNoDecision, true)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", ""))
+
+	mutation := resp.GetRequestHeaders().GetResponse().GetHeaderMutation()
+	require.NotEmpty(t, setHeader(mutation, "x-request-start"))
+	require.Empty(t, setHeader(mutation, config.RoutingDecisionHeader))
+}
+
+func TestRequestStartHeaderDisabled(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("preferred-svc", "foo"))
+	require.Len(t, resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders(), 1)
+}
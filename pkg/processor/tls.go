@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// sessionCacheSize is the most decision servers TLS sessions are kept for per client
+const sessionCacheSize = 64
+
+// tlsSettings are the TLS settings of the connections to the decision server. Clients are rebuilt, dropping any
+// resumable sessions, when they change.
+type tlsSettings struct {
+	// PEM encoded CAs trusted for the decision server, the system roots when empty
+	caPEM         string
+	sessionMaxAge time.Duration
+}
+
+// currentTLSSettings reads the CA file so that a rotated CA shows up as changed settings
+func currentTLSSettings(conf *config.Config) (tlsSettings, error) {
+	s := tlsSettings{sessionMaxAge: conf.DecisionServer.TLSSessionMaxAge}
+	if conf.DecisionServer.CAFile == "" {
+		return s, nil
+	}
+	pem, err := os.ReadFile(conf.DecisionServer.CAFile)
+	if err != nil {
+		return s, err
+	}
+	s.caPEM = string(pem)
+	return s, nil
+}
+
+// clientConfig returns the TLS config of a new client. Sessions are only resumed when they have a maximum age.
+func (s tlsSettings) clientConfig() (*tls.Config, error) {
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.caPEM != "" {
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM([]byte(s.caPEM)) {
+			return nil, errors.New("no certificates found in the decision server CA file")
+		}
+	}
+	if s.sessionMaxAge > 0 {
+		c.ClientSessionCache = newSessionCache(s.sessionMaxAge, sessionCacheSize)
+	}
+	return c, nil
+}
+
+// sessionCache is a tls.ClientSessionCache whose sessions are only resumed up to a maximum age
+type sessionCache struct {
+	maxAge time.Duration
+	size   int
+	now    func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]cachedSession
+}
+
+type cachedSession struct {
+	state    *tls.ClientSessionState
+	storedAt time.Time
+}
+
+func newSessionCache(maxAge time.Duration, size int) *sessionCache {
+	return &sessionCache{maxAge: maxAge, size: size, now: time.Now, sessions: map[string]cachedSession{}}
+}
+
+func (c *sessionCache) Get(key string) (*tls.ClientSessionState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.sessions[key]
+	if !ok {
+		return nil, false
+	}
+	if c.now().Sub(s.storedAt) >= c.maxAge {
+		delete(c.sessions, key)
+		return nil, false
+	}
+	return s.state, true
+}
+
+func (c *sessionCache) Put(key string, state *tls.ClientSessionState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if state == nil {
+		delete(c.sessions, key)
+		return
+	}
+	if _, ok := c.sessions[key]; !ok && len(c.sessions) >= c.size {
+		c.evictOldest()
+	}
+	c.sessions[key] = cachedSession{state: state, storedAt: c.now()}
+}
+
+func (c *sessionCache) evictOldest() {
+	var oldest string
+	var oldestAt time.Time
+	for key, s := range c.sessions {
+		if oldest == "" || s.storedAt.Before(oldestAt) {
+			oldest, oldestAt = key, s.storedAt
+		}
+	}
+	delete(c.sessions, oldest)
+}
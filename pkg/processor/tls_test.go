@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// resumingTLSServer reports through the channel whether each request came in on a resumed TLS session
+func resumingTLSServer(t *testing.T) (*httptest.Server, <-chan bool) {
+	resumed := make(chan bool, 10)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resumed <- r.TLS.DidResume
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv, resumed
+}
+
+// writeCAFile writes the certificates of the servers to a CA file
+func writeCAFile(t *testing.T, path string, servers ...*httptest.Server) {
+	var data []byte
+	for _, srv := range servers {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})...)
+	}
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+// getOnNewConn calls the URL on a new connection, so the TLS session is resumed if the client can
+func getOnNewConn(t *testing.T, p *transportPools, url string) {
+	c := p.client(url)
+	c.CloseIdleConnections()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body) // nolint:errcheck
+	resp.Body.Close()
+}
+
+func tlsTransportPools(t *testing.T, srv *httptest.Server, maxAge time.Duration) *transportPools {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCAFile(t, caFile, srv)
+	setConfig(t, &config.DecisionServerCAFile, caFile)
+	setConfig(t, &config.DecisionServerTLSSessionMaxAge, maxAge)
+
+	tlsConf, err := currentTLSSettings(config.FromEnv())
+	require.NoError(t, err)
+	return newTransportPools(zap.NewNop(), config.DecisionServerPool, nil, tlsConf)
+}
+
+func TestTLSSessionResumed(t *testing.T) {
+	srv, resumed := resumingTLSServer(t)
+	p := tlsTransportPools(t, srv, time.Minute)
+
+	getOnNewConn(t, p, srv.URL)
+	require.False(t, <-resumed)
+	getOnNewConn(t, p, srv.URL)
+	require.True(t, <-resumed)
+}
+
+func TestTLSSessionResumptionDisabled(t *testing.T) {
+	srv, resumed := resumingTLSServer(t)
+	p := tlsTransportPools(t, srv, 0)
+
+	getOnNewConn(t, p, srv.URL)
+	require.False(t, <-resumed)
+	getOnNewConn(t, p, srv.URL)
+	require.False(t, <-resumed)
+}
+
+func TestTLSSessionsDroppedOnCARotation(t *testing.T) {
+	srv, resumed := resumingTLSServer(t)
+	other := httptest.NewTLSServer(http.NotFoundHandler())
+	defer other.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCAFile(t, caFile, srv)
+	setConfig(t, &config.DecisionServerCAFile, caFile)
+	setConfig(t, &config.DecisionServerTLSSessionMaxAge, time.Minute)
+
+	s := New(zap.NewNop())
+	getOnNewConn(t, s.transport, srv.URL)
+	require.False(t, <-resumed)
+	getOnNewConn(t, s.transport, srv.URL)
+	require.True(t, <-resumed)
+
+	// reloading an unchanged CA file keeps the sessions
+	s.Reload()
+	getOnNewConn(t, s.transport, srv.URL)
+	require.True(t, <-resumed)
+
+	writeCAFile(t, caFile, other, srv)
+	s.Reload()
+	getOnNewConn(t, s.transport, srv.URL)
+	require.False(t, <-resumed, "a rotated CA should negotiate a new session")
+}
+
+func TestSessionCacheMaxAge(t *testing.T) {
+	now := time.Now()
+	c := newSessionCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	state := &tls.ClientSessionState{}
+	c.Put("a", state)
+	got, ok := c.Get("a")
+	require.True(t, ok)
+	require.Same(t, state, got)
+
+	now = now.Add(time.Minute)
+	_, ok = c.Get("a")
+	require.False(t, ok)
+}
+
+func TestSessionCacheBounded(t *testing.T) {
+	now := time.Now()
+	c := newSessionCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	for _, key := range []string{"a", "b", "c"} {
+		c.Put(key, &tls.ClientSessionState{})
+		now = now.Add(time.Second)
+	}
+	_, ok := c.Get("a")
+	require.False(t, ok, "the oldest session should be evicted")
+	_, ok = c.Get("c")
+	require.True(t, ok)
+
+	c.Put("c", nil)
+	_, ok = c.Get("c")
+	require.False(t, ok)
+}
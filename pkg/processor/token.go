@@ -0,0 +1,31 @@
+package processor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// DecisionClaims are the claims of the signed decision token
+type DecisionClaims struct {
+	Decision  string `json:"decision"`
+	RequestID string `json:"request_id,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+}
+
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// signDecisionToken builds a compact HS256 JWT so upstreams can verify the decision wasn't tampered with
+func signDecisionToken(key []byte, decision string, requestID string, now time.Time) (string, error) {
+	claims, err := json.Marshal(DecisionClaims{Decision: decision, RequestID: requestID, IssuedAt: now.Unix()})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
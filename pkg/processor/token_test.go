@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// verifyDecisionToken checks the signature the way an upstream would and returns the claims
+func verifyDecisionToken(t *testing.T, key []byte, token string) DecisionClaims {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"alg":"HS256","typ":"JWT"}`, string(header))
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	require.True(t, hmac.Equal(mac.Sum(nil), sig), "signature should verify with the key")
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims DecisionClaims
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	return claims
+}
+
+func TestSignDecisionToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	token, err := signDecisionToken([]byte("secret"), "foo", "req-1", now)
+	require.NoError(t, err)
+
+	claims := verifyDecisionToken(t, []byte("secret"), token)
+	require.Equal(t, DecisionClaims{Decision: "foo", RequestID: "req-1", IssuedAt: now.Unix()}, claims)
+
+	parts := strings.Split(token, ".")
+	mac := hmac.New(sha256.New, []byte("other"))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	require.NotEqual(t, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2])
+}
+
+func TestDecisionTokenEmitted(t *testing.T) {
+	setConfig(t, &config.DecisionTokenEnabled, true)
+	setConfig(t, &config.DecisionTokenKey, "secret")
+	setConfig(t, &config.DecisionTokenHeader, "x-routing-token")
+
+	s := New(zap.NewNop())
+	resp, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "foo", "x-request-id", "req-1"))
+	require.NoError(t, err)
+
+	token := setHeader(resp.Response.HeaderMutation, "x-routing-token")
+	require.NotEmpty(t, token)
+	claims := verifyDecisionToken(t, []byte("secret"), token)
+	require.Equal(t, "foo", claims.Decision)
+	require.Equal(t, "req-1", claims.RequestID)
+}
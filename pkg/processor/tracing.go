@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"context"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// tracerName is the instrumentation scope of the spans of the processor
+const tracerName = "github.com/day0ops/ext-proc-routing-decision/pkg/processor"
+
+// attributes of the spans of the processor
+const (
+	attrDecision       = attribute.Key("routing.decision")
+	attrDecisionSource = attribute.Key("routing.decision.source")
+)
+
+// traceContext reads the W3C traceparent and tracestate request headers
+var traceContext = propagation.TraceContext{}
+
+// headersCarrier reads the trace context from the request headers. Nothing is ever injected.
+type headersCarrier struct {
+	conf *config.Config
+	in   *ext_proc_v3.HttpHeaders
+}
+
+func (c headersCarrier) Get(key string) string {
+	return getHeaderValue(c.conf, c.in, key)
+}
+
+func (c headersCarrier) Set(string, string) {}
+
+func (c headersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.in.GetHeaders().GetHeaders()))
+	for _, h := range c.in.GetHeaders().GetHeaders() {
+		keys = append(keys, headerName(c.conf, h.Key))
+	}
+	return keys
+}
+
+// startStreamSpan starts the span of a stream once its request headers arrive, continuing the trace of the request
+// when it carries one
+func (s *ProcessingServer) startStreamSpan(ctx context.Context, in *ext_proc_v3.HttpHeaders) (context.Context, trace.Span) {
+	ctx = traceContext.Extract(ctx, headersCarrier{conf: s.confFor(ctx), in: in})
+	return s.tracer.Start(ctx, "ext_proc.Process", trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// endStreamSpan records the decision the stream ended up with and ends its span
+func endStreamSpan(span trace.Span, st *streamState) {
+	if st.decision != "" {
+		span.SetAttributes(attrDecision.String(st.decision))
+	}
+	if st.source != "" {
+		span.SetAttributes(attrDecisionSource.String(st.source))
+	}
+	span.End()
+}
+
+// WithTracerProvider traces streams and calls to the decision server with the provider, the global one by default
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *ProcessingServer) {
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
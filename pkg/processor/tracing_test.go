@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+// endedSpans waits for the spans of a closed stream to end, keyed by name
+func endedSpans(t *testing.T, sr *tracetest.SpanRecorder, n int) map[string]sdktrace.ReadOnlySpan {
+	require.Eventually(t, func() bool { return len(sr.Ended()) == n }, 5*time.Second, 10*time.Millisecond)
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range sr.Ended() {
+		spans[span.Name()] = span
+	}
+	return spans
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	return attrs
+}
+
+func TestTracingSpans(t *testing.T) {
+	srv, _ := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	sr := tracetest.NewSpanRecorder()
+
+	h := newTestHarness(t, New(zap.NewNop(), WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))))
+	stream := h.stream()
+	h.send(stream, requestHeadersMessage("traceparent", "00-"+testTraceID+"-"+testSpanID+"-01"))
+	require.NoError(t, stream.CloseSend())
+	_, err := stream.Recv()
+	require.ErrorIs(t, err, io.EOF)
+
+	spans := endedSpans(t, sr, 2)
+	process, fetch := spans["ext_proc.Process"], spans["fetchRoutingDecision"]
+	require.NotNil(t, process)
+	require.NotNil(t, fetch)
+
+	require.Equal(t, testTraceID, process.SpanContext().TraceID().String(), "the stream continues the trace of the request")
+	require.Equal(t, testSpanID, process.Parent().SpanID().String())
+	require.Equal(t, map[attribute.Key]string{attrDecision: "external", attrDecisionSource: sourceExternal}, spanAttributes(process))
+
+	require.Equal(t, process.SpanContext().SpanID(), fetch.Parent().SpanID(), "the decision server call is a child of the stream")
+	require.Equal(t, "external", spanAttributes(fetch)[attrDecision])
+}
+
+func TestTracingHeaderDecision(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+
+	h := newTestHarness(t, New(zap.NewNop(), WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))))
+	stream := h.stream()
+	h.send(stream, requestHeadersMessage("preferred-svc", "foo"))
+	require.NoError(t, stream.CloseSend())
+	_, err := stream.Recv()
+	require.ErrorIs(t, err, io.EOF)
+
+	spans := endedSpans(t, sr, 1)
+	process := spans["ext_proc.Process"]
+	require.NotNil(t, process)
+	require.False(t, process.Parent().IsValid(), "a request without a trace starts a new one")
+	require.Equal(t, map[attribute.Key]string{attrDecision: "foo", attrDecisionSource: sourceHeader}, spanAttributes(process))
+}
@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"go.uber.org/zap"
+)
+
+// generateTrailersDecision reads the decision a gRPC client sent in the decision trailer and sets it on the
+// trailers for the upstream. The request was routed by then, so it isn't recorded as the applied decision. A decision
+// preferring a denied service or routing to an upstream which isn't allowed is dropped, as are trailers without one.
+func (s *ProcessingServer) generateTrailersDecision(ctx context.Context, st *streamState, in *ext_proc_v3.HttpTrailers) *ext_proc_v3.TrailersResponse {
+	resp := &ext_proc_v3.TrailersResponse{}
+	_, rs := s.withRequestSettings(ctx)
+	conf := rs.conf
+	if conf.Decision.Trailer == "" {
+		return resp
+	}
+	decision := trailerValue(in.GetTrailers(), conf.Decision.Trailer)
+	if decision == "" {
+		s.logFor(st).Debug("no routing decision in the request trailers")
+		return resp
+	}
+
+	if slices.Contains(conf.DeniedServices.Services, decision) {
+		s.logFor(st).Debug("request trailers prefer a denied service, dropping the decision", zap.String("decision", decision))
+		return resp
+	}
+	if !upstreamAllowed(decision, conf.Decision.AllowedUpstreamHosts) {
+		s.logFor(st).Warn("request trailers route to an upstream which isn't allowed, dropping the decision", zap.String("decision", decision))
+		return resp
+	}
+	resp.HeaderMutation = &ext_proc_v3.HeaderMutation{
+		SetHeaders: []*core_v3.HeaderValueOption{setHeaderOption(conf, rs.decisionHeader, formatDecision(rs.decisionFormat, decision))},
+	}
+	return resp
+}
+
+// trailerValue returns the value of the trailer or an empty string when it isn't there
+func trailerValue(trailers *core_v3.HeaderMap, key string) string {
+	for _, t := range trailers.GetHeaders() {
+		if strings.EqualFold(t.Key, key) {
+			return string(t.RawValue)
+		}
+	}
+	return ""
+}
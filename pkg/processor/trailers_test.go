@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"testing"
+
+	ext_proc_filter_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func requestTrailersMessage(kv ...string) *ext_proc_v3.ProcessingRequest {
+	return &ext_proc_v3.ProcessingRequest{
+		Request: &ext_proc_v3.ProcessingRequest_RequestTrailers{
+			RequestTrailers: &ext_proc_v3.HttpTrailers{Trailers: requestHeaders(kv...).Headers},
+		},
+	}
+}
+
+func TestTrailersOverrideHeaderDecision(t *testing.T) {
+	setConfig(t, &config.DecisionTrailer, "x-routing-hint")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	resp := h.send(stream, requestHeadersMessage("preferred-svc", "foo"))
+	require.Equal(t, "foo", decisionHeader(resp.GetRequestHeaders()))
+
+	resp = h.send(stream, requestTrailersMessage("x-routing-hint", "bar"))
+	require.NotNil(t, resp.GetRequestTrailers())
+	require.Equal(t, "bar", setHeader(resp.GetRequestTrailers().GetHeaderMutation(), config.RoutingDecisionHeader))
+
+	resp = h.send(stream, responseHeadersMessage(":status", "200"))
+	require.Equal(t, "foo", setHeader(resp.GetResponseHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionAppliedHeader), "the request was routed on the headers")
+}
+
+func TestTrailersDecisionWithoutHeaderDecision(t *testing.T) {
+	setConfig(t, &config.DecisionTrailer, "x-routing-hint")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	resp := h.send(stream, requestTrailersMessage("X-Routing-Hint", "bar"))
+	require.Equal(t, "bar", setHeader(resp.GetRequestTrailers().GetHeaderMutation(), config.RoutingDecisionHeader))
+	resp = h.send(stream, responseHeadersMessage(":status", "200"))
+	require.Empty(t, setHeader(resp.GetResponseHeaders().GetResponse().GetHeaderMutation(), config.RoutingDecisionAppliedHeader), "the trailers didn't route the request")
+}
+
+func TestTrailersDecisionChecked(t *testing.T) {
+	setConfig(t, &config.DecisionTrailer, "x-routing-hint")
+	setConfig(t, &config.DeniedServices, []string{"internal"})
+	setConfig(t, &config.AllowedUpstreamHosts, []string{"allowed.svc"})
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	for _, decision := range []string{"internal", "other.svc"} {
+		resp := h.send(stream, requestTrailersMessage("x-routing-hint", decision))
+		require.Nil(t, resp.GetRequestTrailers().GetHeaderMutation(), decision)
+	}
+	resp := h.send(stream, requestTrailersMessage("x-routing-hint", "allowed.svc"))
+	require.Equal(t, "allowed.svc", setHeader(resp.GetRequestTrailers().GetHeaderMutation(), config.RoutingDecisionHeader))
+}
+
+func TestTrailersWithoutDecision(t *testing.T) {
+	setConfig(t, &config.DecisionTrailer, "x-routing-hint")
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	stream := h.stream()
+
+	resp := h.send(stream, requestTrailersMessage())
+	require.NotNil(t, resp.GetRequestTrailers())
+	require.Nil(t, resp.GetRequestTrailers().GetHeaderMutation())
+
+	resp = h.send(stream, &ext_proc_v3.ProcessingRequest{
+		Request: &ext_proc_v3.ProcessingRequest_RequestTrailers{RequestTrailers: &ext_proc_v3.HttpTrailers{}},
+	})
+	require.Nil(t, resp.GetRequestTrailers().GetHeaderMutation(), "a stream without trailers at all is fine")
+
+	resp = h.send(stream, requestTrailersMessage("x-routing-hint", ""))
+	require.Nil(t, resp.GetRequestTrailers().GetHeaderMutation())
+}
+
+func TestTrailersIgnoredWhenDisabled(t *testing.T) {
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestTrailersMessage("x-routing-hint", "bar"))
+	require.NotNil(t, resp.GetRequestTrailers())
+	require.Nil(t, resp.GetRequestTrailers().GetHeaderMutation())
+}
+
+func TestTrailerModeFollowsDecisionTrailer(t *testing.T) {
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_SKIP, unhandledPhasesMode(config.FromEnv()).GetRequestTrailerMode())
+	setConfig(t, &config.DecisionTrailer, "x-routing-hint")
+	require.Equal(t, ext_proc_filter_v3.ProcessingMode_SEND, unhandledPhasesMode(config.FromEnv()).GetRequestTrailerMode())
+}
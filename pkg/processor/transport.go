@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// transportPools hands out an HTTP client per decision server so each host gets its own tuned connection pool.
+// Clients are created the first time a host is called.
+type transportPools struct {
+	log   *zap.Logger
+	def   config.TransportPool
+	pools map[string]config.TransportPool
+
+	mu      sync.Mutex
+	tls     tlsSettings
+	clients map[string]*http.Client
+}
+
+func newTransportPools(log *zap.Logger, def config.TransportPool, pools map[string]config.TransportPool, tls tlsSettings) *transportPools {
+	return &transportPools{log: log, def: def, pools: pools, tls: tls, clients: map[string]*http.Client{}}
+}
+
+// tlsSettings returns the TLS settings clients are currently created with
+func (p *transportPools) tlsSettings() tlsSettings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tls
+}
+
+// rotate drops every client along with its idle connections and TLS sessions so that the next calls negotiate
+// with the new TLS settings. Requests already in flight finish on their connection.
+func (p *transportPools) rotate(tls tlsSettings) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.clients {
+		c.CloseIdleConnections()
+	}
+	p.tls = tls
+	p.clients = map[string]*http.Client{}
+}
+
+// client returns the client for the decision server the URL points at
+func (p *transportPools) client(rawURL string) *http.Client {
+	key, err := config.PoolKey(rawURL)
+	if err != nil {
+		// the request will fail on the URL anyway
+		return http.DefaultClient
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.clients[key]; ok {
+		return c
+	}
+
+	pool, ok := p.pools[key]
+	if !ok {
+		pool = p.def
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = pool.MaxIdleConns
+	transport.MaxIdleConnsPerHost = pool.MaxIdleConns
+	// 0 is no limit for MaxIdleConns and the default of 2 for MaxIdleConnsPerHost, while no idle connection is meant
+	transport.DisableKeepAlives = pool.MaxIdleConns == 0
+	transport.IdleConnTimeout = pool.IdleConnTimeout
+	if tlsConf, err := p.tls.clientConfig(); err != nil {
+		p.log.Error("invalid decision server TLS settings, using the defaults", zap.Error(err))
+	} else {
+		transport.TLSClientConfig = tlsConf
+	}
+
+	c := &http.Client{Transport: transport}
+	p.clients[key] = c
+	return c
+}
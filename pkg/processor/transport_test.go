@@ -0,0 +1,89 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestTransportPoolsPerHost(t *testing.T) {
+	p := newTransportPools(zap.NewNop(), config.TransportPool{MaxIdleConns: 4, IdleConnTimeout: time.Minute}, map[string]config.TransportPool{
+		"http://decision-b:8080": {MaxIdleConns: 32, IdleConnTimeout: 5 * time.Second},
+	}, tlsSettings{})
+
+	a := p.client("http://decision-a:8080/decision")
+	b := p.client("http://decision-b:8080/decision")
+	require.NotSame(t, a, b)
+	require.NotSame(t, a.Transport, b.Transport)
+
+	require.Same(t, a, p.client("http://DECISION-A:8080/other"), "the same host should reuse its pool")
+	require.NotSame(t, a, p.client("https://decision-a:8080/decision"), "a different scheme is a different server")
+
+	ta := a.Transport.(*http.Transport)
+	require.Equal(t, 4, ta.MaxIdleConnsPerHost)
+	require.Equal(t, time.Minute, ta.IdleConnTimeout)
+	tb := b.Transport.(*http.Transport)
+	require.Equal(t, 32, tb.MaxIdleConnsPerHost)
+	require.Equal(t, 5*time.Second, tb.IdleConnTimeout)
+}
+
+func TestTransportPoolReusesConnections(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	var newConns atomic.Int32
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	p := newTransportPools(zap.NewNop(), config.TransportPool{MaxIdleConns: 4, IdleConnTimeout: time.Minute}, nil, tlsSettings{})
+	for range 3 {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		resp, err := p.client(srv.URL).Do(req)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body) // nolint:errcheck
+		resp.Body.Close()
+	}
+	require.EqualValues(t, 1, newConns.Load())
+}
+
+func TestTransportPoolDisabled(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"decision":"foo"}`)) // nolint:errcheck
+	}))
+	var newConns atomic.Int32
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	p := newTransportPools(zap.NewNop(), config.TransportPool{MaxIdleConns: 0, IdleConnTimeout: time.Minute}, nil, tlsSettings{})
+	require.True(t, p.client(srv.URL).Transport.(*http.Transport).DisableKeepAlives)
+	for range 3 {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		resp, err := p.client(srv.URL).Do(req)
+		require.NoError(t, err)
+		io.Copy(io.Discard, resp.Body) // nolint:errcheck
+		resp.Body.Close()
+	}
+	require.EqualValues(t, 3, newConns.Load(), "no connection should be reused without pooling")
+}
@@ -0,0 +1,24 @@
+package processor
+
+import (
+	"net"
+	"strings"
+)
+
+// upstreamAllowed reports whether the decision, a host or cluster name, is in the allowlist. An entry without a port
+// allows the host on any port. An empty allowlist allows every upstream.
+func upstreamAllowed(decision string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	host := decision
+	if h, _, err := net.SplitHostPort(decision); err == nil {
+		host = h
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, decision) || strings.EqualFold(a, host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestUpstreamAllowed(t *testing.T) {
+	allowed := []string{"svc-a.internal", "svc-b.internal:8443", "outbound|80||reviews"}
+
+	require.True(t, upstreamAllowed("svc-a.internal", allowed))
+	require.True(t, upstreamAllowed("SVC-A.internal:8080", allowed), "a host entry allows any port")
+	require.True(t, upstreamAllowed("svc-b.internal:8443", allowed))
+	require.True(t, upstreamAllowed("outbound|80||reviews", allowed))
+
+	require.False(t, upstreamAllowed("svc-b.internal:9000", allowed))
+	require.False(t, upstreamAllowed("evil.example.com", allowed))
+
+	require.True(t, upstreamAllowed("anything", nil))
+}
+
+func TestAllowedUpstreamApplied(t *testing.T) {
+	setConfig(t, &config.AllowedUpstreamHosts, []string{"foo"})
+
+	resp, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), &streamState{}, requestHeaders("preferred-svc", "foo"))
+	require.NoError(t, err)
+	require.Equal(t, "foo", decisionHeader(resp))
+}
+
+func TestDisallowedUpstreamFallback(t *testing.T) {
+	setConfig(t, &config.AllowedUpstreamHosts, []string{"foo"})
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "evil").URL)
+
+	st := &streamState{}
+	resp, err := New(zap.NewNop()).generateRoutingDecision(context.Background(), st, requestHeaders(":path", "/"))
+	require.NoError(t, err)
+	require.Nil(t, resp.GetResponse().GetHeaderMutation())
+	require.Empty(t, st.decision)
+}
+
+func TestDisallowedUpstreamDeny(t *testing.T) {
+	setConfig(t, &config.AllowedUpstreamHosts, []string{"foo"})
+	setConfig(t, &config.DisallowedUpstreamAction, config.DisallowedUpstreamDeny)
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "evil").URL)
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage(":path", "/"))
+
+	immediate := resp.GetImmediateResponse()
+	require.NotNil(t, immediate)
+	require.EqualValues(t, http.StatusForbidden, immediate.GetStatus().GetCode())
+	var p Problem
+	require.NoError(t, json.Unmarshal([]byte(immediate.GetBody()), &p))
+	require.Equal(t, http.StatusForbidden, p.Status)
+}
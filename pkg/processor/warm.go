@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// warmCache fills the decision cache from the file, logging rather than failing as the cache is only an optimization
+func (s *ProcessingServer) warmCache(path string, ttl time.Duration) {
+	cache := s.cache.Load()
+	if cache == nil {
+		s.log.Warn("decision caching is disabled, ignoring the cache warm file", zap.String("path", path))
+		return
+	}
+	warmed, err := loadWarmFile(s.log, cache, path, ttl)
+	if err != nil {
+		s.log.Error("failed to warm the decision cache", zap.String("path", path), zap.Error(err))
+		return
+	}
+	s.log.Info("warmed the decision cache", zap.String("path", path), zap.Int("entries", warmed))
+}
+
+// loadWarmFile fills the cache from a JSON file of decision key to decision, e.g. {"GET /orders": "orders-v2"}, so a
+// restarted processor doesn't start cold. The entries expire after ttl, or the cache's own TTL when it is 0. Entries
+// which aren't a non-empty key to a non-empty string are skipped. It returns how many entries were cached.
+func loadWarmFile(log *zap.Logger, cache *decisionCache, path string, ttl time.Duration) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, fmt.Errorf("cache warm file must be a JSON object of decision key to decision: %w", err)
+	}
+	if ttl <= 0 {
+		ttl = cache.ttl
+	}
+
+	warmed := 0
+	for key, raw := range entries {
+		var decision string
+		if err := json.Unmarshal(raw, &decision); err != nil || key == "" || decision == "" {
+			log.Warn("skipping invalid cache warm entry", zap.String("key", key), zap.ByteString("decision", raw))
+			continue
+		}
+		cache.setWithTTL(key, decision, ttl)
+		warmed++
+	}
+	return warmed, nil
+}
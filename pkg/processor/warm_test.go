@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func writeWarmFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "warm.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadWarmFile(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	cache := newDecisionCache(time.Hour, 0)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	path := writeWarmFile(t, `{"GET /orders": "orders-v2", "GET /users": "users", "bad": 42, "": "empty-key", "empty": ""}`)
+	warmed, err := loadWarmFile(zap.New(core), cache, path, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, 2, warmed)
+	require.Equal(t, 3, logs.FilterMessage("skipping invalid cache warm entry").Len())
+
+	decision, ok := cache.get("GET /orders")
+	require.True(t, ok)
+	require.Equal(t, "orders-v2", decision)
+
+	now = now.Add(time.Minute)
+	_, ok = cache.get("GET /orders")
+	require.False(t, ok, "warmed entries expire after the warm TTL rather than the cache TTL")
+}
+
+func TestLoadWarmFileInvalid(t *testing.T) {
+	cache := newDecisionCache(time.Hour, 0)
+	_, err := loadWarmFile(zap.NewNop(), cache, writeWarmFile(t, `["GET /orders"]`), 0)
+	require.Error(t, err)
+	require.Zero(t, cache.stats().Size)
+}
+
+func TestCacheWarmedOnStartup(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Hour)
+	setConfig(t, &config.CacheWarmFile, writeWarmFile(t, `{"/": "warm"}`))
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage(":path", "/"))
+	require.Equal(t, "warm", decisionHeader(resp.GetRequestHeaders()))
+	require.Zero(t, calls.Load())
+}
@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"hash/fnv"
+	"strings"
+
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// isWebSocketUpgrade reports whether the request asks to upgrade the connection to a WebSocket
+func isWebSocketUpgrade(conf *config.Config, in *ext_proc_v3.HttpHeaders) bool {
+	return strings.EqualFold(strings.TrimSpace(getHeaderValue(conf, in, "upgrade")), "websocket")
+}
+
+// stickyWebSocketDecision routes a WebSocket upgrade with the config.WebSocketStrategySticky strategy to one of the
+// WebSocket services by consistent hashing of its session, so reconnects of a session land on the same service. It
+// reports false when the strategy doesn't apply, e.g. without a session.
+func stickyWebSocketDecision(conf *config.Config, in *ext_proc_v3.HttpHeaders) (string, bool) {
+	ws := conf.WebSocket
+	if ws.Strategy != config.WebSocketStrategySticky || len(ws.Services) == 0 || !isWebSocketUpgrade(conf, in) {
+		return "", false
+	}
+	session := getHeaderValue(conf, in, ws.SessionHeader)
+	if session == "" {
+		return "", false
+	}
+	return rendezvousPick(ws.Services, session), true
+}
+
+// rendezvousPick returns the service scoring highest for the key. Adding or removing a service only moves the keys
+// which scored highest for that service.
+func rendezvousPick(services []string, key string) string {
+	var best string
+	var bestScore uint64
+	for _, service := range services {
+		h := fnv.New64a()
+		h.Write([]byte(service)) // nolint:errcheck
+		h.Write([]byte{0})       // nolint:errcheck
+		h.Write([]byte(key))     // nolint:errcheck
+		if score := mix64(h.Sum64()); best == "" || score > bestScore {
+			best, bestScore = service, score
+		}
+	}
+	return best
+}
+
+// mix64 spreads the bits of an FNV hash, whose high bits barely change between similar keys, so scores compare fairly
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
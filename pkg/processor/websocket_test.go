@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestStickyWebSocketUpgrade(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.WebSocketStrategy, config.WebSocketStrategySticky)
+	setConfig(t, &config.WebSocketServices, []string{"ws-a", "ws-b", "ws-c"})
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	upgrade := func(session string) string {
+		resp := h.send(h.stream(), requestHeadersMessage("upgrade", "WebSocket", "connection", "Upgrade", "x-session-id", session))
+		return decisionHeader(resp.GetRequestHeaders())
+	}
+
+	first := upgrade("session-1")
+	require.Contains(t, config.WebSocketServices, first)
+	require.Equal(t, first, upgrade("session-1"), "a reconnect should land on the same service")
+	require.Equal(t, rendezvousPick(config.WebSocketServices, "session-1"), first)
+	require.Zero(t, calls.Load(), "sticky upgrades aren't re-decided")
+
+	// plain requests and upgrades without a session are decided as usual
+	require.Equal(t, "external", decisionHeader(h.send(h.stream(), requestHeadersMessage("x-session-id", "session-1")).GetRequestHeaders()))
+	require.Equal(t, "external", decisionHeader(h.send(h.stream(), requestHeadersMessage("upgrade", "websocket")).GetRequestHeaders()))
+	require.EqualValues(t, 2, calls.Load())
+
+	// the preferred svc still wins
+	require.Equal(t, "foo", decisionHeader(h.send(h.stream(), requestHeadersMessage("upgrade", "websocket", "x-session-id", "session-1", "preferred-svc", "foo")).GetRequestHeaders()))
+}
+
+func TestWebSocketUpgradeDecidedByDefault(t *testing.T) {
+	srv, calls := countingDecisionServer(t, "external")
+	setConfig(t, &config.RoutingDecisionServer, srv.URL)
+	setConfig(t, &config.WebSocketServices, []string{"ws-a"})
+
+	h := newTestHarness(t, New(zap.NewNop()))
+	resp := h.send(h.stream(), requestHeadersMessage("upgrade", "websocket", "x-session-id", "session-1"))
+	require.Equal(t, "external", decisionHeader(resp.GetRequestHeaders()))
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestRendezvousPickIsStable(t *testing.T) {
+	services := []string{"a", "b", "c", "d"}
+	moved := 0
+	for i := range 1000 {
+		key := fmt.Sprintf("session-%d", i)
+		before := rendezvousPick(services, key)
+		after := rendezvousPick(append(services[:len(services):len(services)], "e"), key)
+		if before != after {
+			require.Equal(t, "e", after, "keys only move to the added service")
+			moved++
+		}
+	}
+	require.InDelta(t, 200, moved, 60)
+}
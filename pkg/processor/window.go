@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"sync"
+	"time"
+)
+
+type windowBucket struct {
+	start  time.Time
+	counts map[string]uint64
+}
+
+// windowCounter counts events by label over a sliding window made of fixed width buckets.
+// Buckets older than the window are reused as time moves on.
+type windowCounter struct {
+	mu      sync.Mutex
+	width   time.Duration
+	buckets []windowBucket
+	now     func() time.Time
+}
+
+func newWindowCounter(window time.Duration, buckets int) *windowCounter {
+	width := window / time.Duration(buckets)
+	if width <= 0 {
+		width = time.Nanosecond
+	}
+	return &windowCounter{width: width, buckets: make([]windowBucket, buckets), now: time.Now}
+}
+
+// window is the span of time counted by the counter
+func (w *windowCounter) window() time.Duration {
+	return w.width * time.Duration(len(w.buckets))
+}
+
+func (w *windowCounter) add(label string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	start := now.Truncate(w.width)
+	b := &w.buckets[int((now.UnixNano()/int64(w.width))%int64(len(w.buckets)))]
+	if !b.start.Equal(start) {
+		b.start = start
+		b.counts = map[string]uint64{}
+	}
+	b.counts[label]++
+}
+
+// counts returns the events counted by label within the window
+func (w *windowCounter) counts() map[string]uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	counts := map[string]uint64{}
+	for _, b := range w.buckets {
+		if b.counts == nil || now.Sub(b.start) >= w.window() {
+			continue
+		}
+		for label, n := range b.counts {
+			counts[label] += n
+		}
+	}
+	return counts
+}
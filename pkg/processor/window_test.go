@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+func TestWindowCounterSlides(t *testing.T) {
+	now := time.Unix(1000, 0)
+	w := newWindowCounter(time.Minute, 6)
+	w.now = func() time.Time { return now }
+
+	w.add("a")
+	w.add("b")
+	now = now.Add(30 * time.Second)
+	w.add("a")
+	require.Equal(t, map[string]uint64{"a": 2, "b": 1}, w.counts())
+
+	// the first bucket has left the window
+	now = now.Add(35 * time.Second)
+	require.Equal(t, map[string]uint64{"a": 1}, w.counts())
+
+	// a reused bucket starts from zero
+	now = now.Add(25 * time.Second)
+	w.add("b")
+	require.Equal(t, map[string]uint64{"b": 1}, w.counts())
+}
+
+func TestDecisionSourcesDistribution(t *testing.T) {
+	setConfig(t, &config.RoutingDecisionServer, decisionServer(t, "foo").URL)
+	setConfig(t, &config.RoutingDecisionCacheTTL, time.Minute)
+	setConfig(t, &config.EmptyPreferredSvcNoDecision, true)
+
+	s := New(zap.NewNop())
+	decide := func(kv ...string) {
+		_, err := s.generateRoutingDecision(context.Background(), &streamState{}, requestHeaders(kv...))
+		require.NoError(t, err)
+	}
+	decide("preferred-svc", "bar")
+	decide("preferred-svc", "bar")
+	decide(":path", "/a") // external
+	decide(":path", "/a") // cache
+	decide(":path", "/a") // cache
+	decide("preferred-svc", "")
+
+	sources := s.DecisionSources()
+	require.EqualValues(t, 6, sources.Total)
+	require.Equal(t, map[string]uint64{sourceHeader: 2, sourceExternal: 1, sourceCache: 2, sourceFallback: 1}, sources.Counts)
+	require.InDelta(t, 2.0/6, sources.Fractions[sourceCache], 1e-9)
+	require.InDelta(t, 1.0/6, sources.Fractions[sourceExternal], 1e-9)
+	require.Equal(t, config.DecisionSourceWindow.Seconds(), sources.WindowSeconds)
+}
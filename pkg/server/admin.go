@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/processor"
+)
+
+const (
+	defaultCacheDumpLimit = 100
+	maxCacheDumpLimit     = 1000
+)
+
+type adminServer struct {
+	enabled     bool
+	bindAddress string
+	token       string
+	mux         *http.ServeMux
+	httpsrv     *http.Server
+}
+
+type cacheDumpResponse struct {
+	Entries   []processor.CacheEntry `json:"entries"`
+	Total     int                    `json:"total"`
+	Truncated bool                   `json:"truncated"`
+}
+
+// requireToken only lets requests carrying the admin bearer token through. With no token configured nothing is allowed.
+func requireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !found || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// cacheDumpHandler writes the cached routing decisions bounded by the limit query parameter
+func cacheDumpHandler(p *processor.ProcessingServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := defaultCacheDumpLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		limit = min(limit, maxCacheDumpLimit)
+
+		entries, total := p.DumpCache(limit)
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(cacheDumpResponse{ // nolint:errcheck
+			Entries:   entries,
+			Total:     total,
+			Truncated: total > len(entries),
+		})
+	}
+}
+
+type debugInfoResponse struct {
+	DecisionSources processor.DecisionSources `json:"decision_sources"`
+}
+
+// debugInfoHandler writes runtime information about the processor, such as where recent decisions came from
+func debugInfoHandler(p *processor.ProcessingServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(debugInfoResponse{ // nolint:errcheck
+			DecisionSources: p.DecisionSources(),
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/processor"
+)
+
+func TestCacheDumpRequiresToken(t *testing.T) {
+	handler := requireToken("secret", cacheDumpHandler(processor.New(zap.NewNop())))
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		req := httptest.NewRequest(http.MethodGet, "/cache/dump", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		require.Equal(t, http.StatusUnauthorized, rr.Code, "authorization %q should be rejected", auth)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/cache/dump", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp cacheDumpResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Empty(t, resp.Entries)
+	require.Zero(t, resp.Total)
+}
+
+func TestCacheDumpRejectedWithoutConfiguredToken(t *testing.T) {
+	handler := requireToken("", cacheDumpHandler(processor.New(zap.NewNop())))
+
+	req := httptest.NewRequest(http.MethodGet, "/cache/dump", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestCacheDumpInvalidLimit(t *testing.T) {
+	handler := cacheDumpHandler(processor.New(zap.NewNop()))
+
+	req := httptest.NewRequest(http.MethodGet, "/cache/dump?limit=-1", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDebugInfo(t *testing.T) {
+	handler := debugInfoHandler(processor.New(zap.NewNop()))
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/debug/info", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp debugInfoResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Zero(t, resp.DecisionSources.Total)
+	require.Positive(t, resp.DecisionSources.WindowSeconds)
+}
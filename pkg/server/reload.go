@@ -0,0 +1,86 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// configReload reloads the configuration on SIGHUP, see WithConfigReload
+type configReload struct {
+	enabled bool
+	// the config file re-read on reload, there is nothing to reload when empty
+	path string
+	// the log levels the logger was built with, see ReloadConfig
+	logLevel  string
+	logLevels config.LogLevelsConfig
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// WithConfigReload reloads the configuration when the process receives SIGHUP. The config file at path is re-read
+// and swapped into the processor without dropping the open streams. Without a config file a SIGHUP is logged and
+// ignored as the environment is only read at startup. Settings of the server itself, such as the grpc listener and
+// TLS, only apply on restart.
+func WithConfigReload(path string) Option {
+	return func(s *Server) {
+		s.reload.enabled = true
+		s.reload.path = path
+		s.reload.stop = make(chan struct{})
+	}
+}
+
+// watchReload reloads the configuration on every SIGHUP until the server is stopped
+func (s *Server) watchReload() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-s.reload.stop:
+				return
+			case <-signals:
+				if err := s.ReloadConfig(); err != nil {
+					s.log.Error("failed to reload the configuration, keeping the current one", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// ReloadConfig re-reads the config file, see WithConfigReload. The current configuration is kept when the config
+// file is invalid or changes the log levels, which the logger is built with.
+func (s *Server) ReloadConfig() error {
+	if s.reload.path == "" {
+		return errors.New("there is no config file to reload, the environment is only read at startup")
+	}
+	c, err := config.Load(s.reload.path)
+	if err != nil {
+		return err
+	}
+	// checked like the file given at startup, without touching the configuration in effect
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", s.reload.path, err)
+	}
+	if c.LogLevel != s.reload.logLevel || c.LogLevels != s.reload.logLevels {
+		return fmt.Errorf("invalid config file %s: logLevel and logLevels only apply on restart", s.reload.path)
+	}
+	s.log.Info("reloading the configuration", zap.String("path", s.reload.path))
+	s.processor.SetConfig(c)
+	return nil
+}
+
+// stopReload stops watching for SIGHUP, it may be called more than once
+func (s *Server) stopReload() {
+	if s.reload.enabled {
+		s.reload.stopOnce.Do(func() { close(s.reload.stop) })
+	}
+}
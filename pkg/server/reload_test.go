@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// staticDecisionServer always answers with the decision
+func staticDecisionServer(t *testing.T, decision string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"decision":%q}`, decision)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// decide returns the decision the server at the port sets on a request without a preferred svc
+func decide(t *testing.T, port string) string {
+	conn, err := grpc.NewClient("127.0.0.1:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	stream, err := ext_proc_v3.NewExternalProcessorClient(conn).Process(context.Background(), grpc.WaitForReady(true))
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&ext_proc_v3.ProcessingRequest{
+		Request: &ext_proc_v3.ProcessingRequest_RequestHeaders{RequestHeaders: &ext_proc_v3.HttpHeaders{
+			Headers: &core_v3.HeaderMap{Headers: []*core_v3.HeaderValue{{Key: ":path", RawValue: []byte("/")}}},
+		}},
+	}))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	for _, h := range resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+		if h.GetHeader().GetKey() == config.RoutingDecisionHeader {
+			return string(h.GetHeader().GetRawValue())
+		}
+	}
+	return ""
+}
+
+func TestConfigReloadOnSIGHUP(t *testing.T) {
+	// keeps a SIGHUP sent before the server listens for it from terminating the test binary
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(server string) {
+		require.NoError(t, os.WriteFile(path, []byte("decisionServer:\n  url: "+server+"\n"), 0o600))
+	}
+	writeConfig(staticDecisionServer(t, "a"))
+	conf, err := config.Load(path)
+	require.NoError(t, err)
+
+	port := freePort(t)
+	serveInBackground(t, New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithConfig(conf), WithConfigReload(path)))
+	require.Equal(t, "a", decide(t, port))
+
+	writeConfig(staticDecisionServer(t, "b"))
+	require.Eventually(t, func() bool {
+		return syscall.Kill(os.Getpid(), syscall.SIGHUP) == nil && decide(t, port) == "b"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestConfigReloadKeepsConfigOnInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("decisionServer:\n  url: "+staticDecisionServer(t, "a")+"\n"), 0o600))
+	conf, err := config.Load(path)
+	require.NoError(t, err)
+
+	port := freePort(t)
+	s := New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithConfig(conf), WithConfigReload(path))
+	serveInBackground(t, s)
+
+	require.NoError(t, os.WriteFile(path, []byte("decisionServer:\n  url: ftp://decision\n"), 0o600))
+	require.ErrorContains(t, s.ReloadConfig(), "decisionServer.url")
+	require.Equal(t, "a", decide(t, port))
+
+	require.NoError(t, os.WriteFile(path, []byte("decisionServer:\n  url: "+staticDecisionServer(t, "b")+"\n  retries: -1\n"), 0o600))
+	require.ErrorContains(t, s.ReloadConfig(), "decisionServer.retries must not be negative")
+	require.Equal(t, "a", decide(t, port))
+}
+
+func TestConfigReloadWithoutConfigFile(t *testing.T) {
+	s := New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", freePort(t)), WithConfigReload(""))
+	require.ErrorContains(t, s.ReloadConfig(), "there is no config file to reload")
+}
+
+func TestConfigReloadRejectsLogLevels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("decisionServer:\n  url: "+staticDecisionServer(t, "a")+"\n"), 0o600))
+	conf, err := config.Load(path)
+	require.NoError(t, err)
+
+	port := freePort(t)
+	s := New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithConfig(conf), WithConfigReload(path))
+	serveInBackground(t, s)
+
+	require.NoError(t, os.WriteFile(path, []byte("logLevel: debug\ndecisionServer:\n  url: "+staticDecisionServer(t, "b")+"\n"), 0o600))
+	require.ErrorContains(t, s.ReloadConfig(), "logLevel and logLevels only apply on restart")
+	require.Equal(t, "a", decide(t, port))
+
+	require.NoError(t, os.WriteFile(path, []byte("logLevels:\n  processor: debug\n"), 0o600))
+	require.ErrorContains(t, s.ReloadConfig(), "logLevel and logLevels only apply on restart")
+}
@@ -2,17 +2,28 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	ext_proc_v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/soheilhy/cmux"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/logging"
+	"github.com/day0ops/ext-proc-routing-decision/pkg/metrics"
 	"github.com/day0ops/ext-proc-routing-decision/pkg/processor"
 	"github.com/day0ops/ext-proc-routing-decision/test/mock"
 )
@@ -21,8 +32,11 @@ const (
 	defaultGrpcNetwork          = "tcp"
 	defaultGrpcAddress          = ":8081"
 	defaultHTTPBindAddr         = ":8080"
+	defaultAdminBindAddr        = ":9090"
 	defaultMaxConcurrentStreams = 1000
 	defaultShutdownWait         = 5 * time.Second
+	// how long IsReady waits for the grpc listener
+	readyTimeout = time.Second
 )
 
 type Server struct {
@@ -30,8 +44,27 @@ type Server struct {
 	grpcNetwork string
 	grpcAddress string
 	mockBackend mockHttpBackend
-	ctx         context.Context
-	log         *zap.Logger
+	admin       adminServer
+	metrics     metricsServer
+	// serves the admin endpoints on the grpc listener, see WithMultiplexing
+	multiplexed bool
+	reflection  bool
+	// settings of the grpc server created by New, ignored for one given with WithGrpcServer
+	maxConcurrentStreams uint32
+	keepalive            []grpc.ServerOption
+	// OTLP collector spans are exported to, see WithTracing
+	tracingEndpoint string
+	tracerProvider  *sdktrace.TracerProvider
+	mux             cmux.CMux
+	processor       *processor.ProcessingServer
+	tls             tlsFiles
+	// fills in the settings not given with other options and configures the processor, see WithConfig
+	conf   *config.Config
+	reload configReload
+	// why the server can't be served, returned by Serve
+	err error
+	ctx context.Context
+	log *zap.Logger
 }
 
 type mockHttpBackend struct {
@@ -41,6 +74,13 @@ type mockHttpBackend struct {
 	httpsrv     *http.Server
 }
 
+// metricsServer serves only the metrics, without a token, see WithMetrics
+type metricsServer struct {
+	enabled     bool
+	bindAddress string
+	httpsrv     *http.Server
+}
+
 type HealthServer struct {
 	Log *zap.Logger
 }
@@ -50,12 +90,22 @@ type Option func(*Server)
 func New(ctx context.Context, log *zap.Logger, opts ...Option) *Server {
 	srv := &Server{
 		ctx: ctx,
-		log: log,
+		log: log.Named(logging.Server),
 	}
 
 	for _, opt := range opts {
 		opt(srv)
 	}
+	if srv.conf != nil {
+		srv.configDefaults()
+	}
+	if srv.reload.enabled {
+		running := srv.conf
+		if running == nil {
+			running = config.FromEnv()
+		}
+		srv.reload.logLevel, srv.reload.logLevels = running.LogLevel, running.LogLevels
+	}
 
 	if srv.grpcNetwork == "" {
 		srv.grpcNetwork = defaultGrpcNetwork
@@ -64,9 +114,65 @@ func New(ctx context.Context, log *zap.Logger, opts ...Option) *Server {
 		srv.grpcAddress = defaultGrpcAddress
 	}
 	if srv.grpcServer == nil {
-		sopts := []grpc.ServerOption{grpc.MaxConcurrentStreams(defaultMaxConcurrentStreams)}
+		if srv.maxConcurrentStreams == 0 {
+			srv.maxConcurrentStreams = defaultMaxConcurrentStreams
+		}
+		sopts := []grpc.ServerOption{grpc.MaxConcurrentStreams(srv.maxConcurrentStreams)}
+		sopts = append(sopts, srv.keepalive...)
+		if srv.tls.enabled() {
+			creds, err := srv.tls.serverOption()
+			if err != nil {
+				srv.err = err
+			} else {
+				sopts = append(sopts, creds)
+			}
+		}
 		srv.grpcServer = grpc.NewServer(sopts...)
 	}
+	if srv.tls.enabled() && srv.multiplexed {
+		srv.err = errors.New("the admin endpoints can't be multiplexed on a TLS grpc listener")
+	}
+
+	var popts []processor.Option
+	if srv.conf != nil {
+		popts = append(popts, processor.WithConfig(srv.conf))
+	}
+	if srv.tracingEndpoint != "" {
+		tp, err := newTracerProvider(ctx, srv.tracingEndpoint)
+		if err != nil {
+			srv.err = fmt.Errorf("cannot create the trace exporter: %w", err)
+		} else {
+			srv.tracerProvider = tp
+			popts = append(popts, processor.WithTracerProvider(tp))
+		}
+	}
+	srv.processor = processor.New(log.Named(logging.Processor), popts...)
+
+	if srv.admin.enabled {
+		if srv.admin.mux == nil {
+			srv.admin.mux = http.NewServeMux()
+		}
+		if srv.admin.bindAddress == "" {
+			srv.admin.bindAddress = defaultAdminBindAddr
+		}
+
+		srv.admin.mux.HandleFunc("/cache/dump", requireToken(srv.admin.token, cacheDumpHandler(srv.processor)))
+		srv.admin.mux.HandleFunc("/debug/info", requireToken(srv.admin.token, debugInfoHandler(srv.processor)))
+		srv.admin.mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+		srv.admin.httpsrv = &http.Server{
+			Addr:    srv.admin.bindAddress,
+			Handler: srv.admin.mux,
+		}
+	}
+
+	if srv.metrics.enabled {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+		srv.metrics.httpsrv = &http.Server{
+			Addr:    srv.metrics.bindAddress,
+			Handler: mux,
+		}
+	}
 
 	if srv.mockBackend.enabled {
 		if srv.mockBackend.mux == nil {
@@ -78,6 +184,7 @@ func New(ctx context.Context, log *zap.Logger, opts ...Option) *Server {
 
 		srv.mockBackend.mux.HandleFunc("/headers", mock.RequestHeaders)
 		srv.mockBackend.mux.HandleFunc("/response-headers", mock.ResponseHeaders)
+		srv.mockBackend.mux.HandleFunc("/decision", mock.Decision)
 		srv.mockBackend.httpsrv = &http.Server{
 			Addr: srv.mockBackend.bindAddress,
 		}
@@ -88,11 +195,31 @@ func New(ctx context.Context, log *zap.Logger, opts ...Option) *Server {
 }
 
 func (s *Server) Serve() error {
+	if s.err != nil {
+		return s.err
+	}
 	if s.ctx == nil {
 		s.ctx = context.TODO()
 	}
 
-	errCh := make(chan error, 1)
+	// one slot per server that can report, so the ones still running after the first error never block: the admin,
+	// metrics, mock and grpc servers, plus the admin server and the mux on the multiplexed listener
+	errCh := make(chan error, 6)
+	if s.reload.enabled {
+		s.watchReload()
+	}
+	if s.admin.enabled && !s.multiplexed {
+		go func() {
+			s.log.Info("starting admin http server", zap.String("address", s.admin.bindAddress))
+			errCh <- s.admin.httpsrv.ListenAndServe()
+		}()
+	}
+	if s.metrics.enabled {
+		go func() {
+			s.log.Info("starting metrics http server", zap.String("address", s.metrics.bindAddress))
+			errCh <- s.metrics.httpsrv.ListenAndServe()
+		}()
+	}
 	if s.mockBackend.enabled {
 		go func() {
 			s.log.Info("starting mock http server", zap.String("address", s.mockBackend.bindAddress))
@@ -109,9 +236,14 @@ func (s *Server) Serve() error {
 			errCh <- fmt.Errorf("cannot listen: %w", err)
 			return
 		}
-		extProcProcessor := processor.New(s.log)
-		ext_proc_v3.RegisterExternalProcessorServer(s.grpcServer, extProcProcessor)
-		grpc_health_v1.RegisterHealthServer(s.grpcServer, &processor.HealthServer{Log: s.log})
+		ext_proc_v3.RegisterExternalProcessorServer(s.grpcServer, s.processor)
+		grpc_health_v1.RegisterHealthServer(s.grpcServer, &processor.HealthServer{Log: s.log, Processor: s.processor})
+		if s.reflection {
+			reflection.Register(s.grpcServer)
+		}
+		if s.multiplexed && s.admin.enabled {
+			listener = s.serveMultiplexed(listener, errCh)
+		}
 		s.log.Info("starting ext proc grpc server", zap.String("address", s.grpcAddress))
 		errCh <- s.grpcServer.Serve(listener)
 	}()
@@ -132,6 +264,16 @@ func (s *Server) Stop() error {
 		s.log.Info("stopping grpc server")
 		s.grpcServer.GracefulStop()
 	}
+	s.stopReload()
+	if err := s.processor.Close(); err != nil {
+		s.log.Warn("failed to close the processor", zap.Error(err))
+	}
+	if s.tracerProvider != nil {
+		// flushes the spans still batched
+		if err := s.tracerProvider.Shutdown(ctx); err != nil {
+			s.log.Warn("failed to shut down the tracer provider", zap.Error(err))
+		}
+	}
 	if s.grpcNetwork == "unix" {
 		os.RemoveAll(s.grpcAddress) // nolint:errcheck
 	}
@@ -141,11 +283,53 @@ func (s *Server) Stop() error {
 			return fmt.Errorf("http server shutdown error: %w", err)
 		}
 	}
+	if s.metrics.httpsrv != nil {
+		s.log.Info("stopping metrics http server")
+		if err := s.metrics.httpsrv.Shutdown(ctx); err != nil {
+			return fmt.Errorf("metrics http server shutdown error: %w", err)
+		}
+	}
+	if s.admin.httpsrv != nil {
+		s.log.Info("stopping admin http server")
+		if err := s.admin.httpsrv.Shutdown(ctx); err != nil {
+			return fmt.Errorf("admin http server shutdown error: %w", err)
+		}
+	}
+	if s.mux != nil {
+		s.log.Info("stopping multiplexed listener")
+		s.mux.Close()
+	}
 	time.Sleep(defaultShutdownWait)
 	return nil
 }
 
+// serveMultiplexed splits the listener by protocol. The admin endpoints are served on the HTTP/1 connections in the
+// background and the returned listener only accepts the gRPC connections.
+func (s *Server) serveMultiplexed(listener net.Listener, errCh chan<- error) net.Listener {
+	s.mux = cmux.New(listener)
+	grpcListener := s.mux.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+	httpListener := s.mux.Match(cmux.Any())
+
+	go func() {
+		s.log.Info("starting admin http server on the grpc listener", zap.String("address", s.grpcAddress))
+		if err := s.admin.httpsrv.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, cmux.ErrListenerClosed) {
+			errCh <- err
+		}
+	}()
+	go func() {
+		if err := s.mux.Serve(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errCh <- err
+		}
+	}()
+	return grpcListener
+}
+
+// IsReady reports whether the grpc listener accepts connections and, for a plaintext listener, whether the health
+// service reports serving, along with the mock backend when it is enabled
 func IsReady(s *Server) bool {
+	if !grpcReady(s) {
+		return false
+	}
 	if s.mockBackend.enabled {
 		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/headers", s.mockBackend.bindAddress), nil)
 		if err != nil {
@@ -165,6 +349,45 @@ func IsReady(s *Server) bool {
 	return true
 }
 
+// grpcReady dials the grpc listener, tcp or unix, and calls the health Check RPC unless the listener is served over
+// TLS, whose client credentials aren't known here
+func grpcReady(s *Server) bool {
+	conn, err := net.DialTimeout(s.grpcNetwork, dialAddress(s.grpcNetwork, s.grpcAddress), readyTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	if s.tls.enabled() {
+		return true
+	}
+
+	target := dialAddress(s.grpcNetwork, s.grpcAddress)
+	if s.grpcNetwork == "unix" {
+		target = "unix://" + target
+	}
+	client, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+	resp, err := grpc_health_v1.NewHealthClient(client).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	return err == nil && resp.GetStatus() == grpc_health_v1.HealthCheckResponse_SERVING
+}
+
+// dialAddress is the address a client reaches the listener on, a listener on all interfaces is reached on localhost
+func dialAddress(network, address string) string {
+	if network == "unix" {
+		return address
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil && host == "" {
+		return net.JoinHostPort("localhost", port)
+	}
+	return address
+}
+
+// WaitReady polls IsReady until the server is ready or the timeout passes
 func WaitReady(s *Server, timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -182,16 +405,136 @@ func WaitReady(s *Server, timeout time.Duration) error {
 	}
 }
 
+// WithGrpcServer serves the ext_proc and health services on the address, e.g. 127.0.0.1:8081. A bare port, e.g. 8081,
+// listens on all interfaces. For the unix network the address is the socket path. The grpc server is created by New
+// when nil.
 func WithGrpcServer(server *grpc.Server, network string, address string) Option {
 	return func(s *Server) {
 		s.grpcServer = server
 		s.grpcNetwork = network
-		s.grpcAddress = fmt.Sprintf(":%s", address)
+		s.grpcAddress = listenAddress(network, address)
 	}
 }
 
+// listenAddress turns a bare port into an address listening on all interfaces, any other address and socket paths are
+// used as is
+func listenAddress(network, address string) string {
+	if network == "unix" {
+		return address
+	}
+	if _, err := strconv.Atoi(address); err == nil {
+		return ":" + address
+	}
+	return address
+}
+
 func WithMockBackend() Option {
 	return func(s *Server) {
 		s.mockBackend.enabled = true
 	}
 }
+
+// WithAdminServer serves the admin endpoints on the given address. Every endpoint but /metrics requires the token as
+// a bearer token.
+func WithAdminServer(address string, token string) Option {
+	return func(s *Server) {
+		s.admin.enabled = true
+		s.admin.bindAddress = address
+		s.admin.token = token
+	}
+}
+
+// WithTLS serves the grpc listener over TLS with the PEM certificate and key, failing Serve when either can't be
+// loaded. It has no effect on a grpc server given with WithGrpcServer.
+func WithTLS(certFile, keyFile string) Option {
+	return func(s *Server) {
+		s.tls.certFile = certFile
+		s.tls.keyFile = keyFile
+	}
+}
+
+// WithMTLS is WithTLS that also requires clients to present a certificate signed by one of the PEM CAs in caFile.
+// Connections without a trusted certificate are refused during the handshake.
+func WithMTLS(certFile, keyFile, caFile string) Option {
+	return func(s *Server) {
+		s.tls = tlsFiles{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	}
+}
+
+// WithMaxConcurrentStreams limits the streams each connection may have open at once, 1000 by default. It has no effect
+// on a grpc server given with WithGrpcServer.
+func WithMaxConcurrentStreams(n uint32) Option {
+	return func(s *Server) {
+		s.maxConcurrentStreams = n
+	}
+}
+
+// WithKeepalive sets how the server pings idle connections and how often clients may ping it, so that long-lived
+// Envoy connections aren't silently dropped by intermediaries. It has no effect on a grpc server given with
+// WithGrpcServer.
+func WithKeepalive(params keepalive.ServerParameters, policy keepalive.EnforcementPolicy) Option {
+	return func(s *Server) {
+		s.keepalive = []grpc.ServerOption{grpc.KeepaliveParams(params), grpc.KeepaliveEnforcementPolicy(policy)}
+	}
+}
+
+// WithReflection registers the gRPC reflection service so tools such as grpcurl can call the server without its proto
+// files. It exposes every service the server offers, so it is off unless asked for.
+func WithReflection() Option {
+	return func(s *Server) {
+		s.reflection = true
+	}
+}
+
+// WithMetrics serves the Prometheus metrics on /metrics at the address. Unlike the admin endpoints it needs no token,
+// so that the metrics can be scraped without exposing the admin endpoints.
+func WithMetrics(address string) Option {
+	return func(s *Server) {
+		s.metrics.enabled = true
+		s.metrics.bindAddress = address
+	}
+}
+
+// WithTracing exports the spans of streams and decision server calls to the OTLP gRPC collector at the endpoint, e.g.
+// otel-collector:4317. The exporter is otherwise configured by the standard OTEL_EXPORTER_OTLP_* environment variables.
+func WithTracing(endpoint string) Option {
+	return func(s *Server) {
+		s.tracingEndpoint = endpoint
+	}
+}
+
+// WithConfig configures the server and its processor. Settings given with other options, such as WithTLS, take
+// precedence over the config.
+func WithConfig(c *config.Config) Option {
+	return func(s *Server) {
+		s.conf = c
+	}
+}
+
+// configDefaults fills in the settings of the grpc server and tracing which weren't given with other options
+func (s *Server) configDefaults() {
+	grpcConf := s.conf.Grpc
+	if s.maxConcurrentStreams == 0 {
+		s.maxConcurrentStreams = uint32(grpcConf.MaxConcurrentStreams)
+	}
+	if s.keepalive == nil && grpcConf.KeepaliveTime > 0 {
+		WithKeepalive(
+			keepalive.ServerParameters{Time: grpcConf.KeepaliveTime, Timeout: grpcConf.KeepaliveTimeout},
+			keepalive.EnforcementPolicy{MinTime: grpcConf.KeepaliveMinTime, PermitWithoutStream: true},
+		)(s)
+	}
+	if !s.tls.enabled() && grpcConf.TLS.CertFile != "" {
+		s.tls = tlsFiles{certFile: grpcConf.TLS.CertFile, keyFile: grpcConf.TLS.KeyFile, caFile: grpcConf.TLS.CAFile}
+	}
+	if s.tracingEndpoint == "" {
+		s.tracingEndpoint = s.conf.TracingEndpoint
+	}
+}
+
+// WithMultiplexing serves the admin endpoints on the grpc port instead of their own address, telling them apart by
+// protocol, so that a single port needs exposing. It has no effect unless the admin server is enabled.
+func WithMultiplexing() Option {
+	return func(s *Server) {
+		s.multiplexed = true
+	}
+}
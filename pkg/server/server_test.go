@@ -0,0 +1,277 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+	"github.com/day0ops/ext-proc-routing-decision/test/mock"
+)
+
+// freePort returns a port nothing is listening on
+func freePort(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	return strconv.Itoa(lis.Addr().(*net.TCPAddr).Port)
+}
+
+// serveInBackground serves s in the background, stopping it when the test ends
+func serveInBackground(t *testing.T, s *Server) {
+	go s.Serve() // nolint:errcheck
+	t.Cleanup(func() {
+		s.grpcServer.Stop()
+		s.stopReload()
+		s.processor.Close() // nolint:errcheck
+		if s.metrics.httpsrv != nil {
+			s.metrics.httpsrv.Close()
+		}
+		if s.mockBackend.httpsrv != nil {
+			s.mockBackend.httpsrv.Close()
+		}
+	})
+}
+
+func TestMultiplexedGrpcAndAdmin(t *testing.T) {
+	port := freePort(t)
+	s := New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithAdminServer("", "secret"), WithMultiplexing())
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve() }()
+
+	conn, err := grpc.NewClient("127.0.0.1:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Eventually(t, func() bool {
+		resp, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		return err == nil && resp.GetStatus() == grpc_health_v1.HealthCheckResponse_SERVING
+	}, 5*time.Second, 50*time.Millisecond)
+
+	resp, err := http.Get("http://127.0.0.1:" + port + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, string(body), "ext_proc_routing_decision_")
+
+	resp, err = http.Get("http://127.0.0.1:" + port + "/debug/info")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode, "admin endpoints still require the token")
+
+	require.NoError(t, s.Stop())
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve didn't return after stopping")
+	}
+}
+
+func TestReflection(t *testing.T) {
+	port := freePort(t)
+	serveInBackground(t, New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithReflection()))
+
+	conn, err := grpc.NewClient("127.0.0.1:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := grpc_reflection_v1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx, grpc.WaitForReady(true))
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_ListServices{},
+	}))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+
+	var services []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		services = append(services, svc.GetName())
+	}
+	require.Contains(t, services, "envoy.service.ext_proc.v3.ExternalProcessor")
+	require.Contains(t, services, "grpc.health.v1.Health")
+}
+
+func TestMaxConcurrentStreams(t *testing.T) {
+	port := freePort(t)
+	serveInBackground(t, New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithMaxConcurrentStreams(1)))
+
+	conn, err := grpc.NewClient("127.0.0.1:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	health := grpc_health_v1.NewHealthClient(conn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watch, err := health.Watch(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+	require.NoError(t, err)
+	_, err = watch.Recv()
+	require.NoError(t, err)
+
+	checkCtx, checkCancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer checkCancel()
+	_, err = health.Check(checkCtx, &grpc_health_v1.HealthCheckRequest{})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err), "a second stream waits while the first is open")
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, err := health.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestKeepalive(t *testing.T) {
+	port := freePort(t)
+	params := keepalive.ServerParameters{MaxConnectionAge: 100 * time.Millisecond, MaxConnectionAgeGrace: 100 * time.Millisecond}
+	serveInBackground(t, New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithKeepalive(params, keepalive.EnforcementPolicy{})))
+
+	conn, err := grpc.NewClient("127.0.0.1:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	watch, err := grpc_health_v1.NewHealthClient(conn).Watch(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+	require.NoError(t, err)
+	_, err = watch.Recv()
+	require.NoError(t, err)
+
+	// the stream outlives the connection age and grace so the server closes it
+	_, err = watch.Recv()
+	require.Error(t, err)
+	require.NotEqual(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestMetricsServer(t *testing.T) {
+	metricsPort := freePort(t)
+	s := New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", freePort(t)), WithMetrics("127.0.0.1:"+metricsPort))
+	serveInBackground(t, s)
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		var err error
+		resp, err = http.Get("http://127.0.0.1:" + metricsPort + "/metrics")
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, string(body), "ext_proc_routing_decision_")
+}
+
+func TestListenAddress(t *testing.T) {
+	for _, tt := range []struct {
+		network, address, want string
+	}{
+		{"tcp", "8081", ":8081"},
+		{"tcp", ":8081", ":8081"},
+		{"tcp", "127.0.0.1:8081", "127.0.0.1:8081"},
+		{"tcp", "[::1]:8081", "[::1]:8081"},
+		{"tcp", "localhost:8081", "localhost:8081"},
+		{"unix", "/var/run/ext-proc.sock", "/var/run/ext-proc.sock"},
+		{"unix", "8081", "8081"},
+	} {
+		require.Equal(t, tt.want, listenAddress(tt.network, tt.address), "%s %s", tt.network, tt.address)
+	}
+}
+
+func TestGrpcServerOnUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ext-proc.sock")
+	serveInBackground(t, New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "unix", path)))
+
+	conn, err := grpc.NewClient("unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+	require.NoError(t, err)
+}
+
+func TestGrpcServerAddress(t *testing.T) {
+	port := freePort(t)
+	s := New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port))
+	require.Equal(t, ":"+port, s.grpcAddress, "a bare port listens on all interfaces")
+
+	s = New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", "127.0.0.1:"+port))
+	require.Equal(t, "127.0.0.1:"+port, s.grpcAddress)
+	serveInBackground(t, s)
+
+	conn, err := grpc.NewClient("127.0.0.1:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+	require.NoError(t, err)
+}
+
+func TestReadyOnceListening(t *testing.T) {
+	for name, listen := range map[string]func(t *testing.T) (string, string){
+		"tcp":  func(t *testing.T) (string, string) { return "tcp", "127.0.0.1:" + freePort(t) },
+		"unix": func(t *testing.T) (string, string) { return "unix", filepath.Join(t.TempDir(), "ext-proc.sock") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			network, address := listen(t)
+			s := New(context.Background(), zap.NewNop(), WithGrpcServer(nil, network, address))
+			require.False(t, IsReady(s), "nothing listens before Serve")
+
+			serveInBackground(t, s)
+			require.NoError(t, WaitReady(s, 5*time.Second))
+			require.True(t, IsReady(s))
+		})
+	}
+}
+
+func TestNotReadyWhenListenerIsntGrpc(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	s := New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", lis.Addr().String()))
+	require.False(t, IsReady(s), "accepting connections isn't enough without the health service answering")
+}
+
+func TestMockDecisionServer(t *testing.T) {
+	mock.SetDecision("default-svc")
+	t.Cleanup(func() { mock.SetDecision("") })
+
+	for path, decision := range map[string]string{
+		"/decision":                    "default-svc",
+		"/decision?decision=other-svc": "other-svc",
+	} {
+		t.Run(path, func(t *testing.T) {
+			mockAddress := "127.0.0.1:" + freePort(t)
+			conf := config.FromEnv()
+			conf.DecisionServer.URL = "http://" + mockAddress + path
+
+			port := freePort(t)
+			serveInBackground(t, New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithConfig(conf),
+				WithMockBackend(), func(s *Server) { s.mockBackend.bindAddress = mockAddress }))
+			require.Eventually(t, func() bool { return decide(t, port) == decision }, 5*time.Second, 50*time.Millisecond)
+		})
+	}
+}
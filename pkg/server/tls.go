@@ -0,0 +1,60 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// tlsFiles are the PEM files the grpc listener is served with, plaintext when empty
+type tlsFiles struct {
+	certFile string
+	keyFile  string
+	// CAs client certificates must be signed by, client certificates aren't asked for when empty
+	caFile string
+}
+
+func (f tlsFiles) enabled() bool {
+	return f.certFile != "" || f.keyFile != ""
+}
+
+// serverOption loads the certificate and CAs, failing when a file is missing so a misconfigured server doesn't start
+func (f tlsFiles) serverOption() (grpc.ServerOption, error) {
+	files := []struct{ name, path string }{{"certificate", f.certFile}, {"key", f.keyFile}}
+	if f.caFile != "" {
+		files = append(files, struct{ name, path string }{"CA", f.caFile})
+	}
+	for _, file := range files {
+		if file.path == "" {
+			return nil, fmt.Errorf("grpc TLS %s file is not set", file.name)
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			return nil, fmt.Errorf("grpc TLS %s file: %w", file.name, err)
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the grpc TLS certificate: %w", err)
+	}
+	c := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if f.caFile != "" {
+		pem, err := os.ReadFile(f.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("grpc TLS CA file: %w", err)
+		}
+		c.ClientCAs = x509.NewCertPool()
+		if !c.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in the grpc TLS CA file")
+		}
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return grpc.Creds(credentials.NewTLS(c)), nil
+}
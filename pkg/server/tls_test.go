@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
+)
+
+// testCert is a certificate for 127.0.0.1 along with the PEM files it was written to
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert writes a certificate signed by parent, or a self-signed one when parent is nil
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(t.TempDir(), name+".crt"),
+		keyFile:  filepath.Join(t.TempDir(), name+".key"),
+	}
+	require.NoError(t, os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return c
+}
+
+// checkHealth runs a health check over TLS with the client config on a new connection
+func checkHealth(t *testing.T, port string, c *tls.Config) error {
+	conn, err := grpc.NewClient("127.0.0.1:"+port, grpc.WithTransportCredentials(credentials.NewTLS(c)))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	return err
+}
+
+// requireHealthy waits for a health check with the client config to succeed while the server starts
+func requireHealthy(t *testing.T, port string, c *tls.Config) {
+	require.Eventually(t, func() bool { return checkHealth(t, port, c) == nil }, 5*time.Second, 50*time.Millisecond)
+}
+
+// trusting is a client config trusting the certificate
+func trusting(cert *testCert) *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.cert)
+	return &tls.Config{RootCAs: roots}
+}
+
+func TestTLS(t *testing.T) {
+	cert := newTestCert(t, "server", nil)
+	port := freePort(t)
+	serveInBackground(t, New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithTLS(cert.certFile, cert.keyFile)))
+
+	requireHealthy(t, port, trusting(cert))
+}
+
+func TestTLSMissingFiles(t *testing.T) {
+	cert := newTestCert(t, "server", nil)
+	missing := filepath.Join(t.TempDir(), "missing.key")
+
+	s := New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", freePort(t)), WithTLS(cert.certFile, missing))
+	err := s.Serve()
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.ErrorContains(t, err, "grpc TLS key file")
+}
+
+func TestTLSFromConfig(t *testing.T) {
+	cert := newTestCert(t, "server", nil)
+	conf := config.FromEnv()
+	conf.Grpc.TLS = config.TLSConfig{CertFile: cert.certFile, KeyFile: cert.keyFile}
+	port := freePort(t)
+	serveInBackground(t, New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithConfig(conf)))
+
+	requireHealthy(t, port, trusting(cert))
+}
+
+// withClientCert adds the certificate to the client config
+func withClientCert(t *testing.T, c *tls.Config, cert *testCert) *tls.Config {
+	pair, err := tls.LoadX509KeyPair(cert.certFile, cert.keyFile)
+	require.NoError(t, err)
+	c.Certificates = []tls.Certificate{pair}
+	return c
+}
+
+func TestMTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	cert := newTestCert(t, "server", ca)
+	port := freePort(t)
+	serveInBackground(t, New(context.Background(), zap.NewNop(), WithGrpcServer(nil, "tcp", port), WithMTLS(cert.certFile, cert.keyFile, ca.certFile)))
+
+	requireHealthy(t, port, withClientCert(t, trusting(ca), newTestCert(t, "envoy", ca)))
+
+	require.Error(t, checkHealth(t, port, trusting(ca)), "a client without a certificate is refused")
+	untrusted := newTestCert(t, "envoy", newTestCert(t, "other-ca", nil))
+	require.Error(t, checkHealth(t, port, withClientCert(t, trusting(ca), untrusted)), "a client with an untrusted certificate is refused")
+}
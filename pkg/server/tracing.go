@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/day0ops/ext-proc-routing-decision/pkg/version"
+)
+
+// newTracerProvider batches spans to the OTLP gRPC collector at the endpoint. Everything else about the exporter,
+// e.g. TLS or headers, comes from the standard OTEL_EXPORTER_OTLP_* environment variables.
+func newTracerProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	res := resource.NewSchemaless(
+		semconv.ServiceName(version.Name),
+		semconv.ServiceVersion(version.Version),
+	)
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+}
@@ -0,0 +1,81 @@
+package test_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	extproctest "github.com/day0ops/ext-proc-routing-decision/test"
+	"github.com/day0ops/ext-proc-routing-decision/test/mock"
+)
+
+func TestExpectStatus(t *testing.T) {
+	actual := extproctest.Actual{Status: http.StatusServiceUnavailable}
+
+	require.NoError(t, extproctest.Expect{Status: http.StatusServiceUnavailable}.Assert(t, actual))
+	require.NoError(t, extproctest.Expect{}.Assert(t, actual), "a zero status accepts any")
+	require.EqualError(t, extproctest.Expect{Status: http.StatusOK}.Assert(t, actual), "status mismatch: expected 200 and got 503")
+}
+
+func TestCaseStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	extproctest.Case{
+		Name:   "status of the response",
+		Expect: extproctest.Expect{Status: http.StatusServiceUnavailable},
+	}.Run(t, extproctest.WithURL(srv.URL))
+}
+
+func TestExpectBody(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		expect string
+		body   string
+		err    string
+	}{
+		{"exact", `exact: '{"decision":"a"}'`, `{"decision":"a"}`, ""},
+		{"exact mismatch", `exact: '{"decision":"a"}'`, `{"decision":"b"}`, `body match fail: body should match with "exact"="{\"decision\":\"a\"}" and is "{\"decision\":\"b\"}"`},
+		{"exact empty", `exact: ""`, "", ""},
+		{"exact empty mismatch", `exact: ""`, "{}", `body match fail: body should match with "exact"="" and is "{}"`},
+		{"contains", `contains: '"decision"'`, `{"decision":"a"}`, ""},
+		{"contains mismatch", `contains: '"decision"'`, "", `body match fail: body should match with "contains"="\"decision\"" and is ""`},
+		{"contains empty", `contains: ""`, "", ""},
+		{"regex", `regex: '"decision":\s*"a"'`, `{"decision": "a"}`, ""},
+		{"regex mismatch", `regex: '"decision":\s*"a"'`, `{"decision": "b"}`, `body match fail: body should match with "regex"="\"decision\":\\s*\"a\"" and is "{\"decision\": \"b\"}"`},
+		{"regex empty", `regex: '^$'`, "", ""},
+		{"no match type", `{}`, "", "body match sets no match type"},
+		{"invalid regex", `regex: '('`, "", "string match regex \"(\" is invalid: error parsing regexp: missing closing ): `(`"},
+		{"absent", `absent: true`, "", ""},
+		{"several match types", "exact: a\ncontains: a", "a", "string match sets several match types [exact contains], only one is allowed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var body extproctest.StringMatch
+			require.NoError(t, yaml.Unmarshal([]byte(tc.expect), &body))
+
+			err := extproctest.Expect{Body: &body}.Assert(t, extproctest.Actual{Body: tc.body})
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestCaseBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(mock.Decision))
+	defer srv.Close()
+
+	contains := `"decision": "a"`
+	extproctest.Case{
+		Name:   "body of the response",
+		Input:  extproctest.Input{Headers: extproctest.Headers{{Key: "path", Value: "/decision?decision=a"}}},
+		Expect: extproctest.Expect{Body: &extproctest.StringMatch{Contains: &contains}},
+	}.Run(t, extproctest.WithURL(srv.URL))
+}
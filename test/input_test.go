@@ -0,0 +1,50 @@
+package test_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	extproctest "github.com/day0ops/ext-proc-routing-decision/test"
+)
+
+// echoRequest answers with the method and the body of the request
+func echoRequest(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(append([]byte(r.Method+" "), body...)) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestInputBody(t *testing.T) {
+	testcases := extproctest.LoadTemplate(t, "testdata/request_body.yaml", struct{ Service string }{Service: "foo"})
+	require.Len(t, testcases, 1)
+	require.Equal(t, http.MethodPost, testcases[0].Input.Method)
+	require.JSONEq(t, `{"preferred-svc": "foo"}`, testcases[0].Input.Body, "the body should be templated")
+	testcases.Run(t, extproctest.WithURL(echoRequest(t).URL))
+}
+
+func TestInputMethodHeader(t *testing.T) {
+	exact := "PUT "
+	extproctest.Case{
+		Name:   "method header",
+		Input:  extproctest.Input{Headers: extproctest.Headers{{Key: "method", Value: http.MethodPut}}},
+		Expect: extproctest.Expect{Body: &extproctest.StringMatch{Exact: &exact}},
+	}.Run(t, extproctest.WithURL(echoRequest(t).URL))
+
+	exact = "PATCH "
+	extproctest.Case{
+		Name:   "method over the method header",
+		Input:  extproctest.Input{Method: http.MethodPatch, Headers: extproctest.Headers{{Key: "method", Value: http.MethodPut}}},
+		Expect: extproctest.Expect{Body: &extproctest.StringMatch{Exact: &exact}},
+	}.Run(t, extproctest.WithURL(echoRequest(t).URL))
+}
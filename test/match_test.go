@@ -0,0 +1,81 @@
+package test_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	extproctest "github.com/day0ops/ext-proc-routing-decision/test"
+)
+
+func TestHeaderMatch(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		match extproctest.HeaderMatch
+		value string
+		want  bool
+	}{
+		{"prefix", extproctest.HeaderMatch{Prefix: "svc-"}, "svc-a", true},
+		{"prefix mismatch", extproctest.HeaderMatch{Prefix: "svc-"}, "a-svc-", false},
+		{"prefix of the whole value", extproctest.HeaderMatch{Prefix: "svc-a"}, "svc-a", true},
+		{"prefix of an empty value", extproctest.HeaderMatch{Prefix: "svc-"}, "", false},
+		{"suffix", extproctest.HeaderMatch{Suffix: ".local"}, "svc.local", true},
+		{"suffix mismatch", extproctest.HeaderMatch{Suffix: ".local"}, "svc.local.", false},
+		{"suffix of an empty value", extproctest.HeaderMatch{Suffix: ".local"}, "", false},
+		{"contains", extproctest.HeaderMatch{Contains: "canary"}, "svc-canary-1", true},
+		{"contains mismatch", extproctest.HeaderMatch{Contains: "canary"}, "svc-stable", false},
+		{"contains in an empty value", extproctest.HeaderMatch{Contains: "canary"}, "", false},
+		{"no match type", extproctest.HeaderMatch{Prefix: "", Suffix: "", Contains: ""}, "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.match.Name = "x-test"
+			headers := http.Header{}
+			if tc.value != "" {
+				headers.Set("x-test", tc.value)
+			}
+			require.Equal(t, tc.want, tc.match.Assert(t, headers))
+		})
+	}
+}
+
+func TestHeaderMatchSingleType(t *testing.T) {
+	m := extproctest.HeaderMatch{Name: "x-test", Contains: "b", Prefix: "a"}
+	require.ErrorContains(t, m.Validate(), "[prefix contains]")
+	require.Equal(t, "prefix", m.MatchType(), "prefix has precedence over contains")
+	require.Equal(t, "a", m.MatchValue())
+
+	err := extproctest.Expect{ResponseHeaders: []extproctest.HeaderMatch{m}}.Assert(t, extproctest.Actual{})
+	require.ErrorContains(t, err, `header "x-test" sets several match types`)
+
+	require.NoError(t, (&extproctest.HeaderMatch{Name: "x-test", Suffix: "a"}).Validate())
+}
+
+func TestStringMatch(t *testing.T) {
+	empty, svc := "", "svc-"
+	for _, tc := range []struct {
+		name  string
+		match extproctest.StringMatch
+		value string
+		want  bool
+	}{
+		{"prefix", extproctest.StringMatch{Prefix: &svc}, "svc-a", true},
+		{"prefix mismatch", extproctest.StringMatch{Prefix: &svc}, "a", false},
+		{"empty prefix", extproctest.StringMatch{Prefix: &empty}, "", true},
+		{"suffix", extproctest.StringMatch{Suffix: &svc}, "a-svc-", true},
+		{"suffix mismatch", extproctest.StringMatch{Suffix: &svc}, "svc-a", false},
+		{"empty suffix", extproctest.StringMatch{Suffix: &empty}, "a", true},
+		{"contains", extproctest.StringMatch{Contains: &svc}, "a-svc-b", true},
+		{"contains mismatch", extproctest.StringMatch{Contains: &svc}, "", false},
+		{"empty contains", extproctest.StringMatch{Contains: &empty}, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.match.Validate())
+			require.Equal(t, tc.want, tc.match.Assert(t, tc.value))
+		})
+	}
+
+	m := extproctest.StringMatch{Suffix: &svc, Contains: &empty}
+	require.ErrorContains(t, m.Validate(), "[suffix contains]")
+	require.Equal(t, "suffix", m.MatchType())
+}
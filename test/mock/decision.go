@@ -0,0 +1,35 @@
+package mock
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// decisionParam is the query parameter overriding the decision returned by Decision
+const decisionParam = "decision"
+
+var decision atomic.Value
+
+// DecisionResponse is the payload of a decision server
+type DecisionResponse struct {
+	Decision string `json:"decision"`
+}
+
+// SetDecision sets the decision Decision returns when the request doesn't ask for one
+func SetDecision(d string) {
+	decision.Store(d)
+}
+
+// Decision answers as a decision server would, with the decision of the decision query parameter or else the one set
+// with SetDecision.
+func Decision(w http.ResponseWriter, request *http.Request) {
+	if !delay(w, request) || fail(w, request) {
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	d := request.URL.Query().Get(decisionParam)
+	if d == "" {
+		d, _ = decision.Load().(string)
+	}
+	respond(w, http.StatusOK, DecisionResponse{Decision: d})
+}
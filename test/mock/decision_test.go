@@ -0,0 +1,33 @@
+package mock_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/day0ops/ext-proc-routing-decision/test/mock"
+)
+
+func TestDecision(t *testing.T) {
+	mock.SetDecision("default-svc")
+	t.Cleanup(func() { mock.SetDecision("") })
+
+	for _, tc := range []struct {
+		url      string
+		decision string
+	}{
+		{"http://example.com/decision", "default-svc"},
+		{"http://example.com/decision?decision=other-svc", "other-svc"},
+	} {
+		rr := httptest.NewRecorder()
+		mock.Decision(rr, httptest.NewRequest(http.MethodPost, tc.url, nil))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp mock.DecisionResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.Equal(t, tc.decision, resp.Decision, tc.url)
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 )
 
+// delayParam is the query parameter, e.g. delay=250ms, the handlers wait for before responding
+const delayParam = "delay"
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -16,6 +20,9 @@ type RequestHeaderResponse struct {
 
 // RequestHeaders writes the request headers in the payload
 func RequestHeaders(w http.ResponseWriter, request *http.Request) {
+	if !delay(w, request) || fail(w, request) {
+		return
+	}
 	w.Header().Set("content-type", "application/json")
 	resp := RequestHeaderResponse{
 		Headers: make(map[string]string),
@@ -34,6 +41,9 @@ type ResponseHeaderResponse map[string]string
 
 // ResponseHeaders writes response headers from query parameters.
 func ResponseHeaders(w http.ResponseWriter, request *http.Request) {
+	if !delay(w, request) || fail(w, request) {
+		return
+	}
 	w.Header().Set("content-type", "application/json")
 	resp := make(ResponseHeaderResponse)
 	for k, v := range request.URL.Query() {
@@ -56,6 +66,29 @@ func ResponseHeaders(w http.ResponseWriter, request *http.Request) {
 	respond(w, http.StatusOK, resp)
 }
 
+// delay waits for the duration of the delay query parameter, if any. It returns false when the handler shouldn't
+// respond, because the delay is invalid and an error was written or because the client went away in the meantime.
+func delay(w http.ResponseWriter, request *http.Request) bool {
+	v := request.URL.Query().Get(delayParam)
+	if v == "" {
+		return true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		w.Header().Set("content-type", "application/json")
+		respond(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-request.Context().Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
 func respond(w http.ResponseWriter, statusCode int, v any) {
 	raw, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
@@ -1,10 +1,12 @@
 package mock_test
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -59,3 +61,41 @@ func TestResponseHeadersInvalidStatus(t *testing.T) {
 	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp), "failed to decode response body")
 	require.NotEmpty(t, resp.Error, "error message should not be empty")
 }
+
+func TestDelay(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"request headers":  mock.RequestHeaders,
+		"response headers": mock.ResponseHeaders,
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com?delay=100ms", nil)
+			rr := httptest.NewRecorder()
+
+			start := time.Now()
+			handler(rr, req)
+			require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+			require.Less(t, time.Since(start), time.Second)
+			require.Equal(t, http.StatusOK, rr.Code)
+		})
+	}
+}
+
+func TestDelayCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "http://example.com?delay=1m", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	mock.RequestHeaders(rr, req)
+	require.Less(t, time.Since(start), time.Second, "the handler should return once the client went away")
+	require.Empty(t, rr.Body.String())
+}
+
+func TestDelayInvalid(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com?delay=soon", nil)
+	rr := httptest.NewRecorder()
+
+	mock.ResponseHeaders(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,68 @@
+package mock
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// failRateParam is the query parameter, e.g. fail_rate=0.3, with the fraction of requests the handlers fail
+	failRateParam = "fail_rate"
+	// failStatusParam is the query parameter, e.g. fail_status=503, with the status of the failed requests. It isn't
+	// status, which /response-headers responds with.
+	failStatusParam = "fail_status"
+)
+
+// faults draws the requests to fail, see Seed
+var faults = struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}{rng: newRand(uint64(time.Now().UnixNano()))}
+
+// Seed makes the requests failed by the fail_rate query parameter reproducible
+func Seed(seed uint64) {
+	faults.mu.Lock()
+	defer faults.mu.Unlock()
+	faults.rng = newRand(seed)
+}
+
+func newRand(seed uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, seed>>32|seed<<32))
+}
+
+// fail fails the fraction of requests of the fail_rate query parameter with the status of the fail_status query
+// parameter, 500 by default. It returns true when it wrote the response, the handler shouldn't respond then.
+func fail(w http.ResponseWriter, request *http.Request) bool {
+	query := request.URL.Query()
+	v := query.Get(failRateParam)
+	if v == "" {
+		return false
+	}
+	rate, err := strconv.ParseFloat(v, 64)
+	if err == nil && (rate < 0 || rate > 1) {
+		err = fmt.Errorf("%s %v is not between 0 and 1", failRateParam, rate)
+	}
+	statusCode := http.StatusInternalServerError
+	if s := query.Get(failStatusParam); s != "" && err == nil {
+		statusCode, err = strconv.Atoi(s)
+	}
+	if err != nil {
+		w.Header().Set("content-type", "application/json")
+		respond(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return true
+	}
+
+	faults.mu.Lock()
+	failed := faults.rng.Float64() < rate
+	faults.mu.Unlock()
+	if !failed {
+		return false
+	}
+	w.Header().Set("content-type", "application/json")
+	respond(w, statusCode, ErrorResponse{Error: "injected failure"})
+	return true
+}
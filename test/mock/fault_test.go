@@ -0,0 +1,72 @@
+package mock_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/day0ops/ext-proc-routing-decision/test/mock"
+)
+
+// statuses returns the statuses of n requests to the url
+func statuses(n int, url string) []int {
+	codes := make([]int, n)
+	for i := range codes {
+		rr := httptest.NewRecorder()
+		mock.RequestHeaders(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		codes[i] = rr.Code
+	}
+	return codes
+}
+
+func TestFailRate(t *testing.T) {
+	mock.Seed(42)
+	codes := statuses(1000, "http://example.com/headers?fail_rate=0.3&fail_status=503")
+
+	failed := 0
+	for _, code := range codes {
+		if code != http.StatusOK {
+			require.Equal(t, http.StatusServiceUnavailable, code)
+			failed++
+		}
+	}
+	require.InDelta(t, 300, failed, 50)
+
+	mock.Seed(42)
+	require.Equal(t, codes, statuses(1000, "http://example.com/headers?fail_rate=0.3&fail_status=503"), "the same seed should fail the same requests")
+}
+
+func TestFailRateBounds(t *testing.T) {
+	for _, code := range statuses(100, "http://example.com/headers?fail_rate=0") {
+		require.Equal(t, http.StatusOK, code)
+	}
+	for _, code := range statuses(100, "http://example.com/headers?fail_rate=1") {
+		require.Equal(t, http.StatusInternalServerError, code)
+	}
+}
+
+func TestFailRateInvalid(t *testing.T) {
+	for _, url := range []string{
+		"http://example.com/headers?fail_rate=often",
+		"http://example.com/headers?fail_rate=1.5",
+		"http://example.com/headers?fail_rate=0.5&fail_status=unavailable",
+	} {
+		require.Equal(t, []int{http.StatusBadRequest}, statuses(1, url), url)
+	}
+}
+
+func TestFailRateResponseHeaders(t *testing.T) {
+	mock.Seed(42)
+	failed := 0
+	for range 1000 {
+		rr := httptest.NewRecorder()
+		mock.ResponseHeaders(rr, httptest.NewRequest(http.MethodGet, "http://example.com/response-headers?fail_rate=0.3&fail_status=503", nil))
+		if rr.Code != http.StatusOK {
+			require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+			failed++
+		}
+	}
+	require.InDelta(t, 300, failed, 50, "the requests which aren't failed succeed")
+}
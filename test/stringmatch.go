@@ -3,14 +3,19 @@ package test
 import (
 	"fmt"
 	"regexp"
+	"strings"
 	"testing"
 )
 
+// StringMatch matches values with a single match type, unlike HeaderMatch an empty value is a valid match
 type StringMatch struct {
-	Exact       *string     `json:"exact"`
-	Absent      *bool       `json:"absent"`
-	Regex       *string     `json:"regex"`
-	MatchAction MatchAction `json:"matchAction"`
+	Exact       *string     `json:"exact" yaml:"exact"`
+	Absent      *bool       `json:"absent" yaml:"absent"`
+	Prefix      *string     `json:"prefix" yaml:"prefix"`
+	Suffix      *string     `json:"suffix" yaml:"suffix"`
+	Contains    *string     `json:"contains" yaml:"contains"`
+	Regex       *string     `json:"regex" yaml:"regex"`
+	MatchAction MatchAction `json:"matchAction" yaml:"matchAction"`
 }
 
 func (sm StringMatch) Assert(t *testing.T, values ...string) bool {
@@ -42,25 +47,61 @@ func (sm StringMatch) Assert(t *testing.T, values ...string) bool {
 	return false
 }
 
+// matchTypes returns the match types set, in order of precedence
+func (sm *StringMatch) matchTypes() []string {
+	var types []string
+	for _, m := range []struct {
+		set       bool
+		matchType string
+	}{
+		{sm.Absent != nil, matchTypeAbsent},
+		{sm.Exact != nil, matchTypeExact},
+		{sm.Prefix != nil, matchTypePrefix},
+		{sm.Suffix != nil, matchTypeSuffix},
+		{sm.Contains != nil, matchTypeContains},
+		{sm.Regex != nil, matchTypeRegex},
+	} {
+		if m.set {
+			types = append(types, m.matchType)
+		}
+	}
+	return types
+}
+
+// Validate checks at most one match type is set and the regex, if any, compiles
+func (sm *StringMatch) Validate() error {
+	if types := sm.matchTypes(); len(types) > 1 {
+		return fmt.Errorf("string match sets several match types %v, only one is allowed", types)
+	}
+	if sm.Regex != nil {
+		if _, err := regexp.Compile(*sm.Regex); err != nil {
+			return fmt.Errorf("string match regex %q is invalid: %w", *sm.Regex, err)
+		}
+	}
+	return nil
+}
+
+// MatchType returns the match type set, the one with the highest precedence when several are
 func (sm *StringMatch) MatchType() string {
-	switch {
-	case sm.Exact != nil:
-		return "exact"
-	case sm.Absent != nil:
-		return "absent"
-	case sm.Regex != nil:
-		return "regex"
+	if types := sm.matchTypes(); len(types) > 0 {
+		return types[0]
 	}
 	return ""
 }
 
 func (sm *StringMatch) MatchValue() string {
-	switch {
-	case sm.Exact != nil:
-		return *sm.Exact
-	case sm.Absent != nil:
+	switch sm.MatchType() {
+	case matchTypeAbsent:
 		return fmt.Sprintf("%t", *sm.Absent)
-	case sm.Regex != nil:
+	case matchTypeExact:
+		return *sm.Exact
+	case matchTypePrefix:
+		return *sm.Prefix
+	case matchTypeSuffix:
+		return *sm.Suffix
+	case matchTypeContains:
+		return *sm.Contains
+	case matchTypeRegex:
 		return *sm.Regex
 	}
 
@@ -68,17 +109,24 @@ func (sm *StringMatch) MatchValue() string {
 }
 
 func (sm *StringMatch) match(value string) bool {
-	switch {
-	case sm.Absent != nil:
+	switch sm.MatchType() {
+	case matchTypeAbsent:
 		if *sm.Absent {
 			return value == ""
 		}
 		return value != ""
-	case sm.Exact != nil:
+	case matchTypeExact:
 		return value == *sm.Exact
-	case sm.Regex != nil:
-		r := regexp.MustCompile(*sm.Regex)
-		return r.MatchString(value)
+	case matchTypePrefix:
+		return strings.HasPrefix(value, *sm.Prefix)
+	case matchTypeSuffix:
+		return strings.HasSuffix(value, *sm.Suffix)
+	case matchTypeContains:
+		return strings.Contains(value, *sm.Contains)
+	case matchTypeRegex:
+		// an invalid regex is reported by Validate
+		matched, err := regexp.MatchString(*sm.Regex, value)
+		return err == nil && matched
 	}
 	return false
 }
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"net/http"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 
@@ -56,7 +58,10 @@ func (c Case) Run(t *testing.T, opts ...Options) {
 }
 
 type Input struct {
+	// Method of the request, GET by default. The method header is still honored when it isn't set.
+	Method  string  `yaml:"method"`
 	Headers Headers `yaml:"headers"`
+	Body    string  `yaml:"body"`
 }
 
 type Headers []HeaderValue
@@ -71,16 +76,45 @@ func (headers Headers) Get(key string) string {
 }
 
 type Actual struct {
+	Status          int
+	Body            string
 	RequestHeaders  http.Header
 	ResponseHeaders http.Header
 }
 
 type Expect struct {
+	// Status is the response status code, 0 accepts any
+	Status int `yaml:"status"`
+	// Body matches the raw response body, unlike the headers an empty value is a valid match: exact: "" expects an
+	// empty body
+	Body            *StringMatch  `yaml:"body"`
 	RequestHeaders  []HeaderMatch `yaml:"requestHeaders"`
 	ResponseHeaders []HeaderMatch `yaml:"responseHeaders"`
 }
 
 func (e Expect) Assert(t *testing.T, actual Actual) error {
+	for _, h := range slices.Concat(e.RequestHeaders, e.ResponseHeaders) {
+		if err := h.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if e.Status != 0 && e.Status != actual.Status {
+		return fmt.Errorf("status mismatch: expected %d and got %d", e.Status, actual.Status)
+	}
+
+	if e.Body != nil {
+		if err := e.Body.Validate(); err != nil {
+			return err
+		}
+		if e.Body.MatchType() == "" {
+			return errors.New("body match sets no match type")
+		}
+		if !e.Body.Assert(t, actual.Body) {
+			return fmt.Errorf("body match fail: body should match with %q=%q and is %q", e.Body.MatchType(), e.Body.MatchValue(), actual.Body)
+		}
+	}
+
 	for _, h := range e.RequestHeaders {
 		if !h.Assert(t, actual.RequestHeaders) {
 			return fmt.Errorf("header match fail: request header %q should match %q header values with %q=%q and its values are %v", h.Name, cmp.Or(h.MatchAction, MatchActionFirst), h.MatchType(), h.MatchValue(), actual.RequestHeaders.Values(h.Name))
@@ -108,10 +142,24 @@ const (
 	MatchActionAll   MatchAction = "ALL"
 )
 
+// match types of HeaderMatch and StringMatch, listed in order of precedence
+const (
+	matchTypeAbsent   = "absent"
+	matchTypeExact    = "exact"
+	matchTypePrefix   = "prefix"
+	matchTypeSuffix   = "suffix"
+	matchTypeContains = "contains"
+	matchTypeRegex    = "regex"
+)
+
+// HeaderMatch matches the values of a header with a single match type, an empty value is the same as not setting it
 type HeaderMatch struct {
 	Name        string      `yaml:"name"`
 	Exact       string      `yaml:"exact"`
 	Absent      bool        `yaml:"absent"`
+	Prefix      string      `yaml:"prefix"`
+	Suffix      string      `yaml:"suffix"`
+	Contains    string      `yaml:"contains"`
 	Regex       string      `yaml:"regex"`
 	MatchAction MatchAction `yaml:"matchAction"`
 }
@@ -144,40 +192,74 @@ func (hm HeaderMatch) Assert(t *testing.T, headers http.Header) bool {
 }
 
 func (hm *HeaderMatch) match(value string) bool {
-	switch {
-	case hm.Absent:
-		if hm.Absent {
-			return value == ""
-		}
-		return value != ""
-	case hm.Exact != "":
+	switch hm.MatchType() {
+	case matchTypeAbsent:
+		return value == ""
+	case matchTypeExact:
 		return value == hm.Exact
-	case hm.Regex != "":
+	case matchTypePrefix:
+		return strings.HasPrefix(value, hm.Prefix)
+	case matchTypeSuffix:
+		return strings.HasSuffix(value, hm.Suffix)
+	case matchTypeContains:
+		return strings.Contains(value, hm.Contains)
+	case matchTypeRegex:
 		r := regexp.MustCompile(hm.Regex)
 		return r.MatchString(value)
 	}
 	return false
 }
 
+// matchTypes returns the match types set, in order of precedence
+func (hm *HeaderMatch) matchTypes() []string {
+	var types []string
+	for _, m := range []struct {
+		set       bool
+		matchType string
+	}{
+		{hm.Absent, matchTypeAbsent},
+		{hm.Exact != "", matchTypeExact},
+		{hm.Prefix != "", matchTypePrefix},
+		{hm.Suffix != "", matchTypeSuffix},
+		{hm.Contains != "", matchTypeContains},
+		{hm.Regex != "", matchTypeRegex},
+	} {
+		if m.set {
+			types = append(types, m.matchType)
+		}
+	}
+	return types
+}
+
+// Validate checks at most one match type is set
+func (hm *HeaderMatch) Validate() error {
+	if types := hm.matchTypes(); len(types) > 1 {
+		return fmt.Errorf("header %q sets several match types %v, only one is allowed", hm.Name, types)
+	}
+	return nil
+}
+
+// MatchType returns the match type set, the one with the highest precedence when several are
 func (hm *HeaderMatch) MatchType() string {
-	switch {
-	case hm.Exact != "":
-		return "exact"
-	case hm.Absent:
-		return "absent"
-	case hm.Regex != "":
-		return "regex"
+	if types := hm.matchTypes(); len(types) > 0 {
+		return types[0]
 	}
 	return ""
 }
 
 func (hm *HeaderMatch) MatchValue() string {
-	switch {
-	case hm.Exact != "":
-		return hm.Exact
-	case hm.Absent:
+	switch hm.MatchType() {
+	case matchTypeAbsent:
 		return fmt.Sprintf("%t", hm.Absent)
-	case hm.Regex != "":
+	case matchTypeExact:
+		return hm.Exact
+	case matchTypePrefix:
+		return hm.Prefix
+	case matchTypeSuffix:
+		return hm.Suffix
+	case matchTypeContains:
+		return hm.Contains
+	case matchTypeRegex:
 		return hm.Regex
 	}
 	return ""
@@ -199,14 +281,18 @@ func httpCall(t *testing.T, tt Case) Actual {
 
 	baseURL := cmp.Or(tt.url, DefaultURL)
 	u := fmt.Sprintf("%s%s", baseURL, tt.Input.Headers.Get("path"))
-	req, err := http.NewRequest(http.MethodGet, u, nil)
+	var reqBody io.Reader
+	if tt.Input.Body != "" {
+		reqBody = strings.NewReader(tt.Input.Body)
+	}
+	req, err := http.NewRequest(cmp.Or(tt.Input.Method, http.MethodGet), u, reqBody)
 	require.NoError(t, err)
 
 	for _, header := range tt.Input.Headers {
 		if strings.ToLower(header.Key) == "host" {
 			req.Host = header.Value
 		}
-		if strings.ToLower(header.Key) == "method" {
+		if strings.ToLower(header.Key) == "method" && tt.Input.Method == "" {
 			req.Method = header.Value
 		}
 		req.Header.Add(header.Key, header.Value)
@@ -234,6 +320,8 @@ func httpCall(t *testing.T, tt Case) Actual {
 	}
 	res.Header.Add("status", fmt.Sprintf("%d", res.StatusCode))
 	actual := Actual{
+		Status:          res.StatusCode,
+		Body:            string(body),
 		ResponseHeaders: res.Header,
 		RequestHeaders:  requestHeaders,
 	}
@@ -2,7 +2,10 @@ package test_test
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -10,6 +13,7 @@ import (
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/zap"
 
+	"github.com/day0ops/ext-proc-routing-decision/pkg/config"
 	"github.com/day0ops/ext-proc-routing-decision/pkg/server"
 	extproctest "github.com/day0ops/ext-proc-routing-decision/test"
 	"github.com/day0ops/ext-proc-routing-decision/test/containers/envoy"
@@ -43,14 +47,16 @@ func (suite *IntegrationTestSuite) TearDownSuite() {
 	}
 }
 
-func (suite *IntegrationTestSuite) TestIntegrationTest() {
-	t := suite.T()
-	var logger *zap.Logger
+func (suite *IntegrationTestSuite) logger() *zap.Logger {
 	if enableDebug {
-		logger = zap.Must(zap.NewDevelopment())
-	} else {
-		logger = zap.NewNop()
+		return zap.Must(zap.NewDevelopment())
 	}
+	return zap.NewNop()
+}
+
+func (suite *IntegrationTestSuite) TestIntegrationTest() {
+	t := suite.T()
+	logger := suite.logger()
 	srv := server.New(context.Background(), logger, server.WithMockBackend())
 	errCh := make(chan error, 1)
 	go func() {
@@ -71,3 +77,40 @@ func (suite *IntegrationTestSuite) TestIntegrationTest() {
 	testcases.Run(t, extproctest.WithURL(suite.url))
 	require.NoError(t, srv.Stop())
 }
+
+// decisionServerFixture stands in for the external decision server and always decides the same
+func decisionServerFixture(t *testing.T, decision string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"decision": decision}) // nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestExternalDecision exercises the external call path end to end, the request carries no preferred-svc header so
+// the processor has to ask the decision server
+func (suite *IntegrationTestSuite) TestExternalDecision() {
+	t := suite.T()
+	templateData := struct {
+		Decision string
+	}{
+		Decision: "external-svc",
+	}
+
+	prev := config.RoutingDecisionServer
+	config.RoutingDecisionServer = decisionServerFixture(t, templateData.Decision).URL
+	t.Cleanup(func() { config.RoutingDecisionServer = prev })
+
+	srv := server.New(context.Background(), suite.logger(), server.WithMockBackend())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve()
+	}()
+	require.NoError(t, server.WaitReady(srv, 10*time.Second))
+
+	testcases := extproctest.LoadTemplate(t, "testdata/external_decision.yaml", templateData)
+	require.NotEmpty(t, testcases)
+	testcases.Run(t, extproctest.WithURL(suite.url))
+	require.NoError(t, srv.Stop())
+}